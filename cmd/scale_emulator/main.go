@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/pkg/pty"
+)
+
+func main() {
+	// 1. Parse Arguments
+	protocol := flag.String("protocol", hardware.ProtocolToledo, "Indicator format: toledo, and, generic")
+	scenario := flag.String("scenario", hardware.DefaultScenario, "Built-in scenario name or YAML/JSON file")
+	scenarioDir := flag.String("scenario-dir", hardware.DefaultScenarioDir, "Directory searched for scenario names")
+	weight := flag.String("weight", "", "Hold a constant weight instead of playing a scenario")
+	rate := flag.Float64("rate", 0, "Frames per second (default: scenario interval)")
+	listen := flag.String("listen", "", "Serve on TCP instead of a pty (e.g. :4001)")
+	link := flag.String("link", "", "Symlink to create for the pty slave (e.g. /tmp/ttyEMU0)")
+	flag.Parse()
+
+	framer, err := hardware.NewFramer(*protocol)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	var sc *hardware.Scenario
+	if *weight != "" {
+		w, err := strconv.ParseFloat(*weight, 64)
+		if err != nil {
+			log.Fatalf("Error: invalid --weight %q", *weight)
+		}
+		sc = &hardware.Scenario{
+			Name:     "fixed",
+			Unit:     "kg",
+			Interval: 200 * time.Millisecond,
+			Loop:     true,
+			Steps:    []hardware.ScenarioStep{{Action: hardware.ActionHold, Weight: &w, Duration: time.Hour}},
+		}
+	} else if sc, err = hardware.LoadScenario(*scenario, *scenarioDir); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	emu := hardware.NewEmulator(framer, sc)
+	if *rate > 0 {
+		emu.Interval = time.Duration(float64(time.Second) / *rate)
+	}
+	log.Printf("Emulating %s indicator, scenario %q, one frame every %v", *protocol, sc.Name, emu.Interval)
+
+	// 2. Serve
+	if *listen != "" {
+		serveTCP(emu, *listen)
+		return
+	}
+	servePTY(emu, *link)
+}
+
+// servePTY plays the indicator on a pseudo-terminal. Point a station's
+// Port Serial (or scale_sender --port) at the printed device.
+func servePTY(emu *hardware.Emulator, link string) {
+	master, slave, err := pty.Open()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	device := slave.Name()
+	if link != "" {
+		os.Remove(link)
+		if err := os.Symlink(device, link); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer os.Remove(link)
+		device = link
+	}
+	log.Printf("Indicator ready on %s", device)
+
+	stop := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		close(stop)
+	}()
+
+	if err := emu.Serve(master, stop); err != nil {
+		log.Printf("Emulator stopped: %v", err)
+	}
+}
+
+// serveTCP plays the indicator for every client that connects, like an
+// Ethernet indicator or a ser2net port. Use tcp://host:port as Port Serial.
+func serveTCP(emu *hardware.Emulator, addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Printf("Indicator listening on %s", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		log.Printf("Client connected: %s", conn.RemoteAddr())
+		go func() {
+			defer conn.Close()
+			err := emu.Serve(conn, nil)
+			log.Printf("Client %s disconnected: %v", conn.RemoteAddr(), err)
+		}()
+	}
+}
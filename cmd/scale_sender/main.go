@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"go.bug.st/serial"
+	"stoneweigh/internal/pkg/units"
 )
 
 // Config represents the client configuration
@@ -21,6 +22,7 @@ type Config struct {
 	Token     string
 	ComPort   string
 	BaudRate  int
+	Unit      string // Overrides the unit read from the frames
 }
 
 // Payload matches the server's RemoteScalePayload
@@ -35,6 +37,7 @@ func main() {
 	token := flag.String("token", "", "Authentication Token (Required)")
 	comPort := flag.String("port", "COM1", "Serial Port (e.g., COM1 or /dev/ttyUSB0)")
 	baudRate := flag.Int("baud", 9600, "Baud Rate")
+	unit := flag.String("unit", "", "Weight unit (kg, t, lb); default: as sent by the indicator, else the station unit")
 	flag.Parse()
 
 	if *token == "" {
@@ -47,6 +50,12 @@ func main() {
 		Token:     *token,
 		ComPort:   *comPort,
 		BaudRate:  *baudRate,
+		Unit:      *unit,
+	}
+	if config.Unit != "" {
+		if _, err := units.Parse(config.Unit); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
 	}
 
 	log.Printf("Starting Scale Sender...")
@@ -92,9 +101,13 @@ func readAndSend(port serial.Port, config Config) {
 	for scanner.Scan() {
 		text := scanner.Text()
 		weight := parseWeight(text)
+		unit := config.Unit
+		if unit == "" {
+			unit = parseUnit(text)
+		}
 
 		// Send to Server
-		err := sendToServer(client, config, weight)
+		err := sendToServer(client, config, weight, unit)
 		if err != nil {
 			log.Printf("Failed to send: %v", err)
 		}
@@ -104,8 +117,8 @@ func readAndSend(port serial.Port, config Config) {
 	}
 }
 
-func sendToServer(client *http.Client, config Config, weight float64) error {
-	payload := Payload{Weight: weight, Unit: "kg"}
+func sendToServer(client *http.Client, config Config, weight float64, unit string) error {
+	payload := Payload{Weight: weight, Unit: unit}
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return err
@@ -146,3 +159,19 @@ func parseWeight(raw string) float64 {
 	}
 	return 0.0
 }
+
+// parseUnit returns the weight unit at the end of a frame ("12345 kg"),
+// empty when there is none so the server uses the station unit
+func parseUnit(raw string) string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	unit, err := units.Parse(fields[len(fields)-1])
+	if err != nil {
+		return ""
+	}
+	return unit
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -62,6 +64,43 @@ func main() {
 	// 4. Initialize Handlers
 	server := handlers.NewServer(db, hardware.Manager, anpr)
 
+	// Health watchdog: silent/stuck alerts, events persisted for the health page
+	go hardware.Manager.WatchHealth(10*time.Second, nil)
+	stopEvents, eventsSaved := make(chan struct{}), make(chan struct{})
+	go func() {
+		server.RecordScaleEvents(stopEvents)
+		close(eventsSaved)
+	}()
+
+	// Weight curve of every station, for checking disputed weighings
+	go server.RecordWeightSamples(nil)
+
+	// Barrier gates and traffic lights driven by the station readings
+	if err := server.Outputs.Load(db); err != nil {
+		log.Printf("Failed to load output devices: %v", err)
+	}
+	go server.Outputs.Run(hardware.Manager.Events, nil)
+
+	// Unattended kiosk stations, driven by the readings and tag reads
+	if err := server.Kiosk.Load(db); err != nil {
+		log.Printf("Failed to load kiosk stations: %v", err)
+	}
+	go server.Kiosk.Run(hardware.Manager.Events, hardware.Manager.Tags, nil)
+
+	// Release the scale ports on stop, so a restarted service can open them
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		log.Println("Shutting down, closing scale ports...")
+		hardware.Manager.Shutdown()
+		// Save the disconnects of Shutdown, so uptime stops counting
+		close(stopEvents)
+		<-eventsSaved
+		server.Outputs.Close()
+		os.Exit(0)
+	}()
+
 	// 5. Setup Router
 	r := router.SetupRouter(server)
 
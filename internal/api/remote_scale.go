@@ -5,13 +5,14 @@ import (
 	"stoneweigh/internal/database"
 	"stoneweigh/internal/hardware"
 	"stoneweigh/internal/models"
-	"time"
+	"stoneweigh/internal/pkg/units"
 
 	"github.com/gin-gonic/gin"
 )
 
 type RemoteScalePayload struct {
 	Weight float64 `json:"weight"`
+	Unit   string  `json:"unit"` // Empty means the station unit
 }
 
 // HandleRemoteScaleData receives weight data from a remote client
@@ -40,25 +41,29 @@ func HandleRemoteScaleData(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
 		return
 	}
+	if _, err := units.Parse(payload.Unit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// 4. Broadcast to ScaleManager
-	// We inject this directly into the DataChannel which the SSE handler listens to.
-	if hardware.Manager != nil {
-		hardware.Manager.DataChannel <- hardware.ScaleData{
-			ScaleID:   station.ID,
-			Weight:    payload.Weight,
-			Connected: true,
-			Timestamp: time.Now().Unix(),
-		}
-	} else {
+	// 4. Feed the ScaleManager: stability engine, capture and SSE see it
+	// exactly like a reading from a local port.
+	if hardware.Manager == nil {
 		// Should not happen if server is running correctly
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Scale manager not initialized"})
 		return
 	}
+	data := hardware.Manager.IngestRemote(station.ID, hardware.Reading{
+		Weight:   payload.Weight,
+		Unit:     payload.Unit,
+		Negative: payload.Weight < 0,
+		Mode:     hardware.ModeGross,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"station": station.Name,
+		"status":          "success",
+		"station":         station.Name,
 		"received_weight": payload.Weight,
+		"weight_kg":       data.Weight,
 	})
 }
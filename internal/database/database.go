@@ -72,11 +72,21 @@ func Connect() {
 	DB.AutoMigrate(
 		&models.User{},
 		&models.Invoice{},
-		&models.ScaleConfig{},
 		&models.Vehicle{},
 		&models.WeighingRecord{},
+		&models.AxleWeight{},
+		&models.TareRecord{},
+		&models.UsedCapture{},
+		&models.VehicleTag{},
 		&models.WeighingStation{},
 		&models.StationCamera{},
 		&models.UserStationAssignment{},
+		&models.AuditLog{},
+		&models.ScaleEvent{},
+		&models.ScaleHealthSnapshot{},
+		&models.WeightSample{},
+		&models.WeightCurve{},
+		&models.OutputDevice{},
+		&models.OutputRule{},
 	)
 }
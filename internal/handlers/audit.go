@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"log"
+
+	"stoneweigh/internal/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// sessionUsername returns the logged in username, "Unknown" if missing
+func sessionUsername(c *gin.Context) string {
+	session := sessions.Default(c)
+	if val, ok := session.Get("username").(string); ok && val != "" {
+		return val
+	}
+	return "Unknown"
+}
+
+// audit persists an audit entry for a sensitive action of the session user.
+// Failures are logged but never block the action itself.
+func (s *Server) audit(c *gin.Context, action string, stationID, recordID uint, detail string) {
+	s.auditAs(sessionUsername(c), action, stationID, recordID, detail)
+}
+
+// auditAs is audit for actions without a request, such as the kiosk's
+func (s *Server) auditAs(username, action string, stationID, recordID uint, detail string) {
+	entry := models.AuditLog{
+		Action:    action,
+		Username:  username,
+		StationID: stationID,
+		RecordID:  recordID,
+		Detail:    detail,
+	}
+	log.Printf("[AUDIT] %s by %s (station %d, record %d): %s", action, entry.Username, stationID, recordID, detail)
+	if err := s.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// canOperate reports whether the session user may operate a station.
+// Admins can operate every station, operators only their assignments.
+func (s *Server) canOperate(c *gin.Context, stationID uint) bool {
+	session := sessions.Default(c)
+	if session.Get("role") == "admin" {
+		return true
+	}
+	uid := session.Get("user_id")
+	if uid == nil {
+		return false
+	}
+	var count int64
+	s.DB.Model(&models.UserStationAssignment{}).
+		Where("user_id = ? AND weighing_station_id = ?", uid, stationID).
+		Count(&count)
+	return count > 0
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stoneweigh/internal/kiosk"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/capture"
+	"stoneweigh/internal/pkg/units"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CaptureWeight freezes the current reading of a station into a signed,
+// short-lived token. Transactions only accept scale weights through it.
+func (s *Server) CaptureWeight(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	stationID := uint(id)
+
+	if !s.canOperate(c, stationID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Anda tidak memiliki akses ke stasiun ini"})
+		return
+	}
+
+	var station models.WeighingStation
+	if err := s.DB.First(&station, stationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Station not found"})
+		return
+	}
+
+	status, ok := s.ScaleMgr.Status(stationID)
+	if !ok || !status.Connected {
+		c.JSON(http.StatusConflict, gin.H{"error": "Timbangan tidak terhubung"})
+		return
+	}
+	if station.SumStationID != 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Stasiun ini adalah deck, tangkap berat dari stasiun penjumlahnya"})
+		return
+	}
+	if station.AxleMode {
+		s.captureAxlePass(c, stationID)
+		return
+	}
+	if status.Overload {
+		c.JSON(http.StatusConflict, gin.H{"error": "Timbangan overload"})
+		return
+	}
+	if status.Tared() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Indikator dalam mode net, kembalikan ke mode gross sebelum menangkap berat"})
+		return
+	}
+	if !status.Position.Clear() {
+		c.JSON(http.StatusConflict, gin.H{"error": kiosk.PositionMessage(status.Position)})
+		return
+	}
+	if station.RequireStable && !status.Stable {
+		c.JSON(http.StatusConflict, gin.H{"error": "Berat belum stabil, tunggu hingga timbangan stabil"})
+		return
+	}
+
+	weight := status.Weight
+	if status.Stable {
+		weight = status.SettledWeight
+	}
+
+	token, capt, err := s.Captures.Issue(capture.Capture{
+		ScaleID:    stationID,
+		Weight:     weight,
+		Unit:       status.Unit,
+		Stable:     status.Stable,
+		CapturedBy: sessionUsername(c),
+	}, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to capture weight"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"weight":     capt.Weight,
+		"unit":       capt.Unit,
+		"stable":     capt.Stable,
+		"expires_at": capt.ExpiresAt,
+	})
+}
+
+// captureAxlePass issues a capture token for the vehicle that last crossed
+// an axle weighing station: the weight is the sum of its settled axles.
+func (s *Server) captureAxlePass(c *gin.Context, stationID uint) {
+	pass := s.ScaleMgr.TakeAxlePass(stationID)
+	if pass == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Belum ada kendaraan yang selesai ditimbang per gandar"})
+		return
+	}
+
+	token, capt, err := s.Captures.Issue(capture.Capture{
+		ScaleID:    stationID,
+		Weight:     pass.Total,
+		Stable:     true,
+		Axles:      pass.Axles,
+		CapturedBy: sessionUsername(c),
+	}, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to capture weight"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"weight":     capt.Weight,
+		"stable":     capt.Stable,
+		"axles":      capt.Axles,
+		"expires_at": capt.ExpiresAt,
+	})
+}
+
+// resolveCapture verifies a capture token for a station and makes sure
+// it has not been used by another record yet.
+func (s *Server) resolveCapture(token string, stationID uint) (capture.Capture, error) {
+	if token == "" {
+		return capture.Capture{}, errors.New("capture token wajib diisi, tangkap berat dari timbangan terlebih dahulu")
+	}
+	capt, err := s.Captures.Verify(token, time.Now())
+	if err != nil {
+		return capture.Capture{}, err
+	}
+	if capt.ScaleID != stationID {
+		return capture.Capture{}, errors.New("capture token berasal dari timbangan lain")
+	}
+	// Early answer only, claimCapture decides when the weight is saved
+	var used int64
+	s.DB.Model(&models.UsedCapture{}).Where("capture_id = ?", capt.ID).Count(&used)
+	if used > 0 {
+		return capture.Capture{}, errCaptureUsed
+	}
+	return capt, nil
+}
+
+var errCaptureUsed = errors.New("capture token sudah dipakai")
+
+// claimCapture spends a capture token within the transaction saving its
+// weight. It fails with errCaptureUsed when another save claimed the token
+// first. Manual weights have no token to claim.
+func claimCapture(tx *gorm.DB, captureID string) error {
+	if captureID == "" {
+		return nil
+	}
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UsedCapture{CaptureID: captureID, UsedAt: time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errCaptureUsed
+	}
+	return nil
+}
+
+// resolvedWeight is the weight of one weighing step and where it came from
+type resolvedWeight struct {
+	Weight       float64
+	Axles        []float64 // Axle weighing stations only
+	CaptureID    string
+	CapturedAt   time.Time // When the scale was read, or typed in manual mode
+	Manual       bool
+	ManualReason string
+
+	// Display settings of the station, stored on the record
+	Unit     string
+	Division float64
+}
+
+// resolveWeight picks the weight of a weighing step: from a capture token or,
+// in manual mode, the value typed in the station display unit, rounded to
+// the station division like scale readings are. It writes the error response itself and
+// returns false when the request must stop.
+func (s *Server) resolveWeight(c *gin.Context, stationID uint, token string, manual bool, reason string, typed float64) (resolvedWeight, bool) {
+	unit, division := s.stationUnit(stationID)
+	if manual {
+		if !s.canEnterManually(c, stationID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Input berat manual tidak diizinkan di stasiun ini"})
+			return resolvedWeight{}, false
+		}
+		reason = strings.TrimSpace(reason)
+		if reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Alasan input manual wajib diisi"})
+			return resolvedWeight{}, false
+		}
+		// A typed weight is still the weight of the vehicle on the platform
+		if status, ok := s.ScaleMgr.Status(stationID); ok && !status.Position.Clear() && !s.isAxleStation(stationID) {
+			c.JSON(http.StatusConflict, gin.H{"error": kiosk.PositionMessage(status.Position)})
+			return resolvedWeight{}, false
+		}
+		return resolvedWeight{
+			Weight:       units.Normalize(typed, unit, unit, division),
+			CapturedAt:   time.Now(),
+			Manual:       true,
+			ManualReason: reason,
+			Unit:         unit,
+			Division:     division,
+		}, true
+	}
+
+	capt, err := s.resolveCapture(token, stationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return resolvedWeight{}, false
+	}
+	return resolvedWeight{
+		Weight:     capt.Weight,
+		Axles:      capt.Axles,
+		CaptureID:  capt.ID,
+		CapturedAt: time.Unix(capt.CapturedAt, 0),
+		Unit:       unit,
+		Division:   division,
+	}, true
+}
+
+// stationUnit returns the display unit and division of a station, kg
+// without rounding when the station is unknown
+func (s *Server) stationUnit(stationID uint) (string, float64) {
+	var station models.WeighingStation
+	if err := s.DB.Select("unit", "division").First(&station, stationID).Error; err != nil {
+		return units.Kilogram, 0
+	}
+	unit, err := units.Parse(station.Unit)
+	if err != nil {
+		return units.Kilogram, 0
+	}
+	return unit, station.Division
+}
+
+// isAxleStation reports whether vehicles cross the station axle by axle,
+// where the position sensors are not checked
+func (s *Server) isAxleStation(stationID uint) bool {
+	var station models.WeighingStation
+	return s.DB.Select("axle_mode").First(&station, stationID).Error == nil && station.AxleMode
+}
+
+// axleWeights turns the axles of a resolved weight into records for the
+// given weighing pass (1 first or only weighing, 2 second weighing)
+func axleWeights(pass int, w resolvedWeight) []models.AxleWeight {
+	var axles []models.AxleWeight
+	for i, weight := range w.Axles {
+		axles = append(axles, models.AxleWeight{Pass: pass, Axle: i + 1, Weight: weight})
+	}
+	return axles
+}
+
+// canEnterManually reports whether typed weights are allowed for the user
+// on this station: admins always, operators only where the station allows it.
+func (s *Server) canEnterManually(c *gin.Context, stationID uint) bool {
+	if sessions.Default(c).Get("role") == "admin" {
+		return true
+	}
+	if !s.canOperate(c, stationID) {
+		return false
+	}
+	var station models.WeighingStation
+	if err := s.DB.First(&station, stationID).Error; err != nil {
+		return false
+	}
+	return station.AllowManualEntry
+}
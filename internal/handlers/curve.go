@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/timeseries"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === Weight curve (time series of scale readings) ===
+
+// DefaultSampleRetention is used when WEIGHT_SAMPLE_RETENTION_DAYS is not set
+const DefaultSampleRetention = 30 * 24 * time.Hour
+
+const (
+	curveBefore   = 2 * time.Minute  // Curve kept before a capture: the truck driving on and settling
+	curveAfter    = 30 * time.Second // and after it
+	maxCurveRange = 24 * time.Hour   // Longest range GetStationCurve returns
+	sampleFlush   = 2 * time.Second  // Samples are written in batches
+	samplePrune   = time.Hour
+)
+
+// weightCurve links the curve around a capture to a weighing record
+func weightCurve(stationID uint, pass int, w resolvedWeight) models.WeightCurve {
+	return models.WeightCurve{
+		StationID:  stationID,
+		Pass:       pass,
+		CapturedAt: w.CapturedAt,
+		StartAt:    w.CapturedAt.Add(-curveBefore),
+		EndAt:      w.CapturedAt.Add(curveAfter),
+	}
+}
+
+// RecordWeightSamples stores the downsampled readings of every station and
+// prunes expired samples until stop is closed. Run it in its own goroutine.
+func (s *Server) RecordWeightSamples(stop <-chan struct{}) {
+	events := s.ScaleMgr.Events.Subscribe(1024)
+	defer events.Close()
+	flush := time.NewTicker(sampleFlush)
+	defer flush.Stop()
+	prune := time.NewTicker(samplePrune)
+	defer prune.Stop()
+
+	var batch []models.WeightSample
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.DB.CreateInBatches(batch, 500).Error; err != nil {
+			log.Printf("Failed to save weight samples: %v", err)
+		}
+		batch = nil
+	}
+	defer write()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case d := <-events.C:
+			sample := timeseries.Sample{StationID: d.ScaleID, At: time.Now(), Weight: d.Weight, Stable: d.Stable, Connected: d.Connected}
+			if s.Samples.Keep(sample) {
+				batch = append(batch, models.WeightSample{
+					StationID: sample.StationID,
+					At:        sample.At,
+					Weight:    sample.Weight,
+					Stable:    sample.Stable,
+					Connected: sample.Connected,
+				})
+			}
+		case <-flush.C:
+			write()
+		case now := <-prune.C:
+			if n, err := s.PruneWeightSamples(now); err != nil {
+				log.Printf("Failed to prune weight samples: %v", err)
+			} else if n > 0 {
+				log.Printf("Pruned %d weight samples", n)
+			}
+		}
+	}
+}
+
+// PruneWeightSamples deletes samples older than the retention period,
+// except those inside the curve of a weighing record
+func (s *Server) PruneWeightSamples(now time.Time) (int64, error) {
+	if s.SampleRetention <= 0 {
+		return 0, nil
+	}
+	res := s.DB.Where("at < ?", now.Add(-s.SampleRetention)).
+		Where(`NOT EXISTS (SELECT 1 FROM weight_curves wc WHERE wc.deleted_at IS NULL
+			AND wc.station_id = weight_samples.station_id
+			AND weight_samples.at BETWEEN wc.start_at AND wc.end_at)`).
+		Delete(&models.WeightSample{})
+	return res.RowsAffected, res.Error
+}
+
+// weightSamples returns the samples of a station between from and to, oldest first
+func (s *Server) weightSamples(stationID uint, from, to time.Time) ([]models.WeightSample, error) {
+	samples := []models.WeightSample{}
+	err := s.DB.Where("station_id = ? AND at BETWEEN ? AND ?", stationID, from, to).Order("at").Find(&samples).Error
+	return samples, err
+}
+
+// GetStationCurve returns the weight curve of a station for a time range
+// (RFC 3339 from/to), the last 10 minutes by default
+func (s *Server) GetStationCurve(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format waktu 'to' tidak valid"})
+			return
+		}
+	}
+	from := to.Add(-10 * time.Minute)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format waktu 'from' tidak valid"})
+			return
+		}
+	}
+	if !to.After(from) || to.Sub(from) > maxCurveRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rentang waktu harus antara 0 dan 24 jam"})
+		return
+	}
+
+	samples, err := s.weightSamples(uint(id), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weight curve"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"station_id": id, "from": from, "to": to, "samples": samples})
+}
+
+// transactionCurve is one linked curve of a weighing with its samples
+type transactionCurve struct {
+	models.WeightCurve
+	Samples []models.WeightSample `json:"samples"`
+}
+
+// GetTransactionCurve returns the weight curves around the captures of a
+// weighing record, to check a disputed weighing afterward
+func (s *Server) GetTransactionCurve(c *gin.Context) {
+	var record models.WeighingRecord
+	if err := s.DB.Preload("Curves").First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+
+	curves := []transactionCurve{}
+	for _, wc := range record.Curves {
+		samples, err := s.weightSamples(wc.StationID, wc.StartAt, wc.EndAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weight curve"})
+			return
+		}
+		curves = append(curves, transactionCurve{WeightCurve: wc, Samples: samples})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":       record.TicketNumber,
+		"gross_weight": record.GrossWeight,
+		"tare_weight":  record.TareWeight,
+		"curves":       curves,
+	})
+}
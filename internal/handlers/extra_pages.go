@@ -17,11 +17,40 @@ func (s *Server) ShowReports(c *gin.Context) {
 		fullName = v.(string)
 	}
 
+	start, end := reportRange(c)
+
+	var records []models.WeighingRecord
+	s.DB.Where("weighed_at BETWEEN ? AND ?", start, end).Order("weighed_at desc").Find(&records)
+
+	// Calculate TotalNetWeight
+	type Result struct {
+		Total float64
+	}
+	var res Result
+	s.DB.Model(&models.WeighingRecord{}).
+		Select("sum(net_weight) as total").
+		Where("weighed_at BETWEEN ? AND ?", start, end).
+		Scan(&res)
+
+	c.HTML(http.StatusOK, "reports.html", gin.H{
+		"title":          "Laporan",
+		"active":         "reports",
+		"showNav":        true,
+		"CurrentUser":    fullName,
+		"Records":        records,
+		"TotalNetWeight": res.Total,
+		"StartDate":      start.Format("2006-01-02"),
+		"EndDate":        end.Format("2006-01-02"),
+	})
+}
+
+// reportRange parses the start_date/end_date filters of the report pages,
+// defaulting to the last 7 days. end is moved to the end of its day.
+func reportRange(c *gin.Context) (start, end time.Time) {
 	// Parse filters
 	startStr := c.Query("start_date")
 	endStr := c.Query("end_date")
 
-	var start, end time.Time
 	var err error
 
 	if startStr != "" {
@@ -44,30 +73,7 @@ func (s *Server) ShowReports(c *gin.Context) {
 
 	// Adjust end to end of day
 	end = end.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-
-	var records []models.WeighingRecord
-	s.DB.Where("weighed_at BETWEEN ? AND ?", start, end).Order("weighed_at desc").Find(&records)
-
-	// Calculate TotalNetWeight
-	type Result struct {
-		Total float64
-	}
-	var res Result
-	s.DB.Model(&models.WeighingRecord{}).
-		Select("sum(net_weight) as total").
-		Where("weighed_at BETWEEN ? AND ?", start, end).
-		Scan(&res)
-
-	c.HTML(http.StatusOK, "reports.html", gin.H{
-		"title":          "Laporan",
-		"active":         "reports",
-		"showNav":        true,
-		"CurrentUser":    fullName,
-		"Records":        records,
-		"TotalNetWeight": res.Total,
-		"StartDate":      start.Format("2006-01-02"),
-		"EndDate":        end.Format("2006-01-02"),
-	})
+	return start, end
 }
 
 // ShowSettings renders the main settings landing page
@@ -1,17 +1,26 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"stoneweigh/internal/cv"
 	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/kiosk"
 	"stoneweigh/internal/models"
+	"stoneweigh/internal/outputs"
 	"stoneweigh/internal/pkg"
+	"stoneweigh/internal/pkg/capture"
+	"stoneweigh/internal/pkg/odol"
+	"stoneweigh/internal/pkg/timeseries"
+	"stoneweigh/internal/pkg/units"
 	"stoneweigh/internal/reporting"
 
 	"github.com/gin-contrib/sessions"
@@ -24,10 +33,109 @@ type Server struct {
 	DB          *gorm.DB
 	ScaleMgr    *hardware.ScaleManager
 	ANPRService *cv.ANPRService
+	Captures    *capture.Signer
+	Overload    odol.Policy
+
+	TareValidity  time.Duration // Age after which a stored tare is refused, 0 never
+	TareDeviation float64       // Percent change against the previous tare that gets flagged
+
+	Samples         timeseries.Downsampler // Which readings RecordWeightSamples stores
+	SampleRetention time.Duration          // Age after which samples are pruned, 0 never
+
+	Outputs *outputs.Controller // Barrier gates and traffic lights
+
+	Kiosk             *kiosk.Controller // Unattended weighing stations
+	KioskPrintCommand string            // Prints kiosk tickets as <command> -d <printer> <pdf>
+	KioskWebhook      string            // URL kiosk escalations are posted to, "" none
 }
 
 func NewServer(db *gorm.DB, sm *hardware.ScaleManager, anpr *cv.ANPRService) *Server {
-	return &Server{DB: db, ScaleMgr: sm, ANPRService: anpr}
+	// Capture tokens are signed with their own secret, falling back to the session one
+	secret := os.Getenv("CAPTURE_SECRET")
+	if secret == "" {
+		secret = os.Getenv("SESSION_SECRET")
+	}
+	if secret == "" {
+		secret = "secret"
+	}
+	ttl := 120 * time.Second
+	if v, err := strconv.Atoi(os.Getenv("CAPTURE_TTL_SECONDS")); err == nil && v > 0 {
+		ttl = time.Duration(v) * time.Second
+	}
+
+	// Overload thresholds in percent above the permitted gross weight (JBI)
+	overload := odol.NewPolicy(envPercent("ODOL_APPROVAL_PERCENT"), envPercent("ODOL_BLOCK_PERCENT"))
+
+	// Stored tares expire so trucks get re-tared after repairs and the like
+	tareValidity := DefaultTareValidity
+	if v, err := strconv.Atoi(os.Getenv("TARE_VALID_DAYS")); err == nil && v >= 0 {
+		tareValidity = time.Duration(v) * 24 * time.Hour
+	}
+	tareDeviation := envPercent("TARE_DEVIATION_PERCENT")
+	if tareDeviation < 0 {
+		tareDeviation = DefaultTareDeviation
+	}
+
+	// Weight curve: smallest change worth a sample (kg) and how long to keep it
+	var samples timeseries.Downsampler
+	if v, err := strconv.ParseFloat(os.Getenv("WEIGHT_SAMPLE_STEP"), 64); err == nil && v >= 0 {
+		samples.Step = v
+	}
+	sampleRetention := DefaultSampleRetention
+	if v, err := strconv.Atoi(os.Getenv("WEIGHT_SAMPLE_RETENTION_DAYS")); err == nil && v >= 0 {
+		sampleRetention = time.Duration(v) * 24 * time.Hour
+	}
+
+	// Relay outputs: weight (kg) from which a vehicle is on the scale
+	outs := outputs.NewController()
+	if v, err := strconv.ParseFloat(os.Getenv("OUTPUT_OCCUPIED_KG"), 64); err == nil && v > 0 {
+		outs.OccupiedWeight = v
+	}
+
+	// Kiosk: how long a vehicle gets to be identified and to settle
+	var kioskConfig kiosk.Config
+	kioskConfig.OccupiedWeight = outs.OccupiedWeight
+	if v, err := strconv.Atoi(os.Getenv("KIOSK_SETTLE_SECONDS")); err == nil && v > 0 {
+		kioskConfig.SettleTime = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(os.Getenv("KIOSK_IDENTIFY_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		kioskConfig.IdentifyTimeout = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(os.Getenv("KIOSK_STABLE_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		kioskConfig.StableTimeout = time.Duration(v) * time.Second
+	}
+	printCommand := os.Getenv("KIOSK_PRINT_COMMAND")
+	if printCommand == "" {
+		printCommand = "lp"
+	}
+
+	s := &Server{
+		DB:              db,
+		ScaleMgr:        sm,
+		ANPRService:     anpr,
+		Captures:        capture.NewSigner(secret, ttl),
+		Overload:        overload,
+		TareValidity:    tareValidity,
+		TareDeviation:   tareDeviation,
+		Samples:         samples,
+		SampleRetention: sampleRetention,
+		Outputs:         outs,
+
+		KioskPrintCommand: printCommand,
+		KioskWebhook:      os.Getenv("KIOSK_WEBHOOK_URL"),
+	}
+	s.Kiosk = kiosk.NewController(kioskBackend{s})
+	s.Kiosk.Config = kioskConfig
+	return s
+}
+
+// envPercent reads a percentage setting, -1 when unset or invalid
+func envPercent(key string) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || v < 0 {
+		return -1
+	}
+	return v
 }
 
 // === VIEW HANDLERS ===
@@ -89,16 +197,17 @@ func (s *Server) ShowWeighing(c *gin.Context) {
 	// If operator, show only assigned stations
 	// Note: We need to pass the list of allowed stations to the template so JS can render them dynamically
 	// instead of hardcoded 1,2,3.
+	// Decks of a split-deck weighbridge are only weighed through their summing station.
 
 	var allowedStations []models.WeighingStation
 
 	if role := session.Get("role"); role == "admin" {
-		s.DB.Preload("Cameras").Where("enabled = ?", true).Find(&allowedStations)
+		s.DB.Preload("Cameras").Where("enabled = ? AND sum_station_id = 0", true).Find(&allowedStations)
 	} else if uidVal != nil {
 		var assignments []models.UserStationAssignment
 		s.DB.Preload("WeighingStation.Cameras").Where("user_id = ?", uidVal).Find(&assignments)
 		for _, a := range assignments {
-			if a.WeighingStation.Enabled {
+			if a.WeighingStation.Enabled && a.WeighingStation.SumStationID == 0 {
 				allowedStations = append(allowedStations, a.WeighingStation)
 			}
 		}
@@ -116,16 +225,25 @@ func (s *Server) ShowWeighing(c *gin.Context) {
 
 // === API HANDLERS ===
 
-// SaveTransaction handles the final weighing and invoice generation
+// SaveTransaction handles the final weighing and invoice generation.
+// The gross weight comes from a server-side capture token; typed weights are
+// only accepted in manual mode, which requires a reason and is audited.
 func (s *Server) SaveTransaction(c *gin.Context) {
 	var input struct {
-		ScaleID     uint    `json:"scale_id"`
-		PlateNumber string  `json:"plate_number"`
-		DriverName  string  `json:"driver_name"`
-		Company     string  `json:"company"`
-		Product     string  `json:"product"`
-		Gross       float64 `json:"gross"`
-		Tare        float64 `json:"tare"`
+		ScaleID      uint   `json:"scale_id"`
+		PlateNumber  string `json:"plate_number"`
+		DriverName   string `json:"driver_name"`
+		Company      string `json:"company"`
+		Product      string `json:"product"`
+		CaptureToken string `json:"capture_token"`
+
+		// Manual entry mode only, weights in the station display unit
+		Manual       bool    `json:"manual"`
+		ManualReason string  `json:"manual_reason"`
+		Gross        float64 `json:"gross"`
+		Tare         float64 `json:"tare"`
+
+		overloadApproval
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -133,16 +251,28 @@ func (s *Server) SaveTransaction(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Transaction Data - Plate: %s, Driver: %s, Company: %s, Product: %s, Gross: %.2f, Tare: %.2f",
-		input.PlateNumber, input.DriverName, input.Company, input.Product, input.Gross, input.Tare)
-
-	session := sessions.Default(c)
-	managerName := "Unknown"
-	if val := session.Get("username"); val != nil {
-		managerName = val.(string)
+	weight, ok := s.resolveWeight(c, input.ScaleID, input.CaptureToken, input.Manual, input.ManualReason, input.Gross)
+	if !ok {
+		return
+	}
+	gross := weight.Weight
+	tare := units.Normalize(input.Tare, weight.Unit, weight.Unit, weight.Division)
+	if !weight.Manual {
+		stored, err := s.storedTare(input.PlateNumber, time.Now())
+		if err != nil {
+			// Without a tare the net weight would silently be the gross
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "retare_required": !errors.Is(err, errVehicleUnregistered)})
+			return
+		}
+		tare = stored
 	}
 
-	net := input.Gross - input.Tare
+	log.Printf("Transaction Data - Plate: %s, Driver: %s, Company: %s, Product: %s, Gross: %.2f, Tare: %.2f, Manual: %t",
+		input.PlateNumber, input.DriverName, input.Company, input.Product, gross, tare, input.Manual)
+
+	managerName := sessionUsername(c)
+
+	net := gross - tare
 	// Use UnixNano to prevent collision on rapid submissions
 	ticket, err:= pkg.GenerateTicketID(12)
 	if err != nil {
@@ -157,38 +287,70 @@ func (s *Server) SaveTransaction(c *gin.Context) {
 		CompanyName:  input.Company,
 		ManagerName:  managerName,
 		Product:      input.Product,
-		GrossWeight:  input.Gross,
-		TareWeight:   input.Tare,
+		GrossWeight:  gross,
+		TareWeight:   tare,
 		NetWeight:    net,
-		Status:       "COMPLETED",
+		Unit:         weight.Unit,
+		Division:     weight.Division,
+		Status:       models.StatusCompleted,
+		CaptureID:    weight.CaptureID,
+		ManualEntry:  weight.Manual,
+		ManualReason: weight.ManualReason,
 		WeighedAt:    time.Now(),
+		Axles:        axleWeights(1, weight),
+		Curves:       []models.WeightCurve{weightCurve(input.ScaleID, 1, weight)},
 	}
-
-	// Generate PDF
-	path, err := reporting.GenerateInvoice(record)
-	if err == nil {
-		record.InvoicePath = path
-	} else {
-		fmt.Printf("Error generating PDF: %v\n", err)
+	if !s.checkOverload(c, &record, input.overloadApproval) {
+		return
 	}
-
-	if err := s.DB.Create(&record).Error; err != nil {
+	if err := s.saveTicket(&record); err != nil {
+		if errors.Is(err, errCaptureUsed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save record"})
 		return
 	}
 
-	// Fix PDF Path for Frontend:
-	// The reporting package returns relative path like "web/static/reports/..."
-	// We need to strip "web" so it becomes "/static/reports/..."
-	webPath := "/" + strings.TrimPrefix(record.InvoicePath, "web/")
+	if record.ManualEntry {
+		s.audit(c, "manual_weight", record.ScaleID, record.ID,
+			fmt.Sprintf("ticket=%s gross=%.2f tare=%.2f reason=%s", ticket, gross, tare, record.ManualReason))
+	}
+	s.auditOverload(sessionUsername(c), record)
+	s.fireOutputs(record.ScaleID, outputs.EventSaved)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Transaction saved",
 		"ticket":  ticket,
-		"invoice": webPath,
+		"invoice": invoiceWebPath(record.InvoicePath),
+	})
+}
+
+// saveTicket generates the invoice of a completed single weighing and
+// saves the record, spending its capture token. It fails with
+// errCaptureUsed when the token was spent by another save.
+func (s *Server) saveTicket(record *models.WeighingRecord) error {
+	path, err := reporting.GenerateInvoice(*record)
+	if err == nil {
+		record.InvoicePath = path
+	} else {
+		fmt.Printf("Error generating PDF: %v\n", err)
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimCapture(tx, record.CaptureID); err != nil {
+			return err
+		}
+		return tx.Create(record).Error
 	})
 }
 
+// invoiceWebPath fixes the PDF path for the frontend:
+// the reporting package returns a relative path like "web/static/reports/..."
+// and we need to strip "web" so it becomes "/static/reports/..."
+func invoiceWebPath(path string) string {
+	return "/" + strings.TrimPrefix(path, "web/")
+}
+
 // TriggerANPR captures a frame and detects license plate
 func (s *Server) TriggerANPR(c *gin.Context) {
 	scaleID := c.Query("scale_id")
@@ -204,37 +366,52 @@ func (s *Server) TriggerANPR(c *gin.Context) {
 				cameraURL = cam.RTSPURL
 			}
 		}
-	} else if scaleID != "" {
+	} else if id, err := strconv.Atoi(scaleID); err == nil {
 		// Priority 2: Fallback to first camera of station (Legacy/Default)
-		var station models.WeighingStation
-		if err := s.DB.Preload("Cameras").First(&station, scaleID).Error; err == nil {
-			if len(station.Cameras) > 0 {
-				cameraURL = station.Cameras[0].RTSPURL
-			} else if station.CameraURL != "" {
-				cameraURL = station.CameraURL
-			}
+		if url := s.stationCamera(uint(id)); url != "" {
+			cameraURL = url
 		}
 	}
 
 	plate, snapshotPath, err := s.ANPRService.CaptureAndDetect(cameraURL)
 	if err != nil {
 		// Fallback for demo/simulation if no camera
+		open, _ := s.findOpenTickets("B 1234 DEMO")
 		c.JSON(http.StatusOK, gin.H{
-			"plate":    "B 1234 DEMO",
-			"snapshot": "/static/images/placeholder_truck.jpg",
-			"status":   "simulated",
+			"plate":        "B 1234 DEMO",
+			"snapshot":     "/static/images/placeholder_truck.jpg",
+			"status":       "simulated",
+			"open_tickets": open,
 		})
 		return
 	}
 
+	// Let the operator continue a two-pass weighing straight from the scan
+	open, _ := s.findOpenTickets(plate)
+
 	c.JSON(http.StatusOK, gin.H{
-		"plate":    plate,
-		"snapshot": snapshotPath,
-		"status":   "success",
+		"plate":        plate,
+		"snapshot":     snapshotPath,
+		"status":       "success",
+		"open_tickets": open,
 	})
 }
 
-// StreamScaleData sets up an SSE stream for real-time weights
+// stationCamera returns the stream of the first camera of a station, ""
+// when it has none
+func (s *Server) stationCamera(stationID uint) string {
+	var station models.WeighingStation
+	if err := s.DB.Preload("Cameras").First(&station, stationID).Error; err != nil {
+		return ""
+	}
+	if len(station.Cameras) > 0 {
+		return station.Cameras[0].RTSPURL
+	}
+	return station.CameraURL
+}
+
+// StreamScaleData sets up an SSE stream for real-time weights ("message"
+// events) and the cards and tags read at the stations ("tag" events)
 func (s *Server) StreamScaleData(c *gin.Context) {
 	session := sessions.Default(c)
 	uidVal := session.Get("user_id")
@@ -256,25 +433,58 @@ func (s *Server) StreamScaleData(c *gin.Context) {
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 
-	ticker := time.NewTicker(200 * time.Millisecond)
-	defer ticker.Stop()
+	events := s.ScaleMgr.Events.Subscribe(0)
+	defer events.Close()
+	tags := s.ScaleMgr.Tags.Subscribe(16)
+	defer tags.Close()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	// Last payload per scale, so only changes are pushed
+	last := make(map[uint]hardware.ScaleData)
+	send := func(data hardware.ScaleData) {
+		if role != "admin" && !allowedIDs[data.ScaleID] {
+			return
+		}
+		key := data
+		key.Timestamp = 0
+		if prev, ok := last[data.ScaleID]; ok && prev == key {
+			return
+		}
+		last[data.ScaleID] = key
+		c.SSEvent("message", data)
+	}
+
+	// Current state first, so the page does not wait for the next change
+	for _, data := range s.ScaleMgr.Snapshot() {
+		send(data)
+	}
+	c.Writer.Flush()
 
 	c.Stream(func(w io.Writer) bool {
-		if _, ok := <-ticker.C; ok {
-			s.ScaleMgr.Mu.Lock()
-			for id, scale := range s.ScaleMgr.Scales {
-				// Only send data if allowed
-				if role == "admin" || allowedIDs[id] {
-					c.SSEvent("message", gin.H{
-						"scale_id":  id,
-						"weight":    scale.LastWeight,
-						"connected": scale.Connected,
-					})
-				}
+		select {
+		case data, ok := <-events.C:
+			if !ok {
+				return false
 			}
-			s.ScaleMgr.Mu.Unlock()
+			send(data)
+			return true
+		case read, ok := <-tags.C:
+			if !ok {
+				return false
+			}
+			// Card or tag read: the page fills in the vehicle like a plate lookup
+			if role == "admin" || allowedIDs[read.ScaleID] {
+				c.SSEvent("tag", s.tagEvent(read))
+			}
+			return true
+		case <-keepalive.C:
+			// SSE comment, keeps proxies from closing an idle stream
+			fmt.Fprint(w, ": keepalive\n\n")
 			return true
+		case <-c.Request.Context().Done():
+			return false
 		}
-		return false
 	})
 }
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// === Scale health ===
+
+const (
+	uptimeWindow   = 24 * time.Hour  // Period the health page reports uptime for
+	healthSnapshot = 5 * time.Minute // How often the link quality is saved
+)
+
+// RecordScaleEvents persists the scale manager's health events and a
+// periodic snapshot of every station's link quality until stop is closed.
+// Events published before stop, such as the disconnects of
+// ScaleManager.Shutdown, are still saved. Run it in its own goroutine.
+func (s *Server) RecordScaleEvents(stop <-chan struct{}) {
+	events := s.ScaleMgr.HealthEvents.Subscribe(256)
+	defer events.Close()
+	snapshot := time.NewTicker(healthSnapshot)
+	defer snapshot.Stop()
+
+	save := func(e hardware.HealthEvent) {
+		event := models.ScaleEvent{StationID: e.ScaleID, Kind: e.Kind, Detail: e.Detail, At: e.At}
+		if err := s.DB.Create(&event).Error; err != nil {
+			log.Printf("Failed to save scale event: %v", err)
+		}
+	}
+	last := make(map[uint]hardware.Health)
+	for {
+		select {
+		case <-stop:
+			for {
+				select {
+				case e := <-events.C:
+					save(e)
+				default:
+					return
+				}
+			}
+		case e := <-events.C:
+			save(e)
+		case now := <-snapshot.C:
+			if err := s.snapshotHealth(now, last); err != nil {
+				log.Printf("Failed to save scale health: %v", err)
+			}
+		}
+	}
+}
+
+// snapshotHealth saves the link quality of every station. last holds the
+// counters of each station's previous snapshot and is updated; counters
+// that went back (the station was removed and added again) start over.
+func (s *Server) snapshotHealth(now time.Time, last map[uint]hardware.Health) error {
+	var snapshots []models.ScaleHealthSnapshot
+	for _, h := range s.ScaleMgr.Health() {
+		period := h
+		if prev, ok := last[h.ScaleID]; ok && prev.Frames <= h.Frames && prev.ParseErrors <= h.ParseErrors {
+			period.Frames -= prev.Frames
+			period.ParseErrors -= prev.ParseErrors
+		}
+		last[h.ScaleID] = h
+
+		snap := models.ScaleHealthSnapshot{
+			StationID:   h.ScaleID,
+			At:          now,
+			Connected:   h.Connected,
+			Frames:      h.Frames,
+			ParseErrors: h.ParseErrors,
+			ErrorRate:   period.ErrorRate(),
+		}
+		if !h.LastFrameAt.IsZero() {
+			lastFrame := h.LastFrameAt
+			snap.LastFrameAt = &lastFrame
+		}
+		snapshots = append(snapshots, snap)
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+	return s.DB.Create(&snapshots).Error
+}
+
+// stationHealth is one station on the health page
+type stationHealth struct {
+	hardware.Health
+	Name      string  `json:"name"`
+	ErrorRate float64 `json:"error_rate"` // Rejected frames, 0..1
+	Uptime    float64 `json:"uptime"`     // Share of uptimeWindow connected, 0..1
+}
+
+// uptime returns the share of from..to a station was connected, given its
+// connect/disconnect events in that period (oldest first) and whether it
+// was connected at from
+func uptime(events []models.ScaleEvent, connected bool, from, to time.Time) float64 {
+	if !to.After(from) {
+		return 0
+	}
+	var up time.Duration
+	since := from
+	for _, e := range events {
+		switch e.Kind {
+		case hardware.HealthConnected:
+			if !connected {
+				connected, since = true, e.At
+			}
+		case hardware.HealthDisconnected:
+			if connected {
+				up += e.At.Sub(since)
+				connected = false
+			}
+		}
+	}
+	if connected {
+		up += to.Sub(since)
+	}
+	return float64(up) / float64(to.Sub(from))
+}
+
+// stationUptime computes a station's uptime over the last uptimeWindow
+// from the persisted events
+func (s *Server) stationUptime(stationID uint, now time.Time) float64 {
+	from := now.Add(-uptimeWindow)
+	links := []string{hardware.HealthConnected, hardware.HealthDisconnected}
+
+	// Where the link stood when the window opened
+	var before models.ScaleEvent
+	connected := s.DB.Where("station_id = ? AND kind IN ? AND at < ?", stationID, links, from).
+		Order("at desc").First(&before).Error == nil && before.Kind == hardware.HealthConnected
+
+	var events []models.ScaleEvent
+	s.DB.Where("station_id = ? AND kind IN ? AND at >= ?", stationID, links, from).Order("at").Find(&events)
+	return uptime(events, connected, from, now)
+}
+
+// GetScaleHealth returns frame counters, alerts and 24h uptime per station
+func (s *Server) GetScaleHealth(c *gin.Context) {
+	var stations []models.WeighingStation
+	s.DB.Find(&stations)
+	names := make(map[uint]string, len(stations))
+	for _, st := range stations {
+		names[st.ID] = st.Name
+	}
+
+	now := time.Now()
+	out := []stationHealth{}
+	for _, h := range s.ScaleMgr.Health() {
+		out = append(out, stationHealth{
+			Health:    h,
+			Name:      names[h.ScaleID],
+			ErrorRate: h.ErrorRate(),
+			Uptime:    s.stationUptime(h.ScaleID, now),
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GetScaleEvents returns the latest health events, optionally of one station
+func (s *Server) GetScaleEvents(c *gin.Context) {
+	query := s.DB.Order("at desc").Limit(200)
+	if id, err := strconv.Atoi(c.Query("scale_id")); err == nil {
+		query = query.Where("station_id = ?", id)
+	}
+	if c.Query("alerts") == "true" {
+		query = query.Where("kind IN ?", []string{hardware.HealthSilent, hardware.HealthStuck})
+	}
+
+	var events []models.ScaleEvent
+	if err := query.Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scale events"})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// GetScaleHealthHistory returns the health snapshots of a station over the
+// last uptimeWindow, oldest first
+func (s *Server) GetScaleHealthHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	snapshots := []models.ScaleHealthSnapshot{}
+	err = s.DB.Where("station_id = ? AND at >= ?", id, time.Now().Add(-uptimeWindow)).Order("at").Find(&snapshots).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scale health"})
+		return
+	}
+	c.JSON(http.StatusOK, snapshots)
+}
+
+// ShowHealth renders the scale health page
+func (s *Server) ShowHealth(c *gin.Context) {
+	session := sessions.Default(c)
+	fullName := "Operator"
+	if v := session.Get("full_name"); v != nil {
+		fullName = v.(string)
+	}
+
+	c.HTML(http.StatusOK, "health.html", gin.H{
+		"title":       "Kesehatan Timbangan",
+		"active":      "settings",
+		"showNav":     true,
+		"CurrentUser": fullName,
+	})
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"stoneweigh/internal/kiosk"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/outputs"
+	"stoneweigh/internal/pkg/capture"
+	"stoneweigh/internal/pkg/odol"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	csrf "github.com/utrack/gin-csrf"
+	"gorm.io/gorm"
+)
+
+// === Unattended kiosk weighing ===
+
+// printTimeout bounds a print job of a kiosk ticket
+const printTimeout = 30 * time.Second
+
+// reloadKiosk applies the saved kiosk stations to the controller
+func (s *Server) reloadKiosk() {
+	if err := s.Kiosk.Load(s.DB); err != nil {
+		log.Printf("Error loading kiosk stations: %v", err)
+	}
+}
+
+// kioskBackend books, prints and audits for the kiosk controller
+type kioskBackend struct {
+	s *Server
+}
+
+func (b kioskBackend) Lookup(id kiosk.Identity) (string, error) {
+	var vehicle models.Vehicle
+	var err error
+	if id.Source == kiosk.SourceTag {
+		vehicle, err = b.s.vehicleByTag(id.Value)
+	} else {
+		err = b.s.DB.Where("REPLACE(UPPER(plate_number), ' ', '') = ?", normalizePlate(id.Value)).First(&vehicle).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", kiosk.ErrUnknownVehicle
+	}
+	return vehicle.PlateNumber, err
+}
+
+func (b kioskBackend) Recognize(stationID uint) (string, error) {
+	url := b.s.stationCamera(stationID)
+	if b.s.ANPRService == nil || url == "" {
+		return "", nil
+	}
+	plate, _, err := b.s.ANPRService.CaptureAndDetect(url)
+	return plate, err
+}
+
+// Book completes the open ticket of the vehicle, or opens a new one. A
+// "single" station completes it at once against a valid stored tare; one
+// without falls back to two passes, so the exit pass re-tares the vehicle.
+func (b kioskBackend) Book(req kiosk.Booking) (kiosk.Ticket, error) {
+	s := b.s
+	var station models.WeighingStation
+	if err := s.DB.First(&station, req.StationID).Error; err != nil {
+		return kiosk.Ticket{}, err
+	}
+	var vehicle models.Vehicle
+	s.DB.Where("REPLACE(UPPER(plate_number), ' ', '') = ?", normalizePlate(req.Plate)).First(&vehicle)
+
+	now := time.Now()
+	_, capt, err := s.Captures.Issue(capture.Capture{
+		ScaleID:    req.StationID,
+		Weight:     req.Reading.SettledWeight,
+		Unit:       req.Reading.Unit,
+		Stable:     true,
+		CapturedBy: kiosk.Operator,
+	}, now)
+	if err != nil {
+		return kiosk.Ticket{}, err
+	}
+	unit, division := s.stationUnit(req.StationID)
+	weight := resolvedWeight{
+		Weight:     capt.Weight,
+		CaptureID:  capt.ID,
+		CapturedAt: time.Unix(capt.CapturedAt, 0),
+		Unit:       unit,
+		Division:   division,
+	}
+
+	open, err := s.findOpenTickets(req.Plate)
+	if err != nil {
+		return kiosk.Ticket{}, err
+	}
+	if len(open) > 0 {
+		record := open[0]
+		weighSecond(&record, weight, now)
+		if err := b.checkOverload(&record, req.ApprovedBy); err != nil {
+			return kiosk.Ticket{}, err
+		}
+		if err := s.completeTicket(&record, req.StationID, weight, kiosk.Operator); err != nil {
+			return kiosk.Ticket{}, err
+		}
+		s.auditOverload(kiosk.Operator, record)
+		return kioskTicket(record), nil
+	}
+
+	record := models.WeighingRecord{
+		ScaleID:     req.StationID,
+		PlateNumber: req.Plate,
+		DriverName:  vehicle.DriverName,
+		CompanyName: vehicle.OwnerCompany,
+		ManagerName: kiosk.Operator,
+	}
+	if req.DriverName != "" {
+		record.DriverName = req.DriverName
+	}
+	if record.DriverName == "" {
+		// A vehicle named by a supervisor but not in the vehicle master
+		return kiosk.Ticket{}, &kiosk.Problem{Reason: kiosk.ReasonUnregistered,
+			Message: fmt.Sprintf("Kendaraan %s belum terdaftar, tetapkan nopol beserta nama sopirnya", req.Plate)}
+	}
+	if station.KioskMode == kiosk.ModeSingle {
+		tare, err := s.storedTare(req.Plate, now)
+		if err == nil {
+			record.GrossWeight = weight.Weight
+			record.TareWeight = tare
+			record.NetWeight = weight.Weight - tare
+			record.Unit, record.Division = weight.Unit, weight.Division
+			record.Status = models.StatusCompleted
+			record.CaptureID = weight.CaptureID
+			record.WeighedAt = now
+			record.Curves = []models.WeightCurve{weightCurve(req.StationID, 1, weight)}
+			if err := b.checkOverload(&record, req.ApprovedBy); err != nil {
+				return kiosk.Ticket{}, err
+			}
+			if err := s.saveTicket(&record); err != nil {
+				return kiosk.Ticket{}, err
+			}
+			s.auditOverload(kiosk.Operator, record)
+			return kioskTicket(record), nil
+		}
+		s.auditAs(kiosk.Operator, "kiosk_two_pass_fallback", req.StationID, 0,
+			fmt.Sprintf("plate=%s: %v", req.Plate, err))
+	}
+	if err := s.openTicket(&record, weight); err != nil {
+		return kiosk.Ticket{}, err
+	}
+	return kioskTicket(record), nil
+}
+
+// checkOverload is checkOverload without a request: the supervisor
+// approval comes from the resolved escalation
+func (b kioskBackend) checkOverload(record *models.WeighingRecord, approvedBy string) error {
+	switch b.s.assessOverload(record) {
+	case odol.Blocked:
+		b.s.auditAs(kiosk.Operator, "overload_blocked", record.ScaleID, record.ID,
+			fmt.Sprintf("plate=%s gross=%.2f jbi=%.2f overload=%.2f%%", record.PlateNumber, record.GrossWeight, record.PermittedGross, record.OverloadPercent))
+		return &kiosk.Problem{Reason: kiosk.ReasonBlocked,
+			Message: fmt.Sprintf("Muatan %.2f%% di atas JBI %.0f kg, kendaraan tidak boleh keluar", record.OverloadPercent, record.PermittedGross)}
+	case odol.NeedsApproval:
+		if approvedBy == "" {
+			return &kiosk.Problem{Reason: kiosk.ReasonOverload,
+				Message: fmt.Sprintf("Muatan %.2f%% di atas JBI %.0f kg, perlu persetujuan supervisor", record.OverloadPercent, record.PermittedGross)}
+		}
+		record.OverloadApprovedBy = approvedBy
+	}
+	return nil
+}
+
+func kioskTicket(record models.WeighingRecord) kiosk.Ticket {
+	t := kiosk.Ticket{RecordID: record.ID, Number: record.TicketNumber, Status: record.Status, Weight: record.FirstWeight, Invoice: record.InvoicePath}
+	if record.Status == models.StatusCompleted {
+		t.Weight = record.NetWeight
+	}
+	return t
+}
+
+// Print sends the invoice of a completed ticket to the station printer.
+// An entry weighing has no invoice yet, it is printed on exit.
+func (b kioskBackend) Print(stationID uint, t kiosk.Ticket) error {
+	if t.Invoice == "" {
+		return nil
+	}
+	var station models.WeighingStation
+	if err := b.s.DB.Select("kiosk_printer").First(&station, stationID).Error; err != nil || station.KioskPrinter == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), printTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, b.s.KioskPrintCommand, "-d", station.KioskPrinter, t.Invoice).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (b kioskBackend) OpenGate(stationID uint) {
+	b.s.fireOutputs(stationID, outputs.EventSaved)
+}
+
+func (b kioskBackend) Audit(username, action string, stationID, recordID uint, detail string) {
+	b.s.auditAs(username, action, stationID, recordID, detail)
+}
+
+// Notify posts the escalation to KioskWebhook, for chat or paging
+// integrations of the remote supervisors
+func (b kioskBackend) Notify(e kiosk.Escalation) {
+	if b.s.KioskWebhook == "" {
+		return
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	go func() {
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Post(b.s.KioskWebhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Kiosk webhook: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Kiosk webhook: %s", resp.Status)
+		}
+	}()
+}
+
+// GetKioskStatus lists the kiosk stations with their state and escalation
+func (s *Server) GetKioskStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Kiosk.Status())
+}
+
+// ResolveKiosk answers the escalation of a kiosk station. The supervisor is
+// recorded as the approver.
+func (s *Server) ResolveKiosk(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var input kiosk.Resolution
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.By = sessionUsername(c)
+
+	err = s.Kiosk.Resolve(uint(id), input, time.Now())
+	switch {
+	case errors.Is(err, kiosk.ErrNotKioskStation):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, kiosk.ErrNotEscalated):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Eskalasi diselesaikan"})
+	}
+}
+
+// ShowKiosk renders the supervisor console of the kiosk stations
+func (s *Server) ShowKiosk(c *gin.Context) {
+	session := sessions.Default(c)
+	fullName := "Operator"
+	if v := session.Get("full_name"); v != nil {
+		fullName = v.(string)
+	}
+
+	c.HTML(http.StatusOK, "kiosk.html", gin.H{
+		"title":       "Kiosk",
+		"active":      "kiosk",
+		"showNav":     true,
+		"CurrentUser": fullName,
+		"csrf_token":  csrf.GetToken(c),
+	})
+}
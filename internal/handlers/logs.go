@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"os"
 
+	"stoneweigh/internal/models"
+
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
@@ -46,3 +48,18 @@ func (s *Server) GetLogsAPI(c *gin.Context) {
 
 	c.JSON(http.StatusOK, lines[start:])
 }
+
+// GetAuditLogsAPI returns the latest audit entries, optionally filtered by action
+func (s *Server) GetAuditLogsAPI(c *gin.Context) {
+	query := s.DB.Order("created_at desc").Limit(200)
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var entries []models.AuditLog
+	if err := query.Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -32,11 +33,16 @@ func (s *Server) ShowVehicleSettings(c *gin.Context) {
 // ListVehicles API returns all registered vehicles
 func (s *Server) ListVehicles(c *gin.Context) {
 	var vehicles []models.Vehicle
-	if err := s.DB.Find(&vehicles).Error; err != nil {
+	if err := s.DB.Preload("Tags").Find(&vehicles).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vehicles"})
 		return
 	}
-	c.JSON(http.StatusOK, vehicles)
+	now := time.Now()
+	views := make([]vehicleView, 0, len(vehicles))
+	for _, v := range vehicles {
+		views = append(views, s.vehicleView(v, now))
+	}
+	c.JSON(http.StatusOK, views)
 }
 
 // CreateVehicle API adds a new vehicle
@@ -46,6 +52,10 @@ func (s *Server) CreateVehicle(c *gin.Context) {
 		DriverName   string  `json:"driver_name" binding:"required"`
 		DefaultTare  float64 `json:"default_tare"`
 		OwnerCompany string  `json:"owner_company"`
+
+		VehicleClass   string  `json:"vehicle_class"`
+		AxleConfig     string  `json:"axle_config"`
+		PermittedGross float64 `json:"permitted_gross"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -56,8 +66,15 @@ func (s *Server) CreateVehicle(c *gin.Context) {
 	vehicle := models.Vehicle{
 		PlateNumber:  input.PlateNumber,
 		DriverName:   input.DriverName,
-		DefaultTare:  input.DefaultTare,
 		OwnerCompany: input.OwnerCompany,
+
+		VehicleClass:   strings.TrimSpace(input.VehicleClass),
+		AxleConfig:     strings.TrimSpace(input.AxleConfig),
+		PermittedGross: input.PermittedGross,
+	}
+	if vehicle.PermittedGross < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JBI tidak boleh negatif"})
+		return
 	}
 
 	if err := s.DB.Create(&vehicle).Error; err != nil {
@@ -65,6 +82,13 @@ func (s *Server) CreateVehicle(c *gin.Context) {
 		return
 	}
 
+	// A typed tare starts the tare history like any other measurement
+	if input.DefaultTare > 0 {
+		if _, err := s.recordTare(sessionUsername(c), &vehicle, models.TareRecord{Weight: input.DefaultTare, Source: models.TareSourceManual}); err != nil {
+			log.Printf("Error saving tare of %s: %v", vehicle.PlateNumber, err)
+		}
+	}
+
 	c.JSON(http.StatusCreated, vehicle)
 }
 
@@ -81,13 +105,25 @@ func (s *Server) DeleteVehicle(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vehicle"})
 		return
 	}
+	// Its cards may be handed to another vehicle
+	s.DB.Unscoped().Where("vehicle_id = ?", id).Delete(&models.VehicleTag{})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Vehicle deleted"})
 }
 
-// GetVehicleDetails returns details for a specific plate (public for operators)
+// GetVehicleDetails returns details for a specific plate, or for the card
+// or tag given as ?tag= (public for operators)
 func (s *Server) GetVehicleDetails(c *gin.Context) {
 	plate := c.Query("plate")
+	if tag := c.Query("tag"); tag != "" && plate == "" {
+		vehicle, err := s.vehicleByTag(tag)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+			return
+		}
+		c.JSON(http.StatusOK, s.vehicleView(vehicle, time.Now()))
+		return
+	}
 	if plate == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Plate number required"})
 		return
@@ -99,7 +135,7 @@ func (s *Server) GetVehicleDetails(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, vehicle)
+	c.JSON(http.StatusOK, s.vehicleView(vehicle, time.Now()))
 }
 
 // SearchVehicles performs a fuzzy search for autocomplete
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/outputs"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	csrf "github.com/utrack/gin-csrf"
+)
+
+// === Relay outputs: barrier gates and traffic lights ===
+
+// reloadOutputs applies the saved devices and rules to the controller
+func (s *Server) reloadOutputs() {
+	if err := s.Outputs.Load(s.DB); err != nil {
+		log.Printf("Error loading output devices: %v", err)
+	}
+}
+
+// fireOutputs runs the rules bound to a station event without holding up
+// the request on relay I/O
+func (s *Server) fireOutputs(stationID uint, event string) {
+	go s.Outputs.Fire(stationID, event)
+}
+
+func (s *Server) ListOutputDevices(c *gin.Context) {
+	var devices []models.OutputDevice
+	if err := s.DB.Order("id").Find(&devices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch output devices"})
+		return
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+func (s *Server) CreateOutputDevice(c *gin.Context) {
+	var input models.OutputDevice
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.ID = 0
+	if _, err := outputs.NewDriver(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Konfigurasi perangkat output tidak valid: " + err.Error()})
+		return
+	}
+	if err := s.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create output device"})
+		return
+	}
+	s.reloadOutputs()
+	c.JSON(http.StatusOK, input)
+}
+
+func (s *Server) UpdateOutputDevice(c *gin.Context) {
+	var device models.OutputDevice
+	if err := s.DB.First(&device, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Output device not found"})
+		return
+	}
+	var input models.OutputDevice
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device.Name = input.Name
+	device.Driver = input.Driver
+	device.Address = input.Address
+	device.BaudRate = input.BaudRate
+	device.UnitID = input.UnitID
+	device.Enabled = input.Enabled
+	if _, err := outputs.NewDriver(device); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Konfigurasi perangkat output tidak valid: " + err.Error()})
+		return
+	}
+	if err := s.DB.Save(&device).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update output device"})
+		return
+	}
+	s.reloadOutputs()
+	c.JSON(http.StatusOK, device)
+}
+
+// DeleteOutputDevice removes a device together with its rules
+func (s *Server) DeleteOutputDevice(c *gin.Context) {
+	id := c.Param("id")
+	if err := s.DB.Where("device_id = ?", id).Delete(&models.OutputRule{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete output rules"})
+		return
+	}
+	if err := s.DB.Delete(&models.OutputDevice{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete output device"})
+		return
+	}
+	s.reloadOutputs()
+	c.JSON(http.StatusOK, gin.H{"message": "Output device deleted"})
+}
+
+func (s *Server) ListOutputRules(c *gin.Context) {
+	var rules []models.OutputRule
+	if err := s.DB.Order("station_id, id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch output rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (s *Server) CreateOutputRule(c *gin.Context) {
+	var input models.OutputRule
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.ID = 0
+	if err := outputs.ValidateRule(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Aturan output tidak valid: " + err.Error()})
+		return
+	}
+	if s.DB.First(&models.WeighingStation{}, input.StationID).Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Stasiun %d tidak ditemukan", input.StationID)})
+		return
+	}
+	if s.DB.First(&models.OutputDevice{}, input.DeviceID).Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Perangkat output %d tidak ditemukan", input.DeviceID)})
+		return
+	}
+	if err := s.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create output rule"})
+		return
+	}
+	s.reloadOutputs()
+	c.JSON(http.StatusOK, input)
+}
+
+func (s *Server) DeleteOutputRule(c *gin.Context) {
+	if err := s.DB.Delete(&models.OutputRule{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete output rule"})
+		return
+	}
+	s.reloadOutputs()
+	c.JSON(http.StatusOK, gin.H{"message": "Output rule deleted"})
+}
+
+// GetOutputStatus lists the enabled devices with their channel states and
+// last error
+func (s *Server) GetOutputStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Outputs.Status())
+}
+
+// SwitchOutput switches a channel by hand, to test the wiring or open the
+// gate for a vehicle the rules do not cover. Audited.
+func (s *Server) SwitchOutput(c *gin.Context) {
+	var device models.OutputDevice
+	if err := s.DB.First(&device, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Output device not found"})
+		return
+	}
+	var input struct {
+		Channel int    `json:"channel"`
+		Action  string `json:"action"`
+		PulseMs int    `json:"pulse_ms"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Channel < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Channel tidak valid"})
+		return
+	}
+	if !device.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Perangkat output tidak aktif"})
+		return
+	}
+
+	err := s.Outputs.Switch(device.ID, input.Channel, input.Action, time.Duration(input.PulseMs)*time.Millisecond)
+	s.audit(c, "output_switch", 0, 0, fmt.Sprintf("device=%d (%s) channel=%d action=%s error=%v",
+		device.ID, device.Name, input.Channel, input.Action, err))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Gagal mengirim perintah: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// ShowOutputs renders the barrier gate and traffic light settings
+func (s *Server) ShowOutputs(c *gin.Context) {
+	session := sessions.Default(c)
+	fullName := "Operator"
+	if v := session.Get("full_name"); v != nil {
+		fullName = v.(string)
+	}
+
+	var stations []models.WeighingStation
+	s.DB.Order("id").Find(&stations)
+
+	c.HTML(http.StatusOK, "settings_outputs.html", gin.H{
+		"title":       "Gerbang & Lampu",
+		"active":      "settings",
+		"showNav":     true,
+		"CurrentUser": fullName,
+		"csrf_token":  csrf.GetToken(c),
+		"Stations":    stations,
+	})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/odol"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// === Overload (ODOL) enforcement ===
+
+// overloadApproval is the supervisor sign-off sent along with a ticket
+// whose gross weight is above the approval threshold
+type overloadApproval struct {
+	SupervisorUsername string `json:"supervisor_username"`
+	SupervisorPassword string `json:"supervisor_password"`
+}
+
+// checkOverload compares the record's gross weight with the permitted gross
+// weight of its vehicle and fills in the overload fields. It writes the
+// error response itself and returns false when the ticket must not be saved.
+func (s *Server) checkOverload(c *gin.Context, record *models.WeighingRecord, approval overloadApproval) bool {
+	switch s.assessOverload(record) {
+	case odol.Blocked:
+		s.audit(c, "overload_blocked", record.ScaleID, record.ID,
+			fmt.Sprintf("plate=%s gross=%.2f jbi=%.2f overload=%.2f%%", record.PlateNumber, record.GrossWeight, record.PermittedGross, record.OverloadPercent))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":            fmt.Sprintf("Muatan %.2f%% di atas JBI %.0f kg, kendaraan tidak boleh keluar", record.OverloadPercent, record.PermittedGross),
+			"overload_percent": record.OverloadPercent,
+			"permitted_gross":  record.PermittedGross,
+		})
+		return false
+	case odol.NeedsApproval:
+		if approval.SupervisorUsername == "" {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":             fmt.Sprintf("Muatan %.2f%% di atas JBI %.0f kg, perlu persetujuan supervisor", record.OverloadPercent, record.PermittedGross),
+				"approval_required": true,
+				"overload_percent":  record.OverloadPercent,
+				"permitted_gross":   record.PermittedGross,
+			})
+			return false
+		}
+		supervisor, ok := s.verifySupervisor(approval)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Persetujuan supervisor tidak valid"})
+			return false
+		}
+		record.OverloadApprovedBy = supervisor
+	}
+	return true
+}
+
+// assessOverload fills in the permitted gross weight of the record's
+// vehicle and its overload, and returns the verdict of the overload policy.
+// Unregistered vehicles have no known limit and are allowed.
+func (s *Server) assessOverload(record *models.WeighingRecord) odol.Verdict {
+	var vehicle models.Vehicle
+	if err := s.DB.Where("REPLACE(UPPER(plate_number), ' ', '') = ?", normalizePlate(record.PlateNumber)).First(&vehicle).Error; err != nil {
+		return odol.Allowed
+	}
+	record.PermittedGross = vehicle.PermittedGross
+	record.OverloadPercent = odol.Percent(record.GrossWeight, vehicle.PermittedGross)
+	return s.Overload.Check(record.OverloadPercent)
+}
+
+// verifySupervisor checks the credentials of an approving supervisor or
+// admin and returns their username
+func (s *Server) verifySupervisor(approval overloadApproval) (string, bool) {
+	var user models.User
+	if err := s.DB.Where("username = ? AND role IN ?", approval.SupervisorUsername, []string{"supervisor", "admin"}).First(&user).Error; err != nil {
+		return "", false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(approval.SupervisorPassword)); err != nil {
+		return "", false
+	}
+	return user.Username, true
+}
+
+// auditOverload records a supervisor approval once the ticket is saved
+func (s *Server) auditOverload(username string, record models.WeighingRecord) {
+	if record.OverloadApprovedBy == "" {
+		return
+	}
+	s.auditAs(username, "overload_approved", record.ScaleID, record.ID,
+		fmt.Sprintf("ticket=%s gross=%.2f jbi=%.2f overload=%.2f%% supervisor=%s",
+			record.TicketNumber, record.GrossWeight, record.PermittedGross, record.OverloadPercent, record.OverloadApprovedBy))
+}
+
+// overloadOffender aggregates the overloaded tickets of one company and driver
+type overloadOffender struct {
+	CompanyName string  `json:"company_name"`
+	DriverName  string  `json:"driver_name"`
+	Tickets     int64   `json:"tickets"`
+	MaxPercent  float64 `json:"max_percent"`
+	AvgPercent  float64 `json:"avg_percent"`
+	Excess      float64 `json:"excess"` // Sum of the kg above JBI
+}
+
+// ShowOverloadReport lists the overloaded tickets of a period and the
+// offending companies and drivers, worst first
+func (s *Server) ShowOverloadReport(c *gin.Context) {
+	session := sessions.Default(c)
+	fullName := "Operator"
+	if v := session.Get("full_name"); v != nil {
+		fullName = v.(string)
+	}
+
+	start, end := reportRange(c)
+
+	var offenders []overloadOffender
+	s.DB.Model(&models.WeighingRecord{}).
+		Select("company_name, driver_name, COUNT(*) as tickets, MAX(overload_percent) as max_percent, "+
+			"AVG(overload_percent) as avg_percent, SUM(gross_weight - permitted_gross) as excess").
+		Where("overload_percent > 0 AND weighed_at BETWEEN ? AND ?", start, end).
+		Group("company_name, driver_name").
+		Order("tickets desc, max_percent desc").
+		Scan(&offenders)
+
+	var records []models.WeighingRecord
+	s.DB.Where("overload_percent > 0 AND weighed_at BETWEEN ? AND ?", start, end).
+		Order("overload_percent desc").Find(&records)
+
+	c.HTML(http.StatusOK, "reports_overload.html", gin.H{
+		"title":       "Laporan Kelebihan Muatan",
+		"active":      "reports",
+		"showNav":     true,
+		"CurrentUser": fullName,
+		"Offenders":   offenders,
+		"Records":     records,
+		"Policy":      s.Overload,
+		"StartDate":   start.Format("2006-01-02"),
+		"EndDate":     end.Format("2006-01-02"),
+	})
+}
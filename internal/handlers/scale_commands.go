@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"stoneweigh/internal/hardware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScaleCommand sends zero/tare/print to a station's indicator and waits
+// for the following frames to confirm it. Every attempt is audited.
+func (s *Server) ScaleCommand(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	stationID := uint(id)
+
+	var input struct {
+		Command string `json:"command" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cmd, err := hardware.ParseCommand(input.Command)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !s.canOperate(c, stationID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Anda tidak memiliki akses ke stasiun ini"})
+		return
+	}
+
+	data, err := s.ScaleMgr.SendCommand(stationID, cmd, hardware.DefaultCommandTimeout)
+	action := "scale_" + string(cmd)
+	switch {
+	case err == nil:
+		s.audit(c, action, stationID, 0, fmt.Sprintf("confirmed weight=%.2f mode=%s", data.Weight, data.Mode))
+		c.JSON(http.StatusOK, gin.H{"message": "Perintah dikonfirmasi indikator", "data": data})
+	case errors.Is(err, hardware.ErrNotConfirmed):
+		s.audit(c, action, stationID, 0, fmt.Sprintf("not confirmed, last weight=%.2f", data.Weight))
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Indikator tidak mengkonfirmasi perintah", "data": data})
+	case errors.Is(err, hardware.ErrNotConnected):
+		s.audit(c, action, stationID, 0, "not sent, scale not connected")
+		c.JSON(http.StatusConflict, gin.H{"error": "Timbangan tidak terhubung"})
+	case errors.Is(err, hardware.ErrCommandUnsupported):
+		s.audit(c, action, stationID, 0, "not sent, protocol has no commands")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Protokol indikator ini tidak mendukung perintah"})
+	default:
+		s.audit(c, action, stationID, 0, "write failed: "+err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Gagal mengirim perintah: " + err.Error()})
+	}
+}
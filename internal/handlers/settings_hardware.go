@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
+
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/kiosk"
 	"stoneweigh/internal/models"
 
 	"github.com/gin-contrib/sessions"
@@ -29,13 +34,18 @@ func (s *Server) CreateStation(c *gin.Context) {
 		return
 	}
 
+	if err := s.validateStation(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Konfigurasi hardware tidak valid: " + err.Error()})
+		return
+	}
+
 	if err := s.DB.Create(&input).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create station"})
 		return
 	}
 
 	// Reload hardware manager to apply changes
-	go s.ScaleMgr.ReloadConfig(s.DB)
+	go s.reloadStations()
 
 	c.JSON(http.StatusOK, input)
 }
@@ -58,9 +68,51 @@ func (s *Server) UpdateStation(c *gin.Context) {
 	station.Name = input.Name
 	station.ScalePort = input.ScalePort
 	station.BaudRate = input.BaudRate
+	station.DataBits = input.DataBits
+	station.Parity = input.Parity
+	station.StopBits = input.StopBits
+	station.FlowControl = input.FlowControl
+	station.Terminator = input.Terminator
+	station.RecordRaw = input.RecordRaw
+	station.SimScenario = input.SimScenario
+	station.Protocol = input.Protocol
+	station.ProtocolPattern = input.ProtocolPattern
+	station.ModbusUnitID = input.ModbusUnitID
+	station.ModbusRegister = input.ModbusRegister
+	station.ModbusDataType = input.ModbusDataType
+	station.ModbusWordOrder = input.ModbusWordOrder
+	station.ModbusScale = input.ModbusScale
+	station.PollIntervalMs = input.PollIntervalMs
+	station.Unit = input.Unit
+	station.Division = input.Division
+	station.StableWindowMs = input.StableWindowMs
+	station.StableTolerance = input.StableTolerance
+	station.RequireStable = input.RequireStable
+	station.AxleMode = input.AxleMode
+	station.Summing = input.Summing
+	station.SumStationID = input.SumStationID
+	station.AxleTimeoutMs = input.AxleTimeoutMs
+	station.AxleMinWeight = input.AxleMinWeight
+	station.AllowManualEntry = input.AllowManualEntry
+	station.ReaderProtocol = input.ReaderProtocol
+	station.ReaderPort = input.ReaderPort
+	station.ReaderBaudRate = input.ReaderBaudRate
+	station.SensorProtocol = input.SensorProtocol
+	station.SensorPort = input.SensorPort
+	station.SensorBaudRate = input.SensorBaudRate
+	station.SensorUnitID = input.SensorUnitID
+	station.SensorInputs = input.SensorInputs
+	station.SensorNormallyClosed = input.SensorNormallyClosed
+	station.KioskMode = input.KioskMode
+	station.KioskPrinter = input.KioskPrinter
 	station.Enabled = input.Enabled
 	station.Token = input.Token
 
+	if err := s.validateStation(station); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Konfigurasi hardware tidak valid: " + err.Error()})
+		return
+	}
+
 	// Handle Cameras update
 	// 1. Delete existing cameras
 	s.DB.Where("weighing_station_id = ?", station.ID).Delete(&models.StationCamera{})
@@ -72,11 +124,46 @@ func (s *Server) UpdateStation(c *gin.Context) {
 		return
 	}
 
-	go s.ScaleMgr.ReloadConfig(s.DB)
+	go s.reloadStations()
 
 	c.JSON(http.StatusOK, station)
 }
 
+// reloadStations applies the saved stations to the scales and the kiosk
+func (s *Server) reloadStations() {
+	s.ScaleMgr.ReloadConfig(s.DB)
+	s.reloadKiosk()
+}
+
+// validateStation checks the hardware settings, including the simulator
+// scenario, the summing station a deck belongs to and the kiosk mode
+func (s *Server) validateStation(station models.WeighingStation) error {
+	if err := hardware.ValidateStation(station); err != nil {
+		return err
+	}
+	if station.SumStationID != 0 {
+		var sum models.WeighingStation
+		if station.SumStationID == station.ID || s.DB.First(&sum, station.SumStationID).Error != nil || !sum.Summing {
+			return fmt.Errorf("stasiun penjumlah %d tidak ditemukan", station.SumStationID)
+		}
+	}
+	switch station.KioskMode {
+	case "":
+	case kiosk.ModeTwoPass, kiosk.ModeSingle:
+		if station.AxleMode || station.SumStationID != 0 {
+			return fmt.Errorf("mode kiosk tidak tersedia untuk stasiun per gandar atau deck")
+		}
+	default:
+		return fmt.Errorf("mode kiosk %q tidak dikenal", station.KioskMode)
+	}
+	if station.SimScenario != "" {
+		if _, err := hardware.LoadScenario(station.SimScenario, s.ScaleMgr.ScenarioDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *Server) DeleteStation(c *gin.Context) {
 	id := c.Param("id")
 	if err := s.DB.Delete(&models.WeighingStation{}, id).Error; err != nil {
@@ -84,7 +171,7 @@ func (s *Server) DeleteStation(c *gin.Context) {
 		return
 	}
 
-	go s.ScaleMgr.ReloadConfig(s.DB)
+	go s.reloadStations()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Station deleted"})
 }
@@ -106,5 +193,69 @@ func (s *Server) ShowSettingsHardware(c *gin.Context) {
 		"showNav":     true,
 		"CurrentUser": fullName,
 		"csrf_token":  csrf.GetToken(c),
+		"Scenarios":   hardware.BuiltinScenarios(),
+	})
+}
+
+// === Port discovery & diagnostics ===
+
+// ListSerialPorts lists the serial ports of the server with their USB VID/PID
+func (s *Server) ListSerialPorts(c *gin.Context) {
+	ports, err := s.ScaleMgr.ListPorts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membaca daftar port: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ports)
+}
+
+// DiagnosePort opens a port with the posted station settings for a few
+// seconds and streams every raw frame and its decoded reading as server-sent
+// events ("frame", then one "end"). Ports of running stations are refused.
+func (s *Server) DiagnosePort(c *gin.Context) {
+	var input struct {
+		models.WeighingStation
+		Seconds int `json:"seconds"` // Default 5
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if id, used := s.ScaleMgr.PortUser(input.ScalePort); used {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Port sedang dipakai stasiun #%d, nonaktifkan stasiun tersebut untuk diagnosa", id)})
+		return
+	}
+	if err := hardware.ValidateStation(input.WeighingStation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Konfigurasi hardware tidak valid: " + err.Error()})
+		return
+	}
+
+	duration := 5 * time.Second
+	if input.Seconds > 0 {
+		duration = min(time.Duration(input.Seconds)*time.Second, hardware.MaxDiagnoseDuration)
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), duration)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	frames, rejected := 0, 0
+	err := s.ScaleMgr.Diagnose(ctx, input.WeighingStation, func(f hardware.DiagFrame) {
+		frames++
+		if f.Error != "" {
+			rejected++
+		}
+		c.SSEvent("frame", f)
+		c.Writer.Flush()
 	})
+
+	end := gin.H{"frames": frames, "rejected": rejected}
+	if err != nil {
+		end["error"] = err.Error()
+	}
+	c.SSEvent("end", end)
+	c.Writer.Flush()
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// === RFID cards and UHF tags ===
+
+// vehicleByTag finds the vehicle a card or tag belongs to
+func (s *Server) vehicleByTag(tag string) (models.Vehicle, error) {
+	var vehicle models.Vehicle
+	tag, err := hardware.NormalizeTag(tag)
+	if err != nil {
+		return vehicle, err
+	}
+	var vt models.VehicleTag
+	if err := s.DB.Where("tag_id = ?", tag).First(&vt).Error; err != nil {
+		return vehicle, err
+	}
+	err = s.DB.First(&vehicle, vt.VehicleID).Error
+	return vehicle, err
+}
+
+// tagEvent is a tag read pushed to the weighing page, with the vehicle it
+// identifies (nil for an unknown tag)
+type tagEvent struct {
+	hardware.TagRead
+	Vehicle *vehicleView `json:"vehicle"`
+}
+
+func (s *Server) tagEvent(read hardware.TagRead) tagEvent {
+	ev := tagEvent{TagRead: read}
+	if vehicle, err := s.vehicleByTag(read.Tag); err == nil {
+		view := s.vehicleView(vehicle, read.At)
+		ev.Vehicle = &view
+	}
+	return ev
+}
+
+// AddVehicleTag registers a card or tag for a vehicle. A tag identifies
+// one vehicle only.
+func (s *Server) AddVehicleTag(c *gin.Context) {
+	var vehicle models.Vehicle
+	if err := s.DB.First(&vehicle, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+		return
+	}
+	var input struct {
+		TagID string `json:"tag_id" binding:"required"`
+		Label string `json:"label"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tagID, err := hardware.NormalizeTag(input.TagID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID tag tidak valid"})
+		return
+	}
+
+	if owner, err := s.vehicleByTag(tagID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Tag sudah terdaftar untuk %s", owner.PlateNumber)})
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check tag"})
+		return
+	}
+
+	tag := models.VehicleTag{VehicleID: vehicle.ID, TagID: tagID, Label: input.Label}
+	if err := s.DB.Create(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tag"})
+		return
+	}
+	s.audit(c, "tag_added", 0, 0, fmt.Sprintf("plate=%s tag=%s", vehicle.PlateNumber, tagID))
+	c.JSON(http.StatusCreated, tag)
+}
+
+// DeleteVehicleTag removes a card or tag from a vehicle, so it can be
+// handed to another one
+func (s *Server) DeleteVehicleTag(c *gin.Context) {
+	var tag models.VehicleTag
+	if err := s.DB.Where("vehicle_id = ?", c.Param("id")).First(&tag, c.Param("tag")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	if err := s.DB.Unscoped().Delete(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+	s.audit(c, "tag_removed", 0, 0, fmt.Sprintf("vehicle=%d tag=%s", tag.VehicleID, tag.TagID))
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted"})
+}
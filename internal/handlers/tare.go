@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"stoneweigh/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// === Stored tare management ===
+
+// Defaults used when the tare settings are not configured
+const (
+	DefaultTareValidity  = 30 * 24 * time.Hour
+	DefaultTareDeviation = 3.0 // Percent
+)
+
+var (
+	errTareExpired         = errors.New("tara tersimpan sudah kedaluwarsa, lakukan timbang tara ulang")
+	errTareMissing         = errors.New("kendaraan belum memiliki tara tersimpan, lakukan timbang tara atau gunakan timbang dua tahap")
+	errVehicleUnregistered = errors.New("kendaraan belum terdaftar, gunakan timbang dua tahap")
+)
+
+// tareExpiry returns when the stored tare of a vehicle stops being usable,
+// nil if it never expires. Legacy tares without a date count as expired
+// once a validity period is set.
+func (s *Server) tareExpiry(v models.Vehicle) *time.Time {
+	if s.TareValidity <= 0 {
+		return nil
+	}
+	var expires time.Time
+	if v.TareMeasuredAt != nil {
+		expires = v.TareMeasuredAt.Add(s.TareValidity)
+	}
+	return &expires
+}
+
+// storedTare returns the known empty weight for a plate. It fails with
+// errVehicleUnregistered or errTareMissing when there is none, and with
+// errTareExpired when the stored tare is too old to use.
+func (s *Server) storedTare(plate string, now time.Time) (float64, error) {
+	var vehicle models.Vehicle
+	err := s.DB.Where("REPLACE(UPPER(plate_number), ' ', '') = ?", normalizePlate(plate)).First(&vehicle).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errVehicleUnregistered
+	}
+	if err != nil {
+		return 0, err
+	}
+	if vehicle.DefaultTare <= 0 {
+		return 0, errTareMissing
+	}
+	if expires := s.tareExpiry(vehicle); expires != nil && now.After(*expires) {
+		return 0, errTareExpired
+	}
+	return vehicle.DefaultTare, nil
+}
+
+// vehicleView is a vehicle with the state of its stored tare, so the
+// weighing page and the vehicle master can remind operators to re-tare
+type vehicleView struct {
+	models.Vehicle
+	TareExpiresAt *time.Time `json:"tare_expires_at"`
+	TareExpired   bool       `json:"tare_expired"`
+}
+
+func (s *Server) vehicleView(v models.Vehicle, now time.Time) vehicleView {
+	view := vehicleView{Vehicle: v, TareExpiresAt: s.tareExpiry(v)}
+	view.TareExpired = v.DefaultTare > 0 && view.TareExpiresAt != nil && now.After(*view.TareExpiresAt)
+	return view
+}
+
+// recordTare stores a new tare measurement for a vehicle and makes it the
+// vehicle's stored tare. A change above TareDeviation against the previous
+// tare is flagged and audited.
+func (s *Server) recordTare(operator string, vehicle *models.Vehicle, tare models.TareRecord) (models.TareRecord, error) {
+	tare.VehicleID = vehicle.ID
+	tare.Operator = operator
+	if tare.MeasuredAt.IsZero() {
+		tare.MeasuredAt = time.Now()
+	}
+	if previous := vehicle.DefaultTare; previous > 0 {
+		tare.Deviation = math.Round((tare.Weight-previous)/previous*10000) / 100
+		tare.Flagged = math.Abs(tare.Deviation) > s.TareDeviation
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimCapture(tx, tare.CaptureID); err != nil {
+			return err
+		}
+		if err := tx.Create(&tare).Error; err != nil {
+			return err
+		}
+		vehicle.DefaultTare = tare.Weight
+		vehicle.TareMeasuredAt = &tare.MeasuredAt
+		return tx.Model(vehicle).Select("DefaultTare", "TareMeasuredAt").Updates(vehicle).Error
+	})
+	if err != nil {
+		return tare, err
+	}
+
+	if tare.Flagged {
+		s.auditAs(operator, "tare_deviation", tare.StationID, tare.WeighingRecordID,
+			fmt.Sprintf("plate=%s tare=%.2f deviation=%.2f%% source=%s", vehicle.PlateNumber, tare.Weight, tare.Deviation, tare.Source))
+	}
+	return tare, nil
+}
+
+// WeighTare records the empty weight of a registered vehicle, either from
+// a capture token or typed in manual mode
+func (s *Server) WeighTare(c *gin.Context) {
+	var input struct {
+		ScaleID      uint    `json:"scale_id"`
+		PlateNumber  string  `json:"plate_number"`
+		CaptureToken string  `json:"capture_token"`
+		Manual       bool    `json:"manual"`
+		ManualReason string  `json:"manual_reason"`
+		Weight       float64 `json:"weight"` // Manual entry mode only, in the station unit
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var vehicle models.Vehicle
+	if err := s.DB.Where("REPLACE(UPPER(plate_number), ' ', '') = ?", normalizePlate(input.PlateNumber)).First(&vehicle).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kendaraan belum terdaftar"})
+		return
+	}
+
+	weight, ok := s.resolveWeight(c, input.ScaleID, input.CaptureToken, input.Manual, input.ManualReason, input.Weight)
+	if !ok {
+		return
+	}
+	if weight.Weight <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Berat tara harus lebih dari 0"})
+		return
+	}
+
+	tare, err := s.recordTare(sessionUsername(c), &vehicle, models.TareRecord{
+		Weight:    weight.Weight,
+		StationID: input.ScaleID,
+		Source:    models.TareSourceWeighing,
+		CaptureID: weight.CaptureID,
+	})
+	if err != nil {
+		if errors.Is(err, errCaptureUsed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tare"})
+		return
+	}
+	if weight.Manual {
+		s.audit(c, "manual_weight", input.ScaleID, 0,
+			fmt.Sprintf("plate=%s tare=%.2f reason=%s", vehicle.PlateNumber, weight.Weight, weight.ManualReason))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Tara tersimpan",
+		"tare":       tare,
+		"expires_at": s.tareExpiry(vehicle),
+	})
+}
+
+// GetVehicleTares returns the tare history of a vehicle, newest first
+func (s *Server) GetVehicleTares(c *gin.Context) {
+	var tares []models.TareRecord
+	if err := s.DB.Where("vehicle_id = ?", c.Param("id")).Order("measured_at desc").Find(&tares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tare history"})
+		return
+	}
+	c.JSON(http.StatusOK, tares)
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/outputs"
+	"stoneweigh/internal/pkg"
+	"stoneweigh/internal/reporting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// === Two-pass (inbound/outbound) weighing ===
+
+// normalizePlate makes plates from ANPR and manual input comparable
+func normalizePlate(plate string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(plate), " ", ""))
+}
+
+// findOpenTickets returns PENDING records, optionally only for one plate
+func (s *Server) findOpenTickets(plate string) ([]models.WeighingRecord, error) {
+	query := s.DB.Where("status = ?", models.StatusPending).Order("first_weighed_at desc")
+	if p := normalizePlate(plate); p != "" {
+		query = query.Where("REPLACE(UPPER(plate_number), ' ', '') = ?", p)
+	}
+	var records []models.WeighingRecord
+	err := query.Find(&records).Error
+	return records, err
+}
+
+// FirstWeigh records the entry weight and opens a PENDING ticket
+func (s *Server) FirstWeigh(c *gin.Context) {
+	var input struct {
+		ScaleID      uint    `json:"scale_id"`
+		PlateNumber  string  `json:"plate_number"`
+		DriverName   string  `json:"driver_name"`
+		Company      string  `json:"company"`
+		Product      string  `json:"product"`
+		CaptureToken string  `json:"capture_token"`
+		Manual       bool    `json:"manual"`
+		ManualReason string  `json:"manual_reason"`
+		Weight       float64 `json:"weight"` // Manual entry mode only, in the station unit
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// One open ticket per truck, otherwise the second weigh is ambiguous
+	open, err := s.findOpenTickets(input.PlateNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check open tickets"})
+		return
+	}
+	if len(open) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Kendaraan ini masih memiliki tiket terbuka: " + open[0].TicketNumber,
+			"record": open[0],
+		})
+		return
+	}
+
+	weight, ok := s.resolveWeight(c, input.ScaleID, input.CaptureToken, input.Manual, input.ManualReason, input.Weight)
+	if !ok {
+		return
+	}
+
+	record := models.WeighingRecord{
+		ScaleID:     input.ScaleID,
+		PlateNumber: input.PlateNumber,
+		DriverName:  input.DriverName,
+		CompanyName: input.Company,
+		ManagerName: sessionUsername(c),
+		Product:     input.Product,
+	}
+	if err := s.openTicket(&record, weight); err != nil {
+		if errors.Is(err, errCaptureUsed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to save record: " + err.Error()})
+		return
+	}
+	ticket := record.TicketNumber
+
+	if weight.Manual {
+		s.audit(c, "manual_weight", record.ScaleID, record.ID,
+			fmt.Sprintf("ticket=%s first=%.2f reason=%s", ticket, weight.Weight, weight.ManualReason))
+	}
+	s.fireOutputs(record.ScaleID, outputs.EventSaved)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Timbang pertama tersimpan",
+		"ticket":  ticket,
+		"record":  record,
+	})
+}
+
+// openTicket books the entry weight of a truck as a new PENDING record.
+// The record comes with its station, vehicle and operator filled in.
+func (s *Server) openTicket(record *models.WeighingRecord, weight resolvedWeight) error {
+	ticket, err := pkg.GenerateTicketID(12)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record.TicketNumber = ticket
+	record.Status = models.StatusPending
+	record.FirstWeight = weight.Weight
+	record.FirstWeighedAt = &now
+	record.Unit, record.Division = weight.Unit, weight.Division
+	record.CaptureID = weight.CaptureID
+	record.ManualEntry, record.ManualReason = weight.Manual, weight.ManualReason
+	record.Axles = axleWeights(1, weight)
+	record.Curves = []models.WeightCurve{weightCurve(record.ScaleID, 1, weight)}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimCapture(tx, record.CaptureID); err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+}
+
+// GetOpenTickets lists PENDING records, filtered by plate when given
+func (s *Server) GetOpenTickets(c *gin.Context) {
+	records, err := s.findOpenTickets(c.Query("plate"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch open tickets"})
+		return
+	}
+	c.JSON(http.StatusOK, records)
+}
+
+// SecondWeigh fills in the exit weight of a PENDING record, derives
+// gross/tare from the larger/smaller weight and completes the ticket.
+func (s *Server) SecondWeigh(c *gin.Context) {
+	var record models.WeighingRecord
+	if err := s.DB.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+	if record.Status != models.StatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tiket sudah tidak terbuka"})
+		return
+	}
+
+	var input struct {
+		ScaleID      uint    `json:"scale_id"` // Exit scale, may differ from the entry scale
+		CaptureToken string  `json:"capture_token"`
+		Manual       bool    `json:"manual"`
+		ManualReason string  `json:"manual_reason"`
+		Weight       float64 `json:"weight"` // Manual entry mode only, in the station unit
+
+		overloadApproval
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ScaleID == 0 {
+		input.ScaleID = record.ScaleID
+	}
+
+	weight, ok := s.resolveWeight(c, input.ScaleID, input.CaptureToken, input.Manual, input.ManualReason, input.Weight)
+	if !ok {
+		return
+	}
+
+	weighSecond(&record, weight, time.Now())
+	if !s.checkOverload(c, &record, input.overloadApproval) {
+		return
+	}
+	if err := s.completeTicket(&record, input.ScaleID, weight, sessionUsername(c)); err != nil {
+		if errors.Is(err, errTicketClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tiket sudah tidak terbuka"})
+			return
+		}
+		if errors.Is(err, errCaptureUsed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save record"})
+		return
+	}
+
+	if weight.Manual {
+		s.audit(c, "manual_weight", input.ScaleID, record.ID,
+			fmt.Sprintf("ticket=%s second=%.2f reason=%s", record.TicketNumber, weight.Weight, weight.ManualReason))
+	}
+	s.auditOverload(sessionUsername(c), record)
+	s.fireOutputs(input.ScaleID, outputs.EventSaved)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Transaction saved",
+		"ticket":  record.TicketNumber,
+		"invoice": invoiceWebPath(record.InvoicePath),
+		"record":  record,
+	})
+}
+
+var errTicketClosed = errors.New("tiket sudah tidak terbuka")
+
+// weighSecond fills in the exit weight of a PENDING record: gross and tare
+// are the larger and smaller of both weights
+func weighSecond(record *models.WeighingRecord, weight resolvedWeight, now time.Time) {
+	record.SecondWeight = weight.Weight
+	record.SecondWeighedAt = &now
+	record.SecondCaptureID = weight.CaptureID
+	record.GrossWeight = max(record.FirstWeight, record.SecondWeight)
+	record.TareWeight = min(record.FirstWeight, record.SecondWeight)
+	record.NetWeight = record.GrossWeight - record.TareWeight
+	record.Status = models.StatusCompleted
+	record.WeighedAt = now
+	if record.Unit == "" {
+		// Opened before stations had units
+		record.Unit, record.Division = weight.Unit, weight.Division
+	}
+	if weight.Manual {
+		record.ManualEntry = true
+		if record.ManualReason != "" {
+			record.ManualReason += " / " + weight.ManualReason
+		} else {
+			record.ManualReason = weight.ManualReason
+		}
+	}
+}
+
+// completeTicket saves a record completed by weighSecond on a station,
+// with its invoice, the axles and curve of the second pass, and books the
+// empty pass as the vehicle's tare. It fails with errTicketClosed when the
+// ticket was completed by someone else in the meantime, and with
+// errCaptureUsed when its capture token was spent by another save.
+func (s *Server) completeTicket(record *models.WeighingRecord, stationID uint, weight resolvedWeight, operator string) error {
+	// The invoice shows the axles of both weighings
+	s.DB.Where("weighing_record_id = ?", record.ID).Order("pass, axle").Find(&record.Axles)
+	secondAxles := axleWeights(2, weight)
+	record.Axles = append(record.Axles, secondAxles...)
+
+	path, err := reporting.GenerateInvoice(*record)
+	if err == nil {
+		record.InvoicePath = path
+	} else {
+		log.Printf("Error generating PDF: %v", err)
+	}
+
+	// Only complete the ticket if nobody else did in the meantime
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(record).Where("status = ?", models.StatusPending).Select("*").Omit("Axles", "Curves").Updates(record)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errTicketClosed
+		}
+		return claimCapture(tx, record.SecondCaptureID)
+	})
+	if err != nil {
+		return err
+	}
+	if len(secondAxles) > 0 {
+		for i := range secondAxles {
+			secondAxles[i].WeighingRecordID = record.ID
+		}
+		if err := s.DB.Create(&secondAxles).Error; err != nil {
+			log.Printf("Error saving axle weights of ticket %s: %v", record.TicketNumber, err)
+		}
+	}
+
+	curve := weightCurve(stationID, 2, weight)
+	curve.WeighingRecordID = record.ID
+	if err := s.DB.Create(&curve).Error; err != nil {
+		log.Printf("Error linking weight curve of ticket %s: %v", record.TicketNumber, err)
+	}
+
+	// The empty pass is a fresh tare for registered vehicles
+	var vehicle models.Vehicle
+	if err := s.DB.Where("REPLACE(UPPER(plate_number), ' ', '') = ?", normalizePlate(record.PlateNumber)).First(&vehicle).Error; err == nil {
+		// Empty on entry (delivery out) or on exit (supply in)
+		station, measured := stationID, *record.SecondWeighedAt
+		if record.FirstWeight < record.SecondWeight {
+			station = record.ScaleID
+			if record.FirstWeighedAt != nil {
+				measured = *record.FirstWeighedAt
+			}
+		}
+		if _, err := s.recordTare(operator, &vehicle, models.TareRecord{
+			Weight:           record.TareWeight,
+			MeasuredAt:       measured,
+			StationID:        station,
+			Source:           models.TareSourceTwoPass,
+			WeighingRecordID: record.ID,
+		}); err != nil {
+			log.Printf("Error saving tare of ticket %s: %v", record.TicketNumber, err)
+		}
+	}
+	return nil
+}
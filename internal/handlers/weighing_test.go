@@ -0,0 +1,999 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/kiosk"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/outputs"
+	"stoneweigh/internal/pkg/odol"
+	"stoneweigh/internal/pkg/timeseries"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newWeighingTestServer wires a Server on an in-memory DB with an admin session
+func newWeighingTestServer(t *testing.T) (*Server, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.WeighingRecord{}, &models.WeighingStation{},
+		&models.Vehicle{}, &models.AuditLog{}, &models.UserStationAssignment{}, &models.AxleWeight{}, &models.User{}, &models.TareRecord{}, &models.UsedCapture{}, &models.ScaleEvent{}, &models.ScaleHealthSnapshot{},
+		&models.WeightSample{}, &models.WeightCurve{}, &models.OutputDevice{}, &models.OutputRule{},
+		&models.VehicleTag{}))
+
+	station := models.WeighingStation{Name: "Test", Enabled: true}
+	require.NoError(t, db.Create(&station).Error)
+
+	server := NewServer(db, hardware.NewScaleManager(), nil)
+
+	// Invoices are written relative to the working directory
+	wd, _ := os.Getwd()
+	tmp := t.TempDir()
+	require.NoError(t, os.Chdir(tmp))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	r := gin.New()
+	r.Use(sessions.Sessions("test", cookie.NewStore([]byte("test"))))
+	r.Use(func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("user_id", uint(1))
+		session.Set("username", "tester")
+		session.Set("role", "admin")
+		c.Next()
+	})
+	r.POST("/api/scales/:id/capture", server.CaptureWeight)
+	r.POST("/api/scales/:id/command", server.ScaleCommand)
+	r.POST("/api/transaction", server.SaveTransaction)
+	r.POST("/api/vehicles/tare", server.WeighTare)
+	r.POST("/api/weighing/first", server.FirstWeigh)
+	r.GET("/api/weighing/open", server.GetOpenTickets)
+	r.POST("/api/weighing/:id/second", server.SecondWeigh)
+	r.GET("/api/scales/health", server.GetScaleHealth)
+	r.GET("/api/scales/events", server.GetScaleEvents)
+	r.GET("/api/scales/:id/health", server.GetScaleHealthHistory)
+	r.GET("/api/transactions/:id/curve", server.GetTransactionCurve)
+	r.POST("/api/ports/diagnose", server.DiagnosePort)
+	r.POST("/api/outputs/devices", server.CreateOutputDevice)
+	r.DELETE("/api/outputs/devices/:id", server.DeleteOutputDevice)
+	r.POST("/api/outputs/devices/:id/switch", server.SwitchOutput)
+	r.POST("/api/outputs/rules", server.CreateOutputRule)
+	r.GET("/api/scales/stream", server.StreamScaleData)
+	r.GET("/api/vehicles/details", server.GetVehicleDetails)
+	r.POST("/api/vehicles/:id/tags", server.AddVehicleTag)
+	r.DELETE("/api/vehicles/:id/tags/:tag", server.DeleteVehicleTag)
+	r.GET("/api/kiosk/status", server.GetKioskStatus)
+	r.POST("/api/kiosk/:id/resolve", server.ResolveKiosk)
+	return server, r
+}
+
+func doJSON(t *testing.T, r *gin.Engine, method, path string, body any) (int, map[string]any) {
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	var out map[string]any
+	json.Unmarshal(w.Body.Bytes(), &out)
+	return w.Code, out
+}
+
+func TestTwoPassWeighing(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+
+	capture := func(weight float64) string {
+		server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: weight, HasMotion: true, Stable: true}, time.Now())
+		code, body := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+		require.Equal(t, http.StatusOK, code, body)
+		return body["token"].(string)
+	}
+
+	// Loaded truck on entry
+	code, body := doJSON(t, r, "POST", "/api/weighing/first", gin.H{
+		"scale_id": 1, "plate_number": "B 1234 XY", "driver_name": "Budi",
+		"capture_token": capture(24500),
+	})
+	require.Equal(t, http.StatusOK, code, body)
+
+	// A second entry for the same truck is refused
+	code, _ = doJSON(t, r, "POST", "/api/weighing/first", gin.H{
+		"scale_id": 1, "plate_number": "B1234XY", "driver_name": "Budi",
+		"capture_token": capture(24500),
+	})
+	assert.Equal(t, http.StatusConflict, code)
+
+	var open []models.WeighingRecord
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/weighing/open?plate=b1234xy", nil)
+	r.ServeHTTP(w, req)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &open))
+	require.Len(t, open, 1)
+
+	// Empty truck on exit completes the ticket
+	token := capture(8200)
+	code, body = doJSON(t, r, "POST", "/api/weighing/"+itoa(open[0].ID)+"/second", gin.H{"capture_token": token})
+	require.Equal(t, http.StatusOK, code, body)
+
+	var record models.WeighingRecord
+	require.NoError(t, server.DB.First(&record, open[0].ID).Error)
+	assert.Equal(t, models.StatusCompleted, record.Status)
+	assert.Equal(t, 24500.0, record.GrossWeight)
+	assert.Equal(t, 8200.0, record.TareWeight)
+	assert.Equal(t, 16300.0, record.NetWeight)
+
+	// Capture tokens are single use and the ticket cannot be closed twice
+	code, _ = doJSON(t, r, "POST", "/api/weighing/"+itoa(open[0].ID)+"/second", gin.H{"capture_token": token})
+	assert.Equal(t, http.StatusConflict, code)
+}
+
+func TestTwoPassTare(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	vehicle := models.Vehicle{PlateNumber: "B 5 TT", DriverName: "Budi"}
+	require.NoError(t, server.DB.Create(&vehicle).Error)
+
+	capture := func(weight float64) string {
+		server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: weight, HasMotion: true, Stable: true}, time.Now())
+		code, body := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+		require.Equal(t, http.StatusOK, code, body)
+		return body["token"].(string)
+	}
+
+	// Empty on entry, loaded on exit: the tare dates from the entry. The
+	// plate is read without spaces, as ANPR does.
+	code, body := doJSON(t, r, "POST", "/api/weighing/first", gin.H{
+		"scale_id": 1, "plate_number": "b5tt", "driver_name": "Budi", "capture_token": capture(8000),
+	})
+	require.Equal(t, http.StatusOK, code, body)
+	id := uint(body["record"].(map[string]any)["ID"].(float64))
+	entry := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	require.NoError(t, server.DB.Model(&models.WeighingRecord{}).Where("id = ?", id).Update("first_weighed_at", entry).Error)
+
+	code, body = doJSON(t, r, "POST", "/api/weighing/"+itoa(id)+"/second", gin.H{"capture_token": capture(24000)})
+	require.Equal(t, http.StatusOK, code, body)
+
+	var tare models.TareRecord
+	require.NoError(t, server.DB.Where("vehicle_id = ?", vehicle.ID).First(&tare).Error)
+	assert.Equal(t, 8000.0, tare.Weight)
+	assert.Equal(t, models.TareSourceTwoPass, tare.Source)
+	assert.True(t, tare.MeasuredAt.Equal(entry), "tare measured at %v, entry at %v", tare.MeasuredAt, entry)
+}
+
+func TestScaleCommandAudited(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+
+	// Refused before reaching the indicator, still on record
+	code, body := doJSON(t, r, "POST", "/api/scales/1/command", gin.H{"command": "tare"})
+	require.Equal(t, http.StatusConflict, code, body)
+	var entry models.AuditLog
+	require.NoError(t, server.DB.Where("action = ?", "scale_tare").First(&entry).Error)
+	assert.Contains(t, entry.Detail, "not connected")
+}
+
+func TestCaptureRefusesNetWeight(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	var station models.WeighingStation
+	require.NoError(t, server.DB.First(&station, 1).Error)
+	station.ScalePort = "tcp://" + ln.Addr().String()
+	station.Protocol = hardware.ProtocolAND
+	require.NoError(t, server.DB.Save(&station).Error)
+	server.ScaleMgr.AddOrUpdateScale(station)
+	t.Cleanup(func() { server.ScaleMgr.RemoveScale(station.ID) })
+
+	indicator, err := ln.Accept()
+	require.NoError(t, err)
+	defer indicator.Close()
+	// Part of the load is on the platform when the operator tares
+	indicator.Write([]byte("ST,GS,+0015000kg\r\n"))
+	require.Eventually(t, func() bool {
+		status, ok := server.ScaleMgr.Status(1)
+		return ok && status.Weight == 15000
+	}, 2*time.Second, 10*time.Millisecond)
+	go func() {
+		lines := bufio.NewScanner(indicator)
+		for lines.Scan() {
+			if lines.Text() == "T" {
+				indicator.Write([]byte("ST,NT,+0000000kg\r\n"))
+			}
+		}
+	}()
+
+	code, body := doJSON(t, r, "POST", "/api/scales/1/command", gin.H{"command": "tare"})
+	require.Equal(t, http.StatusOK, code, body)
+
+	// The rest of the load drives on, its net weight is not signed
+	indicator.Write([]byte("ST,NT,+0009500kg\r\n"))
+	require.Eventually(t, func() bool {
+		status, _ := server.ScaleMgr.Status(1)
+		return status.Weight == 9500
+	}, 2*time.Second, 10*time.Millisecond)
+	code, body = doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+	require.Equal(t, http.StatusConflict, code, body)
+	assert.Contains(t, body["error"], "mode net")
+
+	indicator.Write([]byte("ST,GS,+0024500kg\r\n"))
+	require.Eventually(t, func() bool {
+		status, _ := server.ScaleMgr.Status(1)
+		return status.Weight == 24500
+	}, 2*time.Second, 10*time.Millisecond)
+	code, body = doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, 24500.0, body["weight"])
+}
+
+func TestCaptureSingleUse(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+
+	server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: 24500, HasMotion: true, Stable: true}, time.Now())
+	code, body := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+	require.Equal(t, http.StatusOK, code, body)
+	token := body["token"].(string)
+
+	// Two saves that both passed the early check: only the first commits
+	first, err := server.resolveCapture(token, 1)
+	require.NoError(t, err)
+	weight := resolvedWeight{Weight: first.Weight, CaptureID: first.ID, CapturedAt: time.Now()}
+	for i, plate := range []string{"B 1 AA", "B 2 BB"} {
+		record := models.WeighingRecord{ScaleID: 1, PlateNumber: plate, DriverName: "Budi"}
+		err := server.openTicket(&record, weight)
+		if i == 0 {
+			require.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, errCaptureUsed)
+		}
+	}
+	var records int64
+	server.DB.Model(&models.WeighingRecord{}).Count(&records)
+	assert.Equal(t, int64(1), records)
+
+	// Nor can a tare or a later request take it
+	vehicle := models.Vehicle{PlateNumber: "B 3 CC"}
+	require.NoError(t, server.DB.Create(&vehicle).Error)
+	_, err = server.recordTare("tester", &vehicle, models.TareRecord{Weight: 8000, CaptureID: first.ID})
+	assert.ErrorIs(t, err, errCaptureUsed)
+	code, body = doJSON(t, r, "POST", "/api/transaction", gin.H{
+		"scale_id": 1, "plate_number": "B 3 CC", "driver_name": "Budi", "capture_token": token,
+	})
+	assert.Equal(t, http.StatusBadRequest, code, body)
+	assert.Equal(t, "capture token sudah dipakai", body["error"])
+}
+
+func TestAxleWeighing(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+
+	// Two axles of 6000 and 9000 kg cross the platform, over and over
+	scenario := filepath.Join(t.TempDir(), "axles.yaml")
+	require.NoError(t, os.WriteFile(scenario, []byte(`
+interval: 10ms
+loop: true
+steps:
+  - {action: hold, weight: 0, duration: 100ms}
+  - {action: hold, weight: 6000, duration: 200ms}
+  - {action: hold, weight: 0, duration: 100ms}
+  - {action: hold, weight: 9000, duration: 200ms}
+  - {action: hold, weight: 0, duration: 300ms}
+`), 0o644))
+
+	var station models.WeighingStation
+	require.NoError(t, server.DB.First(&station, 1).Error)
+	station.AxleMode = true
+	station.AxleTimeoutMs = 100
+	station.StableWindowMs = 50
+	station.SimScenario = scenario
+	require.NoError(t, server.DB.Save(&station).Error)
+	server.ScaleMgr.AddOrUpdateScale(station)
+	t.Cleanup(func() { server.ScaleMgr.RemoveScale(station.ID) })
+
+	capturePass := func() map[string]any {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if status, _ := server.ScaleMgr.Status(station.ID); status.PassReady {
+				break
+			}
+			require.True(t, time.Now().Before(deadline), "no axle pass completed")
+			time.Sleep(10 * time.Millisecond)
+		}
+		code, body := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+		require.Equal(t, http.StatusOK, code, body)
+		return body
+	}
+
+	capt := capturePass()
+	assert.Equal(t, 15000.0, capt["weight"])
+	assert.Equal(t, []any{6000.0, 9000.0}, capt["axles"])
+
+	// The pass is handed out once
+	code, _ := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, body := doJSON(t, r, "POST", "/api/weighing/first", gin.H{
+		"scale_id": 1, "plate_number": "DR 8123 AB", "driver_name": "Made",
+		"capture_token": capt["token"],
+	})
+	require.Equal(t, http.StatusOK, code, body)
+	id := uint(body["record"].(map[string]any)["ID"].(float64))
+
+	capt = capturePass()
+	code, body = doJSON(t, r, "POST", "/api/weighing/"+itoa(id)+"/second", gin.H{"capture_token": capt["token"]})
+	require.Equal(t, http.StatusOK, code, body)
+
+	var record models.WeighingRecord
+	require.NoError(t, server.DB.Preload("Axles").First(&record, id).Error)
+	require.Len(t, record.Axles, 4)
+	for _, a := range record.Axles {
+		assert.Contains(t, []int{1, 2}, a.Pass)
+		assert.Equal(t, map[int]float64{1: 6000, 2: 9000}[a.Axle], a.Weight)
+	}
+	assert.FileExists(t, record.InvoicePath)
+}
+
+func TestOverloadEnforcement(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	server.Overload = odol.NewPolicy(5, 50)
+
+	tared := time.Now()
+	require.NoError(t, server.DB.Create(&models.Vehicle{
+		PlateNumber: "B 9000 OD", DriverName: "Andi", VehicleClass: "III", AxleConfig: "1.22", PermittedGross: 20000,
+		DefaultTare: 8000, TareMeasuredAt: &tared,
+	}).Error)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("rahasia"), bcrypt.MinCost)
+	require.NoError(t, server.DB.Create(&models.User{Username: "spv", PasswordHash: string(hash), Role: "supervisor"}).Error)
+
+	plate := "B 9000 OD"
+	save := func(weight float64, approval gin.H) (int, map[string]any) {
+		server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: weight, HasMotion: true, Stable: true}, time.Now())
+		code, body := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+		require.Equal(t, http.StatusOK, code, body)
+		input := gin.H{"scale_id": 1, "plate_number": plate, "driver_name": "Andi", "company": "PT Batu", "capture_token": body["token"]}
+		for k, v := range approval {
+			input[k] = v
+		}
+		return doJSON(t, r, "POST", "/api/transaction", input)
+	}
+
+	// 20% over JBI needs a supervisor
+	code, body := save(24000, nil)
+	require.Equal(t, http.StatusConflict, code, body)
+	assert.Equal(t, true, body["approval_required"])
+	assert.Equal(t, 20.0, body["overload_percent"])
+
+	code, _ = save(24000, gin.H{"supervisor_username": "spv", "supervisor_password": "salah"})
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, body = save(24000, gin.H{"supervisor_username": "spv", "supervisor_password": "rahasia"})
+	require.Equal(t, http.StatusOK, code, body)
+	var record models.WeighingRecord
+	require.NoError(t, server.DB.Where("ticket_number = ?", body["ticket"]).First(&record).Error)
+	assert.Equal(t, 20.0, record.OverloadPercent)
+	assert.Equal(t, 20000.0, record.PermittedGross)
+	assert.Equal(t, "spv", record.OverloadApprovedBy)
+
+	// Above the block threshold even a supervisor cannot let it out
+	code, _ = save(31000, gin.H{"supervisor_username": "spv", "supervisor_password": "rahasia"})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	// Within tolerance passes without approval
+	code, body = save(20500, nil)
+	assert.Equal(t, http.StatusOK, code, body)
+
+	// Plates read by ANPR are written differently but the limit still applies
+	plate = "b9000od"
+	code, body = save(24000, nil)
+	assert.Equal(t, http.StatusConflict, code, body)
+}
+
+func TestStoredTare(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	server.TareValidity = 24 * time.Hour
+	server.TareDeviation = 3
+
+	vehicle := models.Vehicle{PlateNumber: "B 8000 TR", DriverName: "Sari"}
+	require.NoError(t, server.DB.Create(&vehicle).Error)
+
+	capture := func(weight float64) string {
+		server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: weight, HasMotion: true, Stable: true}, time.Now())
+		code, body := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+		require.Equal(t, http.StatusOK, code, body)
+		return body["token"].(string)
+	}
+	// Typed without spaces, still the registered B 8000 TR
+	weighTare := func(weight float64) map[string]any {
+		code, body := doJSON(t, r, "POST", "/api/vehicles/tare", gin.H{"scale_id": 1, "plate_number": "B8000TR", "capture_token": capture(weight)})
+		require.Equal(t, http.StatusOK, code, body)
+		return body["tare"].(map[string]any)
+	}
+	save := func(weight float64) (int, map[string]any) {
+		return doJSON(t, r, "POST", "/api/transaction", gin.H{
+			"scale_id": 1, "plate_number": "B 8000 TR", "driver_name": "Sari", "capture_token": capture(weight),
+		})
+	}
+
+	// Without a stored tare the net weight is unknown: tare or two-pass first
+	code, body := save(24000)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, true, body["retare_required"])
+	code, body = doJSON(t, r, "POST", "/api/transaction", gin.H{
+		"scale_id": 1, "plate_number": "B 1 XX", "driver_name": "Sari", "capture_token": capture(24000),
+	})
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, false, body["retare_required"])
+	var records int64
+	server.DB.Model(&models.WeighingRecord{}).Count(&records)
+	assert.Equal(t, int64(0), records)
+
+	tare := weighTare(8000)
+	assert.Equal(t, false, tare["flagged"])
+
+	code, body = save(24000)
+	require.Equal(t, http.StatusOK, code, body)
+	var record models.WeighingRecord
+	require.NoError(t, server.DB.Where("ticket_number = ?", body["ticket"]).First(&record).Error)
+	assert.Equal(t, 8000.0, record.TareWeight)
+	assert.Equal(t, 16000.0, record.NetWeight)
+
+	// A tare 6.25% off the last one is flagged and audited
+	tare = weighTare(8500)
+	assert.Equal(t, true, tare["flagged"])
+	assert.Equal(t, 6.25, tare["deviation"])
+	var audits int64
+	server.DB.Model(&models.AuditLog{}).Where("action = ?", "tare_deviation").Count(&audits)
+	assert.Equal(t, int64(1), audits)
+
+	// Once expired the stored tare is refused until the truck is re-tared
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, server.DB.Model(&vehicle).Update("tare_measured_at", old).Error)
+	code, body = save(24000)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, true, body["retare_required"])
+
+	weighTare(8400)
+	code, body = save(24000)
+	assert.Equal(t, http.StatusOK, code, body)
+
+	var history []models.TareRecord
+	server.DB.Where("vehicle_id = ?", vehicle.ID).Order("id").Find(&history)
+	require.Len(t, history, 3)
+	assert.Equal(t, models.TareSourceWeighing, history[2].Source)
+	assert.Equal(t, "tester", history[2].Operator)
+}
+
+func TestUptime(t *testing.T) {
+	from := time.Unix(1700000000, 0)
+	to := from.Add(10 * time.Hour)
+	at := func(h int) time.Time { return from.Add(time.Duration(h) * time.Hour) }
+	events := []models.ScaleEvent{
+		{Kind: hardware.HealthDisconnected, At: at(2)},
+		{Kind: hardware.HealthSilent, At: at(3)}, // Alerts do not change the link
+		{Kind: hardware.HealthConnected, At: at(4)},
+		{Kind: hardware.HealthDisconnected, At: at(9)},
+	}
+
+	assert.InDelta(t, 0.7, uptime(events, true, from, to), 1e-9)  // 0-2 and 4-9
+	assert.InDelta(t, 0.5, uptime(events, false, from, to), 1e-9) // 4-9 only
+	assert.InDelta(t, 1.0, uptime(nil, true, from, to), 1e-9)
+	assert.Zero(t, uptime(nil, false, from, to))
+}
+
+func TestScaleHealthEvents(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	go server.RecordScaleEvents(stop)
+
+	// Wait for the recorder to subscribe before publishing
+	require.Eventually(t, func() bool {
+		server.ScaleMgr.HealthEvents.Publish(hardware.HealthEvent{ScaleID: 9, Kind: "probe", At: time.Now()})
+		var n int64
+		server.DB.Model(&models.ScaleEvent{}).Where("kind = ?", "probe").Count(&n)
+		return n > 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	now := time.Now()
+	server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: 0}, now.Add(-time.Minute))
+	server.ScaleMgr.CheckHealth(now) // Silent for a minute
+	require.Eventually(t, func() bool {
+		var n int64
+		server.DB.Model(&models.ScaleEvent{}).Where("station_id = ? AND kind = ?", 1, hardware.HealthSilent).Count(&n)
+		return n == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/scales/health", nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var health []map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	require.Len(t, health, 1)
+	assert.Equal(t, "Test", health[0]["name"])
+	assert.Equal(t, true, health[0]["silent"])
+	assert.Equal(t, 1.0, health[0]["frames"])
+	assert.Greater(t, health[0]["uptime"], 0.0)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/scales/events?scale_id=1&alerts=true", nil)
+	r.ServeHTTP(w, req)
+	var events []models.ScaleEvent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, hardware.HealthSilent, events[0].Kind)
+
+	// Snapshots keep the frame counters for later
+	require.NoError(t, server.snapshotHealth(now, map[uint]hardware.Health{}))
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/scales/1/health", nil)
+	r.ServeHTTP(w, req)
+	var snapshots []models.ScaleHealthSnapshot
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshots))
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, uint64(1), snapshots[0].Frames)
+	assert.NotNil(t, snapshots[0].LastFrameAt)
+
+	// A removed station stops counting uptime
+	server.ScaleMgr.RemoveScale(1)
+	require.Eventually(t, func() bool {
+		var n int64
+		server.DB.Model(&models.ScaleEvent{}).Where("station_id = ? AND kind = ? AND detail = ?", 1, hardware.HealthDisconnected, "station removed").Count(&n)
+		return n == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.InDelta(t, server.stationUptime(1, time.Now()), server.stationUptime(1, time.Now().Add(time.Hour)), 1e-4)
+}
+
+func TestWeightCurve(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	server.Samples = timeseries.Downsampler{MinInterval: time.Nanosecond}
+	stop := make(chan struct{})
+	go server.RecordWeightSamples(stop)
+	require.Eventually(t, func() bool { return server.ScaleMgr.Events.Len() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// A truck drives on and settles, then gets captured
+	for _, w := range []float64{0, 9000, 21000, 24480} {
+		server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: w, HasMotion: true}, time.Now())
+		time.Sleep(time.Millisecond)
+	}
+	server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: 24500, HasMotion: true, Stable: true}, time.Now())
+	_, body := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+	code, body := doJSON(t, r, "POST", "/api/weighing/first", gin.H{
+		"scale_id": 1, "plate_number": "B 1234 XY", "driver_name": "Budi",
+		"capture_token": body["token"],
+	})
+	require.Equal(t, http.StatusOK, code, body)
+	recordID := uint(body["record"].(map[string]any)["ID"].(float64))
+
+	require.Eventually(t, func() bool {
+		var n int64
+		server.DB.Model(&models.WeightSample{}).Where("station_id = ?", 1).Count(&n)
+		return n >= 5
+	}, 5*time.Second, 50*time.Millisecond)
+	close(stop)
+
+	var curve struct {
+		Curves []struct {
+			Pass    int                   `json:"pass"`
+			Samples []models.WeightSample `json:"samples"`
+		} `json:"curves"`
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/transactions/"+itoa(recordID)+"/curve", nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &curve))
+	require.Len(t, curve.Curves, 1)
+	assert.Equal(t, 1, curve.Curves[0].Pass)
+	samples := curve.Curves[0].Samples
+	require.GreaterOrEqual(t, len(samples), 5)
+	assert.Equal(t, 9000.0, samples[1].Weight)
+	assert.Equal(t, 24500.0, samples[len(samples)-1].Weight)
+	assert.True(t, samples[len(samples)-1].Stable)
+
+	// Retention prunes old samples but keeps those of a weighing's curve
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, server.DB.Create(&models.WeightCurve{
+		WeighingRecordID: recordID, StationID: 2, Pass: 2,
+		CapturedAt: old, StartAt: old.Add(-time.Minute), EndAt: old.Add(time.Minute),
+	}).Error)
+	require.NoError(t, server.DB.Create(&[]models.WeightSample{
+		{StationID: 2, At: old, Weight: 8200, Stable: true, Connected: true},
+		{StationID: 2, At: old.Add(time.Hour), Weight: 0, Connected: true},
+		{StationID: 3, At: old, Weight: 0, Connected: true}, // Other station, same time
+	}).Error)
+	server.SampleRetention = 24 * time.Hour
+	n, err := server.PruneWeightSamples(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	var kept []models.WeightSample
+	server.DB.Where("station_id <> ?", 1).Find(&kept)
+	require.Len(t, kept, 1)
+	assert.Equal(t, 8200.0, kept[0].Weight)
+}
+
+func TestDiagnosePort(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("ST,GS,+0012340kg\r\nnoise\r\n"))
+		conn.Close()
+	}()
+
+	var buf bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buf).Encode(gin.H{"scale_port": "tcp://" + ln.Addr().String(), "protocol": "and", "seconds": 2}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/ports/diagnose", &buf)
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	body := w.Body.String()
+	assert.Equal(t, 2, strings.Count(body, "event:frame"))
+	assert.Contains(t, body, `"weight":12340`)
+	assert.Contains(t, body, `"raw":"noise"`)
+	assert.Contains(t, body, "event:end")
+	assert.Contains(t, body, `"rejected":1`)
+
+	// The port of a running station is left alone
+	server.ScaleMgr.AddOrUpdateScale(models.WeighingStation{Model: gorm.Model{ID: 5}, ScalePort: "tcp-listen://127.0.0.1:0"})
+	defer server.ScaleMgr.RemoveScale(5)
+	code, out := doJSON(t, r, "POST", "/api/ports/diagnose", gin.H{"scale_port": "tcp-listen://127.0.0.1:0"})
+	assert.Equal(t, http.StatusConflict, code, out)
+}
+
+func itoa(id uint) string {
+	b, _ := json.Marshal(id)
+	return string(b)
+}
+
+func TestStationUnits(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	require.NoError(t, server.DB.Model(&models.WeighingStation{}).Where("id = ?", 1).
+		Updates(map[string]any{"unit": "t", "division": 0.01}).Error)
+
+	// Typed weights are in the station unit, rounded to the 10 kg division like readings
+	code, body := doJSON(t, r, "POST", "/api/transaction", gin.H{
+		"scale_id": 1, "plate_number": "B 1234 XY", "driver_name": "Budi",
+		"manual": true, "manual_reason": "indikator rusak", "gross": 24.504, "tare": 8.196,
+	})
+	require.Equal(t, http.StatusOK, code, body)
+
+	var record models.WeighingRecord
+	require.NoError(t, server.DB.Where("ticket_number = ?", body["ticket"]).First(&record).Error)
+	assert.Equal(t, 24500.0, record.GrossWeight)
+	assert.Equal(t, 8200.0, record.TareWeight)
+	assert.Equal(t, 16300.0, record.NetWeight)
+	assert.Equal(t, "t", record.Unit)
+	assert.Equal(t, "16.30 t", record.FormatWeight(record.NetWeight))
+
+	// Records from before units are shown like they always were
+	assert.Equal(t, "16300 kg", models.WeighingRecord{}.FormatWeight(16300))
+}
+
+func TestOutputsOpenGateOnSave(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	t.Cleanup(server.Outputs.Close)
+
+	code, body := doJSON(t, r, "POST", "/api/outputs/devices", gin.H{"name": "Gate", "driver": "plc", "enabled": true})
+	assert.Equal(t, http.StatusBadRequest, code, body)
+	code, body = doJSON(t, r, "POST", "/api/outputs/devices", gin.H{"name": "Gate", "driver": "sim", "enabled": true})
+	require.Equal(t, http.StatusOK, code, body)
+	deviceID := uint(body["ID"].(float64))
+
+	code, body = doJSON(t, r, "POST", "/api/outputs/rules", gin.H{
+		"station_id": 9, "event": "saved", "device_id": deviceID, "channel": 1, "action": "pulse", "enabled": true,
+	})
+	assert.Equal(t, http.StatusBadRequest, code, body)
+	code, body = doJSON(t, r, "POST", "/api/outputs/rules", gin.H{
+		"station_id": 1, "event": "saved", "device_id": deviceID, "channel": 1, "action": "pulse", "pulse_ms": 5000, "enabled": true,
+	})
+	require.Equal(t, http.StatusOK, code, body)
+
+	sim, ok := server.Outputs.Driver(deviceID).(*outputs.Simulated)
+	require.True(t, ok)
+
+	code, body = doJSON(t, r, "POST", "/api/transaction", gin.H{
+		"scale_id": 1, "plate_number": "B 1234 XY", "driver_name": "Budi",
+		"manual": true, "manual_reason": "indikator rusak", "gross": 24500, "tare": 8200,
+	})
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Eventually(t, func() bool { return sim.State(1) }, time.Second, 5*time.Millisecond, "gate not opened")
+
+	// Manual switching is audited
+	code, body = doJSON(t, r, "POST", "/api/outputs/devices/"+itoa(deviceID)+"/switch", gin.H{"channel": 1, "action": "off"})
+	require.Equal(t, http.StatusOK, code, body)
+	assert.False(t, sim.State(1))
+	var count int64
+	server.DB.Model(&models.AuditLog{}).Where("action = ?", "output_switch").Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Deleting the device takes its rules along
+	code, _ = doJSON(t, r, "DELETE", "/api/outputs/devices/"+itoa(deviceID), nil)
+	require.Equal(t, http.StatusOK, code)
+	server.DB.Model(&models.OutputRule{}).Count(&count)
+	assert.Zero(t, count)
+	assert.Nil(t, server.Outputs.Driver(deviceID))
+}
+
+func TestPositionSensorsBlockCapture(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	var station models.WeighingStation
+	require.NoError(t, server.DB.First(&station, 1).Error)
+	station.SensorProtocol = hardware.SensorASCII
+	station.SensorPort = "tcp://" + ln.Addr().String()
+	require.NoError(t, server.DB.Save(&station).Error)
+	server.ScaleMgr.AddOrUpdateScale(station)
+	t.Cleanup(func() { server.ScaleMgr.RemoveScale(station.ID) })
+	server.ScaleMgr.SetSimulatedReading(1, hardware.Reading{Weight: 24500, HasMotion: true, Stable: true}, time.Now())
+
+	// Nothing is captured until the module reports
+	code, body := doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+	require.Equal(t, http.StatusConflict, code, body)
+	assert.Contains(t, body["error"], "Sensor posisi tidak terhubung")
+
+	module, err := ln.Accept()
+	require.NoError(t, err)
+	defer module.Close()
+	report := func(states string, clear bool) {
+		_, err := module.Write([]byte(states + "\r\n"))
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			status, _ := server.ScaleMgr.Status(1)
+			return status.Position.Online && status.Position.Clear() == clear
+		}, 5*time.Second, 5*time.Millisecond)
+	}
+
+	// The trailer's rear wheels are still on the ramp
+	report("01", false)
+	code, body = doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+	require.Equal(t, http.StatusConflict, code, body)
+	assert.Contains(t, body["error"], "sensor posisi 2 terhalang")
+	// Nor can the weight be typed in
+	code, body = doJSON(t, r, "POST", "/api/weighing/first", gin.H{
+		"scale_id": 1, "plate_number": "B 7 TR", "driver_name": "Budi",
+		"manual": true, "manual_reason": "indikator rusak", "weight": 24500,
+	})
+	require.Equal(t, http.StatusConflict, code, body)
+	assert.Contains(t, body["error"], "sensor posisi 2 terhalang")
+
+	report("00", true)
+	code, body = doJSON(t, r, "POST", "/api/scales/1/capture", nil)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, 24500.0, body["weight"])
+}
+
+func TestVehicleTags(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	truck := models.Vehicle{PlateNumber: "B 1234 XY", DriverName: "Budi"}
+	other := models.Vehicle{PlateNumber: "B 5678 ZZ", DriverName: "Andi"}
+	require.NoError(t, server.DB.Create(&truck).Error)
+	require.NoError(t, server.DB.Create(&other).Error)
+
+	code, body := doJSON(t, r, "POST", "/api/vehicles/"+itoa(truck.ID)+"/tags", gin.H{"tag_id": "e2 00 00 17 22 0b", "label": "Stiker kaca"})
+	require.Equal(t, http.StatusCreated, code, body)
+	assert.Equal(t, "E2000017220B", body["tag_id"])
+	tagID := uint(body["ID"].(float64))
+
+	code, body = doJSON(t, r, "POST", "/api/vehicles/"+itoa(other.ID)+"/tags", gin.H{"tag_id": "E2:00:00:17:22:0B"})
+	assert.Equal(t, http.StatusConflict, code, body)
+	code, body = doJSON(t, r, "POST", "/api/vehicles/"+itoa(other.ID)+"/tags", gin.H{"tag_id": "kartu"})
+	assert.Equal(t, http.StatusBadRequest, code, body)
+
+	code, body = doJSON(t, r, "GET", "/api/vehicles/details?tag=e2000017220b", nil)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "B 1234 XY", body["plate_number"])
+
+	// Reads at the station reach the weighing page with the vehicle
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/api/scales/stream")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Eventually(t, func() bool { return server.ScaleMgr.Tags.Len() > 0 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, server.ScaleMgr.PublishTag(1, "E2000017220B"))
+	require.NoError(t, server.ScaleMgr.PublishTag(1, "77881"))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	readTag := func() map[string]any {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		event := ""
+		for {
+			select {
+			case line, ok := <-lines:
+				require.True(t, ok, "stream closed")
+				if name, ok := strings.CutPrefix(line, "event:"); ok {
+					event = name
+				} else if data, ok := strings.CutPrefix(line, "data:"); ok && event == "tag" {
+					var ev map[string]any
+					require.NoError(t, json.Unmarshal([]byte(data), &ev))
+					return ev
+				}
+			case <-timeout:
+				t.Fatal("no tag event")
+			}
+		}
+	}
+	ev := readTag()
+	assert.Equal(t, "E2000017220B", ev["tag"])
+	require.NotNil(t, ev["vehicle"])
+	assert.Equal(t, "B 1234 XY", ev["vehicle"].(map[string]any)["plate_number"])
+	ev = readTag()
+	assert.Equal(t, "0000077881", ev["tag"])
+	assert.Nil(t, ev["vehicle"])
+
+	// A removed tag can go to another vehicle
+	code, _ = doJSON(t, r, "DELETE", "/api/vehicles/"+itoa(truck.ID)+"/tags/"+itoa(tagID), nil)
+	require.Equal(t, http.StatusOK, code)
+	code, body = doJSON(t, r, "POST", "/api/vehicles/"+itoa(other.ID)+"/tags", gin.H{"tag_id": "E2000017220B"})
+	assert.Equal(t, http.StatusCreated, code, body)
+}
+
+func TestKioskWeighing(t *testing.T) {
+	server, r := newWeighingTestServer(t)
+	t.Cleanup(server.Outputs.Close)
+	server.Overload = odol.NewPolicy(5, 50)
+
+	truck := models.Vehicle{PlateNumber: "B 1234 XY", DriverName: "Budi", OwnerCompany: "PT Batu", PermittedGross: 20000}
+	require.NoError(t, server.DB.Create(&truck).Error)
+	require.NoError(t, server.DB.Create(&models.VehicleTag{VehicleID: truck.ID, TagID: "E2000017220B"}).Error)
+
+	code, body := doJSON(t, r, "POST", "/api/outputs/devices", gin.H{"name": "Gate", "driver": "sim", "enabled": true})
+	require.Equal(t, http.StatusOK, code, body)
+	deviceID := uint(body["ID"].(float64))
+	code, body = doJSON(t, r, "POST", "/api/outputs/rules", gin.H{
+		"station_id": 1, "event": "saved", "device_id": deviceID, "channel": 1, "action": "on", "enabled": true,
+	})
+	require.Equal(t, http.StatusOK, code, body)
+	sim := server.Outputs.Driver(deviceID).(*outputs.Simulated)
+
+	var station models.WeighingStation
+	require.NoError(t, server.DB.First(&station, 1).Error)
+	station.AxleMode = true
+	station.KioskMode = kiosk.ModeTwoPass
+	assert.Error(t, server.validateStation(station), "kiosk on an axle station")
+	station.AxleMode = false
+	require.NoError(t, server.validateStation(station))
+	require.NoError(t, server.DB.Save(&station).Error)
+	server.reloadKiosk()
+
+	// pass drives a tagged truck onto the platform until it is weighed
+	t0 := time.Now()
+	pass := func(weight float64) {
+		t.Helper()
+		server.Kiosk.ObserveTag(hardware.TagRead{ScaleID: 1, Tag: "E2000017220B", At: t0}, t0)
+		for i := 0; i <= 4; i++ {
+			d := hardware.ScaleData{ScaleID: 1, Weight: weight, SettledWeight: weight, Stable: true, Connected: true}
+			server.Kiosk.Observe(d, t0.Add(time.Duration(i)*time.Second))
+		}
+	}
+	leave := func() {
+		server.Kiosk.Observe(hardware.ScaleData{ScaleID: 1, Connected: true}, t0.Add(10*time.Second))
+	}
+
+	// Entry: loaded, a PENDING ticket under the kiosk's name
+	pass(24000)
+	var record models.WeighingRecord
+	require.NoError(t, server.DB.Where("plate_number = ?", "B 1234 XY").First(&record).Error)
+	assert.Equal(t, models.StatusPending, record.Status)
+	assert.Equal(t, 24000.0, record.FirstWeight)
+	assert.Equal(t, kiosk.Operator, record.ManagerName)
+	assert.Equal(t, "PT Batu", record.CompanyName)
+	assert.NotEmpty(t, record.CaptureID)
+	assert.Eventually(t, func() bool { return sim.State(1) }, time.Second, 5*time.Millisecond, "gate not opened")
+	leave()
+	require.NoError(t, sim.Set(1, false))
+
+	// Exit: 20% above JBI waits for a supervisor, the gate stays closed
+	pass(8000)
+	var status []kiosk.StationStatus
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/kiosk/status", nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	require.Len(t, status, 1)
+	assert.Equal(t, kiosk.StateEscalated, status[0].State)
+	require.NotNil(t, status[0].Escalation)
+	assert.Equal(t, kiosk.ReasonOverload, status[0].Escalation.Reason)
+	require.NoError(t, server.DB.First(&record, record.ID).Error)
+	assert.Equal(t, models.StatusPending, record.Status)
+
+	code, body = doJSON(t, r, "POST", "/api/kiosk/1/resolve", gin.H{"action": "identify", "plate": "B 1 X"})
+	assert.Equal(t, http.StatusBadRequest, code, body)
+	code, body = doJSON(t, r, "POST", "/api/kiosk/1/resolve", gin.H{"action": "approve"})
+	require.Equal(t, http.StatusOK, code, body)
+	code, _ = doJSON(t, r, "POST", "/api/kiosk/1/resolve", gin.H{"action": "approve"})
+	assert.Equal(t, http.StatusConflict, code)
+
+	require.NoError(t, server.DB.First(&record, record.ID).Error)
+	assert.Equal(t, models.StatusCompleted, record.Status)
+	assert.Equal(t, 16000.0, record.NetWeight)
+	assert.Equal(t, "tester", record.OverloadApprovedBy)
+	assert.NotEmpty(t, record.InvoicePath)
+	assert.Eventually(t, func() bool { return sim.State(1) }, time.Second, 5*time.Millisecond, "gate not opened")
+
+	// The empty pass is the truck's new tare, booked by the kiosk
+	require.NoError(t, server.DB.First(&truck, truck.ID).Error)
+	assert.Equal(t, 8000.0, truck.DefaultTare)
+	var tare models.TareRecord
+	require.NoError(t, server.DB.Where("vehicle_id = ?", truck.ID).First(&tare).Error)
+	assert.Equal(t, kiosk.Operator, tare.Operator)
+
+	for action, username := range map[string]string{
+		"kiosk_arrival": kiosk.Operator, "kiosk_identified": kiosk.Operator, "kiosk_weighed": kiosk.Operator,
+		"kiosk_escalated": kiosk.Operator, "kiosk_resolved": "tester", "overload_approved": kiosk.Operator,
+	} {
+		var count int64
+		server.DB.Model(&models.AuditLog{}).Where("action = ? AND username = ?", action, username).Count(&count)
+		assert.NotZero(t, count, "%s by %s not audited", action, username)
+	}
+}
+
+func TestKioskBookNamedVehicle(t *testing.T) {
+	server, _ := newWeighingTestServer(t)
+	backend := kioskBackend{server}
+	truck := models.Vehicle{PlateNumber: "B 1234 XY", DriverName: "Budi", OwnerCompany: "PT Batu"}
+	require.NoError(t, server.DB.Create(&truck).Error)
+	reading := hardware.ScaleData{ScaleID: 1, Weight: 24000, SettledWeight: 24000, Stable: true, Connected: true}
+
+	// A plate a supervisor typed for a vehicle outside the vehicle master
+	_, err := backend.Book(kiosk.Booking{StationID: 1, Plate: "B 9999 NEW", Reading: reading})
+	var p *kiosk.Problem
+	require.ErrorAs(t, err, &p)
+	assert.Equal(t, kiosk.ReasonUnregistered, p.Reason)
+
+	ticket, err := backend.Book(kiosk.Booking{StationID: 1, Plate: "B 9999 NEW", DriverName: "Andi", Reading: reading})
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, ticket.Status)
+	var record models.WeighingRecord
+	require.NoError(t, server.DB.First(&record, ticket.RecordID).Error)
+	assert.Equal(t, "Andi", record.DriverName)
+
+	// A registered vehicle keeps its master data however the plate was typed
+	ticket, err = backend.Book(kiosk.Booking{StationID: 1, Plate: "b1234xy", Reading: reading})
+	require.NoError(t, err)
+	var registered models.WeighingRecord
+	require.NoError(t, server.DB.First(&registered, ticket.RecordID).Error)
+	assert.Equal(t, "Budi", registered.DriverName)
+	assert.Equal(t, "PT Batu", registered.CompanyName)
+}
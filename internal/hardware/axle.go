@@ -0,0 +1,102 @@
+package hardware
+
+import (
+	"math"
+	"time"
+)
+
+// Defaults used when an axle weighing station leaves its settings empty
+const (
+	DefaultAxleTimeout   = 10 * time.Second
+	DefaultAxleMinWeight = 200.0
+)
+
+// AxlePass is one vehicle driven over a platform shorter than itself,
+// weighed axle by axle. The vehicle weight is the sum of the axles.
+type AxlePass struct {
+	Axles       []float64 `json:"axles"`
+	Total       float64   `json:"total"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// AxleDetector turns a stream of readings into axle passes. Every settled
+// peak after the platform emptied or the load changed counts as one axle;
+// the pass is complete once the platform has stayed empty for Timeout.
+type AxleDetector struct {
+	Timeout   time.Duration
+	MinWeight float64 // Below this the platform counts as empty
+	Tolerance float64 // A settled weight within this of the last axle is the same axle
+
+	current    *AxlePass
+	last       *AxlePass
+	armed      bool
+	peak       float64
+	emptySince time.Time // Zero while something is on the platform
+}
+
+func NewAxleDetector(timeout time.Duration, minWeight, tolerance float64) *AxleDetector {
+	if timeout <= 0 {
+		timeout = DefaultAxleTimeout
+	}
+	if minWeight <= 0 {
+		minWeight = DefaultAxleMinWeight
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultStableTolerance
+	}
+	return &AxleDetector{Timeout: timeout, MinWeight: minWeight, Tolerance: tolerance, armed: true}
+}
+
+// Update feeds one reading with its stability verdict and reports whether
+// it completed a pass (see Last)
+func (d *AxleDetector) Update(weight float64, st StabilityState, now time.Time) bool {
+	empty := weight < d.MinWeight
+	if !empty {
+		d.emptySince = time.Time{}
+	} else if d.emptySince.IsZero() {
+		d.emptySince = now
+	}
+	if empty || math.Abs(weight-d.peak) > d.Tolerance {
+		d.armed = true
+	}
+
+	if d.armed && !empty && st.Stable {
+		if d.current == nil {
+			d.current = &AxlePass{StartedAt: now}
+		}
+		d.current.Axles = append(d.current.Axles, st.Settled)
+		d.current.Total += st.Settled
+		d.armed = false
+		d.peak = st.Settled
+	}
+
+	if d.current != nil && empty && now.Sub(d.emptySince) >= d.Timeout {
+		d.current.CompletedAt = now
+		d.last, d.current = d.current, nil
+		return true
+	}
+	return false
+}
+
+// Current returns the pass in progress, nil when no vehicle is crossing
+func (d *AxleDetector) Current() *AxlePass { return d.current }
+
+// Last returns the latest completed pass that was not taken yet
+func (d *AxleDetector) Last() *AxlePass { return d.last }
+
+// Take returns the latest completed pass and forgets it, so one vehicle
+// cannot be booked twice
+func (d *AxleDetector) Take() *AxlePass {
+	p := d.last
+	d.last = nil
+	return p
+}
+
+// Reset drops the pass in progress, e.g. after a disconnect
+func (d *AxleDetector) Reset() {
+	d.current = nil
+	d.armed = true
+	d.peak = 0
+	d.emptySince = time.Time{}
+}
@@ -0,0 +1,78 @@
+package hardware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAxleDetector(t *testing.T) {
+	d := NewAxleDetector(2*time.Second, 0, 0)
+	stab := NewStabilityDetector(500*time.Millisecond, 0)
+	now := time.Unix(1700000000, 0)
+
+	feed := func(weight float64, dur time.Duration) bool {
+		completed := false
+		for end := now.Add(dur); now.Before(end); now = now.Add(100 * time.Millisecond) {
+			st := stab.Update(Reading{Weight: weight}, now)
+			if d.Update(weight, st, now) {
+				completed = true
+			}
+		}
+		return completed
+	}
+
+	feed(0, time.Second)
+	feed(6000, 2*time.Second) // Steer axle, settles once however long it stays
+	feed(6005, time.Second)   // Within tolerance: same axle
+	feed(0, time.Second)
+	feed(9000, time.Second)
+	feed(17500, time.Second) // Tandem rolls on without the platform emptying
+	if d.Last() != nil {
+		t.Fatal("pass completed while the truck was still crossing")
+	}
+	if p := d.Current(); p == nil || len(p.Axles) != 3 {
+		t.Fatalf("current pass %+v", p)
+	}
+	if !feed(0, 3*time.Second) {
+		t.Fatal("pass not completed after the timeout")
+	}
+
+	pass := d.Take()
+	if pass == nil || len(pass.Axles) != 3 || pass.Total != 6000+9000+17500 {
+		t.Fatalf("pass %+v", pass)
+	}
+	if d.Take() != nil {
+		t.Error("a pass can only be taken once")
+	}
+
+	// Noise on an empty platform never counts as an axle
+	feed(150, 3*time.Second)
+	if d.Current() != nil || d.Last() != nil {
+		t.Error("empty platform started a pass")
+	}
+}
+
+func TestAxleCrossingScenario(t *testing.T) {
+	sc, err := LoadScenario("axle_crossing", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := sc.Player()
+	stab := NewStabilityDetector(0, 0)
+	d := NewAxleDetector(0, 0, stab.Tolerance)
+	t0 := time.Unix(1700000000, 0)
+
+	for at := time.Duration(0); at < player.Duration(); at += sc.Interval {
+		r := player.At(at).Reading
+		if d.Update(r.Weight, stab.Update(r, t0.Add(at)), t0.Add(at)) {
+			break
+		}
+	}
+	pass := d.Last()
+	if pass == nil || len(pass.Axles) != 3 {
+		t.Fatalf("pass %+v", pass)
+	}
+	if pass.Total < 24400 || pass.Total > 24600 {
+		t.Errorf("pass total %v, want ~24500", pass.Total)
+	}
+}
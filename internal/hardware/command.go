@@ -0,0 +1,157 @@
+package hardware
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Command is an action the indicator performs on request
+type Command string
+
+const (
+	CmdZero  Command = "zero"  // Re-zero the empty platform
+	CmdTare  Command = "tare"  // Store the current load as tare, switching to net
+	CmdPrint Command = "print" // Transmit/print the current weight
+)
+
+// ParseCommand validates a command name from an API request
+func ParseCommand(name string) (Command, error) {
+	switch cmd := Command(strings.ToLower(strings.TrimSpace(name))); cmd {
+	case CmdZero, CmdTare, CmdPrint:
+		return cmd, nil
+	default:
+		return "", fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// Commander is implemented by drivers whose indicator accepts commands
+// on the same line it streams weights on
+type Commander interface {
+	Encode(cmd Command) ([]byte, error)
+}
+
+// DefaultCommandTimeout is how long SendCommand waits for frames confirming the command
+const DefaultCommandTimeout = 3 * time.Second
+
+var (
+	ErrNotConnected       = errors.New("scale not connected")
+	ErrCommandUnsupported = errors.New("protocol does not support commands")
+	ErrNotConfirmed       = errors.New("command not confirmed by the indicator")
+)
+
+// asciiCommand encodes the common single letter commands (Z, T, P)
+func asciiCommand(cmd Command, terminator string) ([]byte, error) {
+	switch cmd {
+	case CmdZero:
+		return []byte("Z" + terminator), nil
+	case CmdTare:
+		return []byte("T" + terminator), nil
+	case CmdPrint:
+		return []byte("P" + terminator), nil
+	}
+	return nil, ErrCommandUnsupported
+}
+
+// SendCommand encodes a command with the station's driver and writes it
+// to the open port. It does not wait for confirmation, see
+// ScaleManager.SendCommand.
+func (c *ScaleConnection) SendCommand(cmd Command) error {
+	commander, ok := c.Driver.(Commander)
+	if !ok {
+		return ErrCommandUnsupported
+	}
+	payload, err := commander.Encode(cmd)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	port := c.Port
+	if port == nil {
+		return ErrNotConnected
+	}
+	_, err = port.Write(payload)
+	return err
+}
+
+// confirms reports whether a frame received after cmd shows it took
+// effect, compared to the reading before the command. Zero and tare must
+// bring the weight to zero; a platform already reading near zero only
+// counts once it shows exactly zero. The gross/net flag is only checked
+// for drivers reporting it.
+func confirms(cmd Command, before, data ScaleData, tolerance float64, hasMode bool) bool {
+	if !data.Connected || data.Overload {
+		return false
+	}
+	var want WeighMode
+	switch cmd {
+	case CmdZero:
+		want = ModeGross
+	case CmdTare:
+		want = ModeNet
+	default:
+		// Print only needs the indicator to keep talking
+		return true
+	}
+	limit := tolerance
+	if math.Abs(before.Weight) <= tolerance {
+		limit = 0
+	}
+	if math.Abs(data.Weight) > limit {
+		return false
+	}
+	return !hasMode || data.Mode == want
+}
+
+// SendCommand sends a command to a scale and waits up to timeout for
+// frames confirming it: zero and tare must bring the reading back to
+// zero (tare also switches to net), see confirms. It returns the confirming reading, or
+// the last one with ErrNotConfirmed. A summing station passes the command
+// on to every deck and is confirmed by the sum.
+func (sm *ScaleManager) SendCommand(scaleID uint, cmd Command, timeout time.Duration) (ScaleData, error) {
+	sm.Mu.Lock()
+	conn, ok := sm.Scales[scaleID]
+	if !ok || !conn.Connected {
+		sm.Mu.Unlock()
+		return ScaleData{}, ErrNotConnected
+	}
+	before := conn.data(time.Now())
+	last := before
+	tolerance := conn.stability.Tolerance
+	hasMode := conn.LastReading.HasMode
+	targets := []*ScaleConnection{conn}
+	if conn.Config.Summing {
+		targets = sm.decks(scaleID)
+	}
+	sm.Mu.Unlock()
+
+	// Subscribe before writing so the answer cannot slip past
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+
+	for _, target := range targets {
+		if err := target.SendCommand(cmd); err != nil {
+			return last, err
+		}
+	}
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case data := <-events.C:
+			if data.ScaleID != scaleID {
+				continue
+			}
+			last = data
+			if confirms(cmd, before, data, tolerance, hasMode) {
+				return data, nil
+			}
+		case <-deadline:
+			return last, ErrNotConfirmed
+		}
+	}
+}
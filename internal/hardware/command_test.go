@@ -0,0 +1,189 @@
+package hardware
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+)
+
+func TestSendCommandConfirmed(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+	sm.AddOrUpdateScale(models.WeighingStation{
+		Model:     gorm.Model{ID: 3},
+		ScalePort: "tcp://" + ln.Addr().String(),
+		Protocol:  ProtocolAND,
+	})
+	defer sm.RemoveScale(3)
+
+	indicator, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indicator.Close()
+
+	// Empty platform drifted to 40 kg
+	indicator.Write([]byte("ST,GS,+0000040kg\r\n"))
+	waitForWeight(t, events, 40)
+
+	// The indicator answers Z by re-zeroing, T by switching to net
+	go func() {
+		lines := bufio.NewScanner(indicator)
+		for lines.Scan() {
+			switch lines.Text() {
+			case "Z":
+				indicator.Write([]byte("ST,GS,+0000000kg\r\n"))
+			case "T":
+				indicator.Write([]byte("ST,NT,+0000000kg\r\n"))
+			}
+		}
+	}()
+
+	data, err := sm.SendCommand(3, CmdZero, time.Second)
+	if err != nil {
+		t.Fatalf("zero: %v (last %+v)", err, data)
+	}
+	if data.Weight != 0 || data.Mode != ModeGross {
+		t.Errorf("zero confirmed by %+v", data)
+	}
+
+	data, err = sm.SendCommand(3, CmdTare, time.Second)
+	if err != nil {
+		t.Fatalf("tare: %v (last %+v)", err, data)
+	}
+	if data.Mode != ModeNet {
+		t.Errorf("tare confirmed by %+v", data)
+	}
+}
+
+// Indicators without a gross/net flag read gross after a tare too
+func TestSendCommandGeneric(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+	sm.AddOrUpdateScale(models.WeighingStation{
+		Model:     gorm.Model{ID: 4},
+		ScalePort: "tcp://" + ln.Addr().String(),
+		Protocol:  ProtocolGeneric,
+	})
+	defer sm.RemoveScale(4)
+
+	indicator, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indicator.Close()
+
+	// Loaded container on the platform, tare brings it to zero
+	indicator.Write([]byte("ST +0000850 kg\r\n"))
+	waitForWeight(t, events, 850)
+	commands := make(chan string, 4)
+	go func() {
+		lines := bufio.NewScanner(indicator)
+		for lines.Scan() {
+			commands <- lines.Text()
+			if lines.Text() == "T" {
+				indicator.Write([]byte("ST +0000000 kg\r\n"))
+			}
+		}
+	}()
+
+	data, err := sm.SendCommand(4, CmdTare, time.Second)
+	if err != nil {
+		t.Fatalf("tare: %v (last %+v)", err, data)
+	}
+	if data.Weight != 0 {
+		t.Errorf("tare confirmed by %+v", data)
+	}
+
+	// Zero of a platform drifted within tolerance, which the indicator ignores
+	indicator.Write([]byte("ST +0000010 kg\r\n"))
+	waitForWeight(t, events, 10)
+	go func() {
+		<-commands
+		<-commands
+		indicator.Write([]byte("ST +0000010 kg\r\n"))
+	}()
+	if data, err := sm.SendCommand(4, CmdZero, 300*time.Millisecond); err != ErrNotConfirmed {
+		t.Errorf("ignored zero: got %v (last %+v)", err, data)
+	}
+}
+
+func TestCommandConfirmation(t *testing.T) {
+	generic, _ := NewGenericDriver("")
+	flagged, _ := NewGenericDriver(`(?P<mode>GS|NT)\s*(?P<weight>\d+)`)
+	modbus, _ := NewModbusDriver(models.WeighingStation{ModbusDataType: ModbusInt16}, false)
+	parse := func(d Driver, frame string) (ScaleData, bool) {
+		r, err := d.Parse([]byte(frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ScaleData{Weight: r.Weight, Mode: r.Mode, Connected: true}, r.HasMode
+	}
+
+	loaded := ScaleData{Weight: 8000, Mode: ModeGross, Connected: true}
+	drifted := ScaleData{Weight: 10, Mode: ModeGross, Connected: true}
+	for _, tt := range []struct {
+		name   string
+		cmd    Command
+		before ScaleData
+		driver Driver
+		frame  string
+		want   bool
+	}{
+		{"generic tare", CmdTare, loaded, generic, "0", true},
+		{"generic tare ignored", CmdTare, loaded, generic, "8000", false},
+		{"generic zero of drift", CmdZero, drifted, generic, "0", true},
+		{"generic zero ignored", CmdZero, drifted, generic, "10", false},
+		{"flagged tare", CmdTare, loaded, flagged, "NT 0", true},
+		{"flagged tare still gross", CmdTare, loaded, flagged, "GS 0", false},
+		{"flagged zero in net", CmdZero, drifted, flagged, "NT 0", false},
+		{"modbus tare", CmdTare, loaded, modbus, "\x00\x00", true},
+		{"modbus zero ignored", CmdZero, drifted, modbus, "\x00\x0a", false},
+	} {
+		data, hasMode := parse(tt.driver, tt.frame)
+		if got := confirms(tt.cmd, tt.before, data, DefaultStableTolerance, hasMode); got != tt.want {
+			t.Errorf("%s: confirmed %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSendCommandErrors(t *testing.T) {
+	sm := newTestManager()
+	if _, err := sm.SendCommand(9, CmdZero, time.Second); err != ErrNotConnected {
+		t.Errorf("unknown scale: got %v", err)
+	}
+
+	// Rinstrun output format has no command set here
+	conn := newScaleConnection(models.WeighingStation{Protocol: ProtocolRinstrun})
+	if err := conn.SendCommand(CmdZero); err != ErrCommandUnsupported {
+		t.Errorf("got %v, want ErrCommandUnsupported", err)
+	}
+
+	// Modbus stations are only polled
+	conn = newScaleConnection(models.WeighingStation{Protocol: ProtocolModbusTCP})
+	if err := conn.SendCommand(CmdTare); err != ErrCommandUnsupported {
+		t.Errorf("modbus: got %v, want ErrCommandUnsupported", err)
+	}
+
+	if _, err := ParseCommand("explode"); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
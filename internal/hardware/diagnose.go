@@ -0,0 +1,207 @@
+package hardware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"go.bug.st/serial/enumerator"
+	"stoneweigh/internal/models"
+)
+
+// MaxDiagnoseDuration bounds a diagnostics session
+const MaxDiagnoseDuration = 30 * time.Second
+
+// PortInfo is a serial port found on this machine
+type PortInfo struct {
+	Name         string `json:"name"`
+	IsUSB        bool   `json:"is_usb"`
+	VID          string `json:"vid,omitempty"`
+	PID          string `json:"pid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	Product      string `json:"product,omitempty"`
+	InUseBy      uint   `json:"in_use_by,omitempty"` // Station currently reading this port
+}
+
+// ListPorts enumerates the serial ports of this machine, with the USB
+// identifiers of USB adapters and the station using each port, if any
+func (sm *ScaleManager) ListPorts() ([]PortInfo, error) {
+	details, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]PortInfo, 0, len(details))
+	for _, d := range details {
+		p := PortInfo{
+			Name:         d.Name,
+			IsUSB:        d.IsUSB,
+			VID:          d.VID,
+			PID:          d.PID,
+			SerialNumber: d.SerialNumber,
+			Product:      d.Product,
+		}
+		p.InUseBy, _ = sm.PortUser(d.Name)
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Name < ports[j].Name })
+	return ports, nil
+}
+
+// PortUser returns the managed station that owns a port, as its scale, tag
+// reader or position sensor port. Summing stations and demo-simulated stations do not
+// open their scale port.
+func (sm *ScaleManager) PortUser(port string) (uint, bool) {
+	port = strings.TrimSpace(port)
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	for id, conn := range sm.Scales {
+		if conn.Config.Summing || sm.scenarioFor(conn.Config) != "" {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(conn.Config.ScalePort), port) {
+			return id, true
+		}
+	}
+	for id, r := range sm.readers {
+		if strings.EqualFold(strings.TrimSpace(r.settings.Port), port) {
+			return id, true
+		}
+	}
+	for id, s := range sm.sensors {
+		if strings.EqualFold(strings.TrimSpace(s.settings.Port), port) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// DiagFrame is one frame seen during a diagnostics session: the raw bytes
+// as received and what the protocol driver made of them
+type DiagFrame struct {
+	At      time.Time `json:"at"`
+	Raw     string    `json:"raw"` // Printable, control bytes escaped
+	Hex     string    `json:"hex"`
+	Reading *Reading  `json:"reading,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// ErrPortInUse is returned by Diagnose for the port of a running station
+var ErrPortInUse = errors.New("port is in use by a running station")
+
+// Diagnose opens a port with the given station settings, outside the
+// manager, and reports every frame to out until ctx is done or the link
+// drops. Ports of running stations are refused so diagnostics never steal
+// their data.
+func (sm *ScaleManager) Diagnose(ctx context.Context, st models.WeighingStation, out func(DiagFrame)) error {
+	if id, used := sm.PortUser(st.ScalePort); used {
+		return fmt.Errorf("%w (station %d)", ErrPortInUse, id)
+	}
+	if err := ValidateStation(st); err != nil {
+		return err
+	}
+	if st.Summing {
+		return errors.New("a summing station has no port of its own")
+	}
+	driver, _ := NewDriver(st)
+	split, _ := splitFuncFor(st.Terminator)
+	if split == nil {
+		split = driver.SplitFunc()
+	}
+	transport, _ := NewTransport(st)
+	defer transport.Close()
+
+	// Open may block (tcp-listen waits for the indicator): give it the context
+	opened := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			transport.Close()
+		case <-opened:
+		}
+	}()
+	port, err := transport.Open()
+	close(opened)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	// Closing the port unblocks the reads below when time is up
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		port.Close()
+	}()
+
+	if poller, ok := driver.(Poller); ok {
+		return diagnosePoll(ctx, poller, port, out)
+	}
+
+	scanner := bufio.NewScanner(port)
+	scanner.Split(split)
+	for scanner.Scan() {
+		frame := diagFrame(scanner.Bytes())
+		reading, err := driver.Parse(scanner.Bytes())
+		if err != nil {
+			frame.Error = err.Error()
+		} else {
+			frame.Reading = &reading
+		}
+		out(frame)
+	}
+	if ctx.Err() != nil {
+		return nil // Time is up, not a link error
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// diagnosePoll queries a request/response device on its interval. Only the
+// decoded reading is available: the poller consumes the raw answer.
+func diagnosePoll(ctx context.Context, poller Poller, port io.ReadWriter, out func(DiagFrame)) error {
+	ticker := time.NewTicker(poller.Interval())
+	defer ticker.Stop()
+	for {
+		reading, err := poller.Poll(port)
+		if ctx.Err() != nil {
+			return nil
+		}
+		frame := DiagFrame{At: time.Now()}
+		if err == nil {
+			frame.Reading = &reading
+		} else if errors.Is(err, ErrInvalidFrame) {
+			frame.Error = err.Error()
+		} else {
+			return err
+		}
+		out(frame)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func diagFrame(b []byte) DiagFrame {
+	quoted := fmt.Sprintf("%q", b)
+	return DiagFrame{
+		At:  time.Now(),
+		Raw: quoted[1 : len(quoted)-1],
+		Hex: fmt.Sprintf("% X", b),
+	}
+}
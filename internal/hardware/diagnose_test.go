@@ -0,0 +1,92 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+)
+
+func TestDiagnose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("garbage\r\nST,GS,+0012340kg\r\n"))
+		conn.Close()
+	}()
+
+	sm := newTestManager()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var frames []DiagFrame
+	err = sm.Diagnose(ctx, models.WeighingStation{ScalePort: "tcp://" + ln.Addr().String(), Protocol: ProtocolAND},
+		func(f DiagFrame) { frames = append(frames, f) })
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF when the indicator hangs up, got %v", err)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("frames: %+v", frames)
+	}
+	if frames[0].Raw != "garbage" || frames[0].Error == "" || frames[0].Reading != nil {
+		t.Errorf("bad frame: %+v", frames[0])
+	}
+	if frames[1].Reading == nil || frames[1].Reading.Weight != 12340 || frames[1].Hex[:8] != "53 54 2C" {
+		t.Errorf("good frame: %+v", frames[1])
+	}
+}
+
+func TestDiagnoseTimeout(t *testing.T) {
+	sm := newTestManager()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Nobody ever connects: the session ends with the context, without error
+	start := time.Now()
+	err := sm.Diagnose(ctx, models.WeighingStation{ScalePort: "tcp-listen://127.0.0.1:0"}, func(DiagFrame) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("diagnostics outlived its context")
+	}
+}
+
+func TestDiagnoseRefusesRunningStation(t *testing.T) {
+	sm := newTestManager()
+	st := models.WeighingStation{Model: gorm.Model{ID: 4}, ScalePort: "tcp-listen://127.0.0.1:0"}
+	sm.AddOrUpdateScale(st)
+	defer sm.RemoveScale(4)
+
+	err := sm.Diagnose(context.Background(), st, func(DiagFrame) {})
+	if !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("expected ErrPortInUse, got %v", err)
+	}
+
+	// The tag reader and the position sensors of a station read their own ports
+	sm.AddOrUpdateScale(models.WeighingStation{Model: gorm.Model{ID: 5}, ScalePort: "tcp://127.0.0.1:1",
+		ReaderProtocol: ReaderASCII, ReaderPort: "tcp://127.0.0.1:2",
+		SensorProtocol: SensorASCII, SensorPort: "tcp://127.0.0.1:3"})
+	defer sm.RemoveScale(5)
+	for _, port := range []string{"tcp://127.0.0.1:2", "tcp://127.0.0.1:3"} {
+		if id, used := sm.PortUser(port); !used || id != 5 {
+			t.Errorf("%s used by %d, %v", port, id, used)
+		}
+	}
+	err = sm.Diagnose(context.Background(), models.WeighingStation{ScalePort: "tcp://127.0.0.1:2"}, func(DiagFrame) {})
+	if !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("reader port: expected ErrPortInUse, got %v", err)
+	}
+}
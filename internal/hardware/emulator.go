@@ -0,0 +1,199 @@
+package hardware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"stoneweigh/internal/models"
+)
+
+// Framer is implemented by drivers that can also produce their protocol's
+// frames, so the scale emulator can stand in for a real indicator
+type Framer interface {
+	Frame(r Reading) []byte
+}
+
+// NewFramer returns the frame encoder for a protocol key
+func NewFramer(protocol string) (Framer, error) {
+	d, err := NewDriver(models.WeighingStation{Protocol: protocol})
+	if err != nil {
+		return nil, err
+	}
+	f, ok := d.(Framer)
+	if !ok {
+		return nil, fmt.Errorf("protocol %q cannot be emulated", protocol)
+	}
+	return f, nil
+}
+
+// Emulator impersonates a weighing indicator: it streams frames of a
+// scenario's weight and obeys zero and tare commands like the real thing.
+// It keeps its own zero offset, tare and motion detection, so the
+// indicator side of the protocol (status bits, net mode) is exercised too.
+type Emulator struct {
+	Framer   Framer
+	Interval time.Duration // Frame period, defaults to the scenario interval
+
+	mu        sync.Mutex
+	player    *ScenarioPlayer
+	start     time.Time
+	stability *StabilityDetector
+	zero      float64 // Raw weight captured by the last zero
+	tare      float64
+	net       bool
+	last      Reading
+	connected bool
+}
+
+func NewEmulator(framer Framer, sc *Scenario) *Emulator {
+	return &Emulator{
+		Framer:    framer,
+		Interval:  sc.Interval,
+		player:    sc.Player(),
+		start:     time.Now(),
+		stability: NewStabilityDetector(0, 0),
+	}
+}
+
+// Step advances the emulated indicator to now and returns what it
+// displays. ok is false while the scenario has the indicator offline.
+func (e *Emulator) Step(now time.Time) (r Reading, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sample := e.player.At(now.Sub(e.start))
+	if !sample.Connected {
+		e.stability.Reset()
+		e.connected = false
+		return Reading{}, false
+	}
+	r = sample.Reading
+	r.Stable = e.stability.Update(r, now).Stable && !r.Overload
+	r.HasMotion, r.HasMode = true, true
+
+	r.Weight -= e.zero
+	r.Mode = ModeGross
+	if e.net {
+		r.Weight -= e.tare
+		r.Mode = ModeNet
+	}
+	r.Weight = math.Round(r.Weight)
+	if r.Weight == 0 {
+		r.Weight = 0 // No "-0000000" frames
+	}
+	r.Negative = r.Weight < 0
+	e.last, e.connected = r, true
+	return r, true
+}
+
+// Apply executes a command the way indicators do: zero needs a stable
+// gross reading, tare a stable one and a tare on an empty platform
+// clears it. It reports whether the command was accepted.
+func (e *Emulator) Apply(cmd Command) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.connected || !e.last.Stable {
+		return false
+	}
+	switch cmd {
+	case CmdZero:
+		if e.net {
+			return false
+		}
+		e.zero += e.last.Weight
+	case CmdTare:
+		gross := e.last.Weight
+		if e.net {
+			gross += e.tare
+		}
+		if gross <= 0 {
+			e.net, e.tare = false, 0
+		} else {
+			e.net, e.tare = true, gross
+		}
+	}
+	return true
+}
+
+// parseEmulatorCommand maps the single letter commands sent by
+// asciiCommand back to a Command
+func parseEmulatorCommand(line []byte) (Command, bool) {
+	switch strings.ToUpper(strings.TrimSpace(string(line))) {
+	case "Z":
+		return CmdZero, true
+	case "T":
+		return CmdTare, true
+	case "P":
+		return CmdPrint, true
+	}
+	return "", false
+}
+
+// Serve streams frames to rw every Interval and executes the commands
+// read back from it, until stop is closed or the connection fails.
+// A print command sends an extra frame right away. The command reader
+// only returns once rw is closed, so the caller closes rw after Serve.
+func (e *Emulator) Serve(rw io.ReadWriter, stop <-chan struct{}) error {
+	printNow := make(chan struct{}, 1)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(rw)
+		scanner.Split(splitCRorLF)
+		for scanner.Scan() {
+			cmd, ok := parseEmulatorCommand(scanner.Bytes())
+			if !ok {
+				continue
+			}
+			if cmd == CmdPrint || e.Apply(cmd) {
+				select {
+				case printNow <- struct{}{}:
+				default:
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			readErr <- err
+			return
+		}
+		readErr <- io.EOF
+	}()
+
+	interval := e.Interval
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	deadliner, _ := rw.(interface{ SetWriteDeadline(time.Time) error })
+	for {
+		select {
+		case <-stop:
+			return nil
+		case err := <-readErr:
+			return err
+		case <-ticker.C:
+		case <-printNow:
+		}
+
+		r, ok := e.Step(time.Now())
+		if !ok {
+			continue
+		}
+		if deadliner != nil {
+			// Nobody reading (pty without client): drop the frame
+			// instead of blocking, as a real indicator would
+			deadliner.SetWriteDeadline(time.Now().Add(interval))
+		}
+		if _, err := rw.Write(e.Framer.Frame(r)); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package hardware
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/pty"
+)
+
+// fixedScenario holds a constant weight, like a loaded truck parked on the deck
+func fixedScenario(weight float64) *Scenario {
+	return &Scenario{
+		Unit:     "kg",
+		Interval: 20 * time.Millisecond,
+		Loop:     true,
+		Steps:    []ScenarioStep{{Action: ActionHold, Weight: &weight, Duration: time.Hour}},
+	}
+}
+
+func TestFramesRoundTrip(t *testing.T) {
+	readings := []Reading{
+		{Weight: 24500, Unit: "kg", Mode: ModeGross, Stable: true},
+		{Weight: -120, Unit: "kg", Mode: ModeGross, Negative: true},
+		{Weight: 0, Unit: "kg", Mode: ModeNet, Stable: true},
+	}
+	for _, protocol := range []string{ProtocolToledo, ProtocolAND, ProtocolGeneric} {
+		framer, err := NewFramer(protocol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		driver := framer.(Driver)
+		for _, want := range readings {
+			got, err := driver.Parse(trimFrame(protocol, framer.Frame(want)))
+			if err != nil {
+				t.Fatalf("%s %+v: %v", protocol, want, err)
+			}
+			if got.Weight != want.Weight {
+				t.Errorf("%s: weight %v, want %v", protocol, got.Weight, want.Weight)
+			}
+			if protocol != ProtocolGeneric && (got.Mode != want.Mode || got.Stable != want.Stable || got.Unit != want.Unit) {
+				t.Errorf("%s: got %+v, want %+v", protocol, got, want)
+			}
+		}
+	}
+
+	if _, err := NewFramer(ProtocolRinstrun); err == nil {
+		t.Error("rinstrun has no framer, expected error")
+	}
+}
+
+// trimFrame strips the line terminator the way the driver's SplitFunc does
+func trimFrame(protocol string, frame []byte) []byte {
+	if protocol == ProtocolToledo {
+		return frame
+	}
+	return frame[:len(frame)-2]
+}
+
+func TestEmulatorCommands(t *testing.T) {
+	framer, _ := NewFramer(ProtocolAND)
+	e := NewEmulator(framer, fixedScenario(5000))
+	now := e.start
+
+	if r, _ := e.Step(now); r.Stable || e.Apply(CmdZero) {
+		t.Fatal("zero must be refused while in motion")
+	}
+	for i := 0; i < 20; i++ {
+		now = now.Add(100 * time.Millisecond)
+		e.Step(now)
+	}
+
+	if !e.Apply(CmdTare) {
+		t.Fatal("tare refused on a stable load")
+	}
+	if r, _ := e.Step(now.Add(100 * time.Millisecond)); r.Weight != 0 || r.Mode != ModeNet {
+		t.Fatalf("after tare: %+v", r)
+	}
+	if e.Apply(CmdZero) {
+		t.Error("zero must be refused in net mode")
+	}
+	if !e.Apply(CmdTare) {
+		t.Fatal("second tare refused")
+	}
+	// Tare with the load still on re-tares, it does not clear
+	if r, _ := e.Step(now.Add(200 * time.Millisecond)); r.Weight != 0 || r.Mode != ModeNet {
+		t.Fatalf("after re-tare: %+v", r)
+	}
+}
+
+func TestEmulatorOverPTY(t *testing.T) {
+	master, slave, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pty available: %v", err)
+	}
+	defer slave.Close()
+	defer master.Close()
+
+	framer, _ := NewFramer(ProtocolToledo)
+	emu := NewEmulator(framer, fixedScenario(4200))
+	emu.stability = NewStabilityDetector(100*time.Millisecond, 0)
+	stop := make(chan struct{})
+	defer close(stop)
+	go emu.Serve(master, stop)
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+	sm.AddOrUpdateScale(models.WeighingStation{
+		Model:     gorm.Model{ID: 7},
+		ScalePort: slave.Name(),
+		Protocol:  ProtocolToledo,
+	})
+	defer sm.RemoveScale(7)
+
+	settled := time.Now().Add(5 * time.Second)
+	for data := waitForWeight(t, events, 4200); !data.Stable; data = waitForWeight(t, events, 4200) {
+		if time.Now().After(settled) {
+			t.Fatal("emulated indicator never reported stable")
+		}
+	}
+	data, err := sm.SendCommand(7, CmdZero, DefaultCommandTimeout)
+	if err != nil {
+		t.Fatalf("zero over the serial path: %v (last %+v)", err, data)
+	}
+	if data.Weight != 0 || data.Mode != ModeGross {
+		t.Errorf("after zero: %+v", data)
+	}
+}
@@ -0,0 +1,101 @@
+package hardware
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	stx = 0x02
+	etx = 0x03
+	cr  = '\r'
+	lf  = '\n'
+)
+
+// Terminators accepted in WeighingStation.Terminator.
+// Empty means "use the protocol driver's own framing".
+const (
+	TerminatorCR     = "CR"
+	TerminatorLF     = "LF"
+	TerminatorCRLF   = "CRLF"
+	TerminatorSTXETX = "STX_ETX"
+)
+
+// maxFrameLen bounds garbage accumulation when a terminator never arrives
+const maxFrameLen = 1024
+
+// splitCRorLF splits on CR, LF or CRLF and drops empty frames.
+// Most ASCII indicators end frames with one of the three.
+func splitCRorLF(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < len(data) && (data[start] == cr || data[start] == lf) {
+		start++
+	}
+	if i := bytes.IndexAny(data[start:], "\r\n"); i >= 0 {
+		return start + i + 1, data[start : start+i], nil
+	}
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil
+	}
+	if len(data)-start > maxFrameLen {
+		return len(data), nil, nil
+	}
+	return start, nil, nil
+}
+
+// splitSTXETX returns the payload between STX and ETX, discarding anything
+// outside a frame (noise, checksum bytes trailing the ETX).
+func splitSTXETX(data []byte, atEOF bool) (int, []byte, error) {
+	start := bytes.IndexByte(data, stx)
+	if start < 0 {
+		return len(data), nil, nil
+	}
+	if end := bytes.IndexByte(data[start+1:], etx); end >= 0 {
+		return start + 1 + end + 1, data[start+1 : start+1+end], nil
+	}
+	if len(data)-start > maxFrameLen {
+		return len(data), nil, nil
+	}
+	return start, nil, nil
+}
+
+// splitOn returns a split function cutting frames at delim, dropping empty frames
+func splitOn(delim []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		start := 0
+		for bytes.HasPrefix(data[start:], delim) {
+			start += len(delim)
+		}
+		if i := bytes.Index(data[start:], delim); i >= 0 {
+			return start + i + len(delim), data[start : start+i], nil
+		}
+		if atEOF && start < len(data) {
+			return len(data), data[start:], nil
+		}
+		if len(data)-start > maxFrameLen {
+			return len(data), nil, nil
+		}
+		return start, nil, nil
+	}
+}
+
+// splitFuncFor maps a terminator setting to its split function.
+// It returns nil for an empty terminator so the driver's framing is used.
+func splitFuncFor(terminator string) (bufio.SplitFunc, error) {
+	switch strings.ToUpper(strings.TrimSpace(terminator)) {
+	case "":
+		return nil, nil
+	case TerminatorCR:
+		return splitOn([]byte{cr}), nil
+	case TerminatorLF:
+		return splitOn([]byte{lf}), nil
+	case TerminatorCRLF:
+		return splitOn([]byte{cr, lf}), nil
+	case TerminatorSTXETX:
+		return splitSTXETX, nil
+	default:
+		return nil, fmt.Errorf("unknown frame terminator %q", terminator)
+	}
+}
@@ -0,0 +1,182 @@
+package hardware
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Defaults for the health watchdog
+const (
+	DefaultSilentAfter = 30 * time.Second // No frame from a connected scale
+	DefaultStuckAfter  = 30 * time.Minute // Same non-zero weight without any change
+)
+
+// Health event kinds
+const (
+	HealthConnected    = "connected"
+	HealthDisconnected = "disconnected"
+	HealthSilent       = "silent"
+	HealthStuck        = "stuck"
+	HealthRecovered    = "recovered"
+)
+
+// HealthEvent is a change in a scale's health, published on
+// ScaleManager.HealthEvents for persistence and alerting
+type HealthEvent struct {
+	ScaleID uint      `json:"scale_id"`
+	Kind    string    `json:"kind"`
+	Detail  string    `json:"detail,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Alert reports whether the event needs an operator's attention
+func (e HealthEvent) Alert() bool {
+	return e.Kind == HealthSilent || e.Kind == HealthStuck
+}
+
+// Health is the link quality of one scale since the manager started.
+// Counters survive configuration reloads of the station.
+type Health struct {
+	ScaleID        uint      `json:"scale_id"`
+	Connected      bool      `json:"connected"`
+	ConnectedSince time.Time `json:"connected_since,omitempty"`
+	Connects       uint64    `json:"connects"`
+	Disconnects    uint64    `json:"disconnects"`
+	Frames         uint64    `json:"frames"`       // Frames decoded into a reading
+	ParseErrors    uint64    `json:"parse_errors"` // Frames the driver rejected: noise, partial, bad checksum
+	LastFrameAt    time.Time `json:"last_frame_at,omitempty"`
+	LastChangeAt   time.Time `json:"last_change_at,omitempty"` // Last time the weight moved
+	LastError      string    `json:"last_error,omitempty"`
+	Silent         bool      `json:"silent"`
+	Stuck          bool      `json:"stuck"`
+}
+
+// ErrorRate returns the share of rejected frames, 0..1
+func (h Health) ErrorRate() float64 {
+	total := h.Frames + h.ParseErrors
+	if total == 0 {
+		return 0
+	}
+	return float64(h.ParseErrors) / float64(total)
+}
+
+// frame counts a decoded reading. Callers must hold ScaleManager.Mu.
+func (c *ScaleConnection) frame(weight float64, now time.Time) {
+	if c.health.Frames == 0 || weight != c.LastWeight {
+		c.health.LastChangeAt = now
+	}
+	c.health.Frames++
+	c.health.LastFrameAt = now
+}
+
+// frameError counts a frame the driver could not decode
+func (sm *ScaleManager) frameError(conn *ScaleConnection, err error) {
+	sm.Mu.Lock()
+	conn.health.ParseErrors++
+	conn.health.LastError = err.Error()
+	sm.Mu.Unlock()
+}
+
+// linkChanged records a connect or disconnect and publishes it.
+// Callers must hold sm.Mu.
+func (sm *ScaleManager) linkChanged(conn *ScaleConnection, connected bool, detail string, now time.Time) {
+	h := &conn.health
+	kind := HealthDisconnected
+	if connected {
+		kind = HealthConnected
+		h.Connects++
+		h.ConnectedSince = now
+		h.LastFrameAt = now // The silence clock starts with the link
+	} else {
+		h.Disconnects++
+		h.ConnectedSince = time.Time{}
+		h.LastError = detail
+	}
+	h.Silent, h.Stuck = false, false
+	sm.healthEvent(conn.Config.ID, kind, detail, now)
+}
+
+// healthEvent publishes an event. Callers must hold sm.Mu.
+func (sm *ScaleManager) healthEvent(scaleID uint, kind, detail string, now time.Time) {
+	e := HealthEvent{ScaleID: scaleID, Kind: kind, Detail: detail, At: now}
+	if e.Alert() {
+		log.Printf("[ALERT] Scale %d %s: %s", scaleID, kind, detail)
+	}
+	sm.HealthEvents.Publish(e)
+}
+
+// CheckHealth raises silent and stuck alerts, and clears them once the
+// scale talks or moves again. A scale is silent when it is connected but
+// sent no frame for SilentAfter, and stuck when it shows the same non-zero
+// weight for StuckAfter; an empty platform may legitimately read 0 all night.
+func (sm *ScaleManager) CheckHealth(now time.Time) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+
+	silentAfter, stuckAfter := sm.SilentAfter, sm.StuckAfter
+	if silentAfter <= 0 {
+		silentAfter = DefaultSilentAfter
+	}
+	if stuckAfter <= 0 {
+		stuckAfter = DefaultStuckAfter
+	}
+
+	for id, conn := range sm.Scales {
+		if conn.Config.Summing {
+			continue // Derived from its decks, which are checked themselves
+		}
+		h := &conn.health
+		live := conn.Connected || conn.external
+
+		silent := live && now.Sub(h.LastFrameAt) > silentAfter
+		if silent != h.Silent {
+			h.Silent = silent
+			if silent {
+				sm.healthEvent(id, HealthSilent, fmt.Sprintf("no frame since %s", h.LastFrameAt.Format(time.TimeOnly)), now)
+			} else {
+				sm.healthEvent(id, HealthRecovered, "frames again", now)
+			}
+		}
+
+		stuck := live && !silent && conn.LastWeight != 0 && now.Sub(h.LastChangeAt) > stuckAfter
+		if stuck != h.Stuck {
+			h.Stuck = stuck
+			if stuck {
+				sm.healthEvent(id, HealthStuck, fmt.Sprintf("%.0f since %s", conn.LastWeight, h.LastChangeAt.Format(time.TimeOnly)), now)
+			} else {
+				sm.healthEvent(id, HealthRecovered, "weight moves again", now)
+			}
+		}
+	}
+}
+
+// WatchHealth runs CheckHealth every interval until stop is closed
+func (sm *ScaleManager) WatchHealth(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			sm.CheckHealth(now)
+		}
+	}
+}
+
+// Health returns the health of every managed scale, by ID
+func (sm *ScaleManager) Health() []Health {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	out := make([]Health, 0, len(sm.Scales))
+	for id, conn := range sm.Scales {
+		h := conn.health
+		h.ScaleID = id
+		h.Connected = conn.Connected || conn.external
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ScaleID < out[j].ScaleID })
+	return out
+}
@@ -0,0 +1,136 @@
+package hardware
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/hub"
+)
+
+// waitForHealth follows health events until one of the wanted kind arrives
+func waitForHealth(t *testing.T, events *hub.Subscription[HealthEvent], kind string) HealthEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events.C:
+			if e.Kind == kind {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no %s event received", kind)
+		}
+	}
+}
+
+func TestHealthCountsFrames(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+	health := sm.HealthEvents.Subscribe(0)
+	defer health.Close()
+	sm.AddOrUpdateScale(models.WeighingStation{
+		Model:     gorm.Model{ID: 1},
+		ScalePort: "tcp://" + ln.Addr().String(),
+		Protocol:  ProtocolAND,
+	})
+	defer sm.RemoveScale(1)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForHealth(t, health, HealthConnected)
+	conn.Write([]byte("garbage\r\nST,GS,+0012340kg\r\n"))
+	waitForWeight(t, events, 12340)
+	conn.Close()
+	e := waitForHealth(t, health, HealthDisconnected)
+	if e.ScaleID != 1 || e.Detail == "" {
+		t.Errorf("disconnect event: %+v", e)
+	}
+
+	h := sm.Health()[0]
+	if h.Frames != 1 || h.ParseErrors != 1 || h.Connects != 1 || h.Disconnects != 1 {
+		t.Errorf("health: %+v", h)
+	}
+	if h.ErrorRate() != 0.5 {
+		t.Errorf("error rate %v", h.ErrorRate())
+	}
+}
+
+func TestHealthAlerts(t *testing.T) {
+	sm := newTestManager()
+	sm.SilentAfter = 10 * time.Second
+	sm.StuckAfter = time.Minute
+	health := sm.HealthEvents.Subscribe(0)
+	defer health.Close()
+
+	t0 := time.Unix(1700000000, 0)
+	sm.SetSimulatedReading(3, Reading{Weight: 0}, t0)
+	if e := <-health.C; e.Kind != HealthConnected {
+		t.Fatalf("first reading: %+v", e)
+	}
+
+	// An empty platform reading 0 for ever is not stuck, a quiet link is silent
+	sm.CheckHealth(t0.Add(5 * time.Second))
+	sm.CheckHealth(t0.Add(11 * time.Second))
+	if e := <-health.C; e.Kind != HealthSilent || !e.Alert() {
+		t.Fatalf("expected silent alert, got %+v", e)
+	}
+	sm.CheckHealth(t0.Add(12 * time.Second)) // Raised once, not on every check
+
+	// Frames again, but frozen on a load
+	at := t0.Add(20 * time.Second)
+	for i := 0; i < 70; i++ {
+		sm.SetSimulatedReading(3, Reading{Weight: 18500}, at)
+		sm.CheckHealth(at)
+		at = at.Add(time.Second)
+	}
+	if e := <-health.C; e.Kind != HealthRecovered {
+		t.Fatalf("expected recovery, got %+v", e)
+	}
+	if e := <-health.C; e.Kind != HealthStuck {
+		t.Fatalf("expected stuck alert, got %+v", e)
+	}
+	if h := sm.Health()[0]; !h.Stuck || h.Silent {
+		t.Errorf("health: %+v", h)
+	}
+
+	sm.SetSimulatedReading(3, Reading{Weight: 0}, at)
+	sm.CheckHealth(at)
+	if e := <-health.C; e.Kind != HealthRecovered {
+		t.Fatalf("expected recovery, got %+v", e)
+	}
+	if len(health.C) != 0 {
+		t.Errorf("unexpected event %+v", <-health.C)
+	}
+}
+
+func TestHealthRemovedScaleDisconnects(t *testing.T) {
+	sm := newTestManager()
+	health := sm.HealthEvents.Subscribe(16)
+	defer health.Close()
+
+	sm.SetSimulatedReading(1, Reading{Weight: 100}, time.Now())
+	waitForHealth(t, health, HealthConnected)
+	sm.RemoveScale(1)
+	if e := waitForHealth(t, health, HealthDisconnected); e.ScaleID != 1 || e.Detail != "station removed" {
+		t.Errorf("remove: %+v", e)
+	}
+
+	sm.SetSimulatedReading(2, Reading{Weight: 100}, time.Now())
+	waitForHealth(t, health, HealthConnected)
+	sm.Shutdown()
+	if e := waitForHealth(t, health, HealthDisconnected); e.ScaleID != 2 || e.Detail != "service stopped" {
+		t.Errorf("shutdown: %+v", e)
+	}
+}
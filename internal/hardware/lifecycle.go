@@ -0,0 +1,298 @@
+package hardware
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+)
+
+// Station lifecycle. Every started station has one goroutine (monitorScale
+// or simulate) that owns its port. Stopping a station closes its stop
+// channel and its port under sm.Mu; from then on the goroutine publishes
+// nothing and exits, closing done. A replacement for the same station
+// waits for done before opening the port again, so two goroutines never
+// read the same port.
+
+// linkSettings are the station settings a running connection was built
+// from. Changing any of them restarts the station; any other change is
+// applied in place without touching the port.
+type linkSettings struct {
+	ScalePort   string
+	BaudRate    int
+	DataBits    int
+	Parity      string
+	StopBits    string
+	FlowControl string
+	Terminator  string
+	RecordRaw   bool
+	Summing     bool
+	SimScenario string
+
+	Protocol        string
+	ProtocolPattern string
+	ModbusUnitID    int
+	ModbusRegister  int
+	ModbusDataType  string
+	ModbusWordOrder string
+	ModbusScale     float64
+	PollIntervalMs  int
+}
+
+func linkOf(st models.WeighingStation) linkSettings {
+	return linkSettings{
+		ScalePort:       st.ScalePort,
+		BaudRate:        st.BaudRate,
+		DataBits:        st.DataBits,
+		Parity:          st.Parity,
+		StopBits:        st.StopBits,
+		FlowControl:     st.FlowControl,
+		Terminator:      st.Terminator,
+		RecordRaw:       st.RecordRaw,
+		Summing:         st.Summing,
+		SimScenario:     st.SimScenario,
+		Protocol:        st.Protocol,
+		ProtocolPattern: st.ProtocolPattern,
+		ModbusUnitID:    st.ModbusUnitID,
+		ModbusRegister:  st.ModbusRegister,
+		ModbusDataType:  st.ModbusDataType,
+		ModbusWordOrder: st.ModbusWordOrder,
+		ModbusScale:     st.ModbusScale,
+		PollIntervalMs:  st.PollIntervalMs,
+	}
+}
+
+// ReloadConfig loads the enabled stations from the DB and applies them
+// with Sync
+func (sm *ScaleManager) ReloadConfig(db *gorm.DB) {
+	log.Println("Reloading Scale Configurations...")
+	var stations []models.WeighingStation
+	if err := db.Where("enabled = ?", true).Find(&stations).Error; err != nil {
+		log.Printf("Error loading stations: %v", err)
+		return
+	}
+	sm.Sync(stations)
+}
+
+// Sync makes the managed scales match stations: scales that are not
+// listed are stopped, new ones started and those whose link settings
+// changed restarted. Every other scale keeps its port open, so saving one
+// station causes no gap in the weight feed of the others.
+func (sm *ScaleManager) Sync(stations []models.WeighingStation) {
+	wanted := make(map[uint]bool, len(stations))
+	for _, st := range stations {
+		wanted[st.ID] = true
+	}
+
+	sm.Mu.Lock()
+	var stopped []<-chan struct{}
+	for id := range sm.Scales {
+		if !wanted[id] {
+			stopped = append(stopped, sm.removeScale(id, "station removed"))
+		}
+	}
+	for _, st := range stations {
+		sm.addOrUpdateScale(st)
+	}
+	sm.Mu.Unlock()
+
+	// Removed stations have released their ports once Sync returns
+	for _, done := range stopped {
+		<-done
+	}
+}
+
+// AddOrUpdateScale starts a scale, or applies new settings to a running
+// one: restarted if its link settings changed, updated in place otherwise
+func (sm *ScaleManager) AddOrUpdateScale(config models.WeighingStation) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	sm.addOrUpdateScale(config)
+}
+
+// addOrUpdateScale is AddOrUpdateScale for callers already holding sm.Mu
+func (sm *ScaleManager) addOrUpdateScale(config models.WeighingStation) {
+	sm.syncReader(config)
+	defer sm.syncSensors(config) // Reports on the connection, so after it exists
+
+	old, exists := sm.Scales[config.ID]
+	// Connections registered by a remote reading have no goroutine yet
+	running := exists && (old.stop != nil || old.Config.Summing)
+	if running && linkOf(old.Config) == linkOf(config) {
+		sm.reconfigure(old, config)
+		return
+	}
+	sm.restartScale(config)
+}
+
+// reconfigure applies settings that do not need the port reopened.
+// Callers must hold sm.Mu.
+func (sm *ScaleManager) reconfigure(conn *ScaleConnection, config models.WeighingStation) {
+	old := conn.Config
+	conn.Config = config
+
+	if old.StableWindowMs != config.StableWindowMs || old.StableTolerance != config.StableTolerance {
+		conn.stability = NewStabilityDetector(
+			time.Duration(config.StableWindowMs)*time.Millisecond,
+			config.StableTolerance,
+		)
+	}
+	if old.AxleMode != config.AxleMode || old.AxleTimeoutMs != config.AxleTimeoutMs ||
+		old.AxleMinWeight != config.AxleMinWeight || old.StableTolerance != config.StableTolerance {
+		conn.axles = nil
+		if config.AxleMode {
+			conn.axles = NewAxleDetector(
+				time.Duration(config.AxleTimeoutMs)*time.Millisecond,
+				config.AxleMinWeight,
+				conn.stability.Tolerance,
+			)
+		}
+	}
+
+	now := time.Now()
+	if old.SumStationID != config.SumStationID && old.SumStationID != 0 {
+		sm.updateSum(old.SumStationID, now) // Lost a deck
+	}
+	if config.Summing {
+		sm.updateSum(config.ID, now)
+		return
+	}
+	sm.broadcast(conn.data(now), now)
+}
+
+// restartScale replaces the connection of a station with a fresh one and
+// starts it. Health counters carry over. Callers must hold sm.Mu.
+func (sm *ScaleManager) restartScale(config models.WeighingStation) {
+	var prev <-chan struct{}
+	old, exists := sm.Scales[config.ID]
+	if exists {
+		prev = sm.stopScale(old)
+	}
+
+	conn := newScaleConnection(config)
+	if sm.transport != nil {
+		transport, err := sm.transport(config)
+		if err != nil {
+			transport = errTransport{err}
+		}
+		conn.Transport = transport
+	}
+	if exists {
+		conn.health = old.health
+		conn.health.ConnectedSince = time.Time{} // Counters carry over, the link starts anew
+		conn.position = old.position             // The sensors do not restart with the scale
+	}
+	sm.Scales[config.ID] = conn
+
+	if exists && old.Config.SumStationID != 0 && old.Config.SumStationID != config.SumStationID {
+		sm.updateSum(old.Config.SumStationID, time.Now())
+	}
+	// Summing stations have no port, their decks drive them
+	if config.Summing {
+		sm.updateSum(config.ID, time.Now())
+		return
+	}
+	sm.startScale(conn, prev)
+}
+
+// startScale runs the goroutine feeding a connection: the scenario
+// simulator or the port monitor. It waits for prev, the done channel of
+// the connection it replaces, so the port is free when it opens it.
+// Callers must hold sm.Mu.
+func (sm *ScaleManager) startScale(conn *ScaleConnection, prev <-chan struct{}) {
+	conn.stop = make(chan struct{})
+	conn.done = make(chan struct{})
+	scenario := sm.scenarioFor(conn.Config)
+
+	go func() {
+		defer close(conn.done)
+		// Even when stopped meanwhile: done must not close before prev, or a
+		// later replacement would open the port while prev still holds it
+		if prev != nil {
+			<-prev
+		}
+		if conn.stopped() {
+			return
+		}
+		if scenario != "" {
+			sm.simulate(conn, scenario)
+			return
+		}
+		sm.monitorScale(conn)
+	}()
+}
+
+// stopScale shuts a connection down and returns a channel closed once
+// its goroutine has exited. Callers must hold sm.Mu.
+func (sm *ScaleManager) stopScale(conn *ScaleConnection) <-chan struct{} {
+	if conn.stop == nil {
+		// Fed from outside (remote API, tests): nothing runs
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	if !conn.stopped() {
+		close(conn.stop)
+		conn.close()
+	}
+	return conn.done
+}
+
+// RemoveScale stops monitoring a scale and returns once its port is released
+func (sm *ScaleManager) RemoveScale(scaleID uint) {
+	sm.Mu.Lock()
+	done := sm.removeScale(scaleID, "station removed")
+	sm.Mu.Unlock()
+	<-done
+}
+
+// removeScale stops a scale, its tag reader and its position sensors and
+// forgets them. A connected scale reports a disconnect for reason, so its
+// uptime stops counting. The returned channel is closed once their ports
+// are released; callers holding sm.Mu must not wait on it.
+func (sm *ScaleManager) removeScale(scaleID uint, reason string) <-chan struct{} {
+	reader := sm.stopReader(scaleID)
+	sensors := sm.stopSensors(scaleID)
+	conn, ok := sm.Scales[scaleID]
+	if !ok {
+		done := make(chan struct{})
+		go func() {
+			<-reader
+			<-sensors
+			close(done)
+		}()
+		return done
+	}
+	scale := sm.stopScale(conn)
+	if conn.Connected || conn.external {
+		sm.linkChanged(conn, false, reason, time.Now())
+	}
+	delete(sm.Scales, scaleID)
+	log.Printf("Stopped Scale %d", scaleID)
+	if conn.Config.SumStationID != 0 {
+		sm.updateSum(conn.Config.SumStationID, time.Now())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		<-scale
+		<-reader
+		<-sensors
+		close(done)
+	}()
+	return done
+}
+
+// Shutdown stops every scale and waits until all ports are released
+func (sm *ScaleManager) Shutdown() {
+	sm.Mu.Lock()
+	var stopped []<-chan struct{}
+	for id := range sm.Scales {
+		stopped = append(stopped, sm.removeScale(id, "service stopped"))
+	}
+	sm.Mu.Unlock()
+	for _, done := range stopped {
+		<-done
+	}
+}
@@ -0,0 +1,229 @@
+package hardware
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+)
+
+// fakePort is the station side of an in-memory link; the test writes
+// indicator frames to peer
+type fakePort struct {
+	net.Conn
+	peer   net.Conn
+	closed chan struct{}
+	once   sync.Once
+	owner  *fakeTransports
+}
+
+func (p *fakePort) Close() error {
+	p.once.Do(func() {
+		p.owner.mu.Lock()
+		p.owner.open[p.owner.ports[p]]--
+		p.owner.mu.Unlock()
+		close(p.closed)
+		p.peer.Close()
+	})
+	return p.Conn.Close()
+}
+
+// fakeTransports hands out fake ports per station and records every open,
+// failing the test when a station's port is opened while still open
+type fakeTransports struct {
+	t      *testing.T
+	mu     sync.Mutex
+	open   map[uint]int
+	ports  map[*fakePort]uint
+	opened map[uint]chan *fakePort
+}
+
+func newFakeTransports(t *testing.T) *fakeTransports {
+	return &fakeTransports{
+		t:      t,
+		open:   make(map[uint]int),
+		ports:  make(map[*fakePort]uint),
+		opened: make(map[uint]chan *fakePort),
+	}
+}
+
+// next waits for the next open of a station's port
+func (f *fakeTransports) next(id uint) *fakePort {
+	f.t.Helper()
+	select {
+	case p := <-f.channel(id):
+		return p
+	case <-time.After(5 * time.Second):
+		f.t.Fatalf("station %d port not opened", id)
+		return nil
+	}
+}
+
+func (f *fakeTransports) channel(id uint) chan *fakePort {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.opened[id] == nil {
+		f.opened[id] = make(chan *fakePort, 64)
+	}
+	return f.opened[id]
+}
+
+func (f *fakeTransports) transport(st models.WeighingStation) (Transport, error) {
+	return fakeTransport{f: f, id: st.ID}, nil
+}
+
+type fakeTransport struct {
+	f  *fakeTransports
+	id uint
+}
+
+func (t fakeTransport) Open() (io.ReadWriteCloser, error) {
+	a, b := net.Pipe()
+	p := &fakePort{Conn: a, peer: b, closed: make(chan struct{}), owner: t.f}
+	ch := t.f.channel(t.id)
+	t.f.mu.Lock()
+	if t.f.open[t.id] > 0 {
+		t.f.t.Errorf("station %d port opened twice", t.id)
+	}
+	t.f.open[t.id]++
+	t.f.ports[p] = t.id
+	t.f.mu.Unlock()
+	ch <- p
+	return p, nil
+}
+
+func (t fakeTransport) Close() error   { return nil }
+func (t fakeTransport) String() string { return "fake" }
+
+func station(id uint, baud int) models.WeighingStation {
+	return models.WeighingStation{Model: gorm.Model{ID: id}, Name: "Deck", ScalePort: "fake", BaudRate: baud, Protocol: ProtocolAND}
+}
+
+func TestSyncRestartsOnlyChangedStations(t *testing.T) {
+	fakes := newFakeTransports(t)
+	sm := newTestManager()
+	sm.transport = fakes.transport
+	defer sm.Shutdown()
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+
+	sm.Sync([]models.WeighingStation{station(1, 9600), station(2, 9600)})
+	one, two := fakes.next(1), fakes.next(2)
+	go one.peer.Write([]byte("ST,GS,+0001000kg\r\n"))
+	waitForWeight(t, events, 1000)
+
+	health := sm.HealthEvents.Subscribe(0)
+	defer health.Close()
+
+	// Station 1 only gets a new name and stability setting, station 2 a new baud rate
+	renamed := station(1, 9600)
+	renamed.Name = "Gerbang"
+	renamed.RequireStable = true
+	renamed.StableTolerance = 5
+	sm.Sync([]models.WeighingStation{renamed, station(2, 19200)})
+
+	reopened := fakes.next(2)
+	select {
+	case <-two.closed:
+	default:
+		t.Error("old port of station 2 still open after its replacement opened")
+	}
+	select {
+	case <-one.closed:
+		t.Fatal("station 1 was restarted")
+	case p := <-fakes.channel(1):
+		t.Fatalf("station 1 port reopened: %v", p)
+	default:
+	}
+
+	// Station 1 keeps reading on its original port, with the new settings
+	go one.peer.Write([]byte("ST,GS,+0002000kg\r\n"))
+	waitForWeight(t, events, 2000)
+	go reopened.peer.Write([]byte("ST,GS,+0003000kg\r\n"))
+	waitForWeight(t, events, 3000)
+
+	sm.Mu.Lock()
+	conn := sm.Scales[1]
+	if conn.Config.Name != "Gerbang" || conn.stability.Tolerance != 5 {
+		t.Errorf("station 1 not reconfigured: %+v", conn.Config)
+	}
+	if sm.Scales[2].health.Connects != 2 {
+		t.Errorf("station 2 health not carried over: %+v", sm.Scales[2].health)
+	}
+	sm.Mu.Unlock()
+
+	// The restart is not reported as a link failure
+	for len(health.C) > 0 {
+		if e := <-health.C; e.Kind == HealthDisconnected {
+			t.Errorf("restart reported as disconnect: %+v", e)
+		}
+	}
+}
+
+func TestSyncRemovesStations(t *testing.T) {
+	fakes := newFakeTransports(t)
+	sm := newTestManager()
+	sm.transport = fakes.transport
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+
+	sm.Sync([]models.WeighingStation{station(1, 9600)})
+	port := fakes.next(1)
+
+	// Sync returns once the port is released, and the station is gone
+	sm.Sync(nil)
+	select {
+	case <-port.closed:
+	default:
+		t.Fatal("port still open after Sync returned")
+	}
+	if _, ok := sm.Status(1); ok {
+		t.Error("station still managed")
+	}
+	for len(events.C) > 0 {
+		<-events.C
+	}
+	if _, err := port.peer.Write([]byte("ST,GS,+0001000kg\r\n")); err == nil {
+		t.Error("removed station still reading its port")
+	}
+	if len(events.C) != 0 {
+		t.Errorf("removed station published %+v", <-events.C)
+	}
+}
+
+func TestRestartNeverOpensPortTwice(t *testing.T) {
+	fakes := newFakeTransports(t)
+	sm := newTestManager()
+	sm.transport = fakes.transport
+
+	// Back to back restarts: each must wait for its predecessor's port
+	for baud := 1200; baud <= 1200*16; baud += 1200 {
+		sm.AddOrUpdateScale(station(1, baud))
+	}
+	sm.AddOrUpdateScale(station(1, 115200))
+
+	sm.Mu.Lock()
+	conn := sm.Scales[1]
+	sm.Mu.Unlock()
+	for {
+		p := fakes.next(1)
+		conn.writeMu.Lock()
+		current := conn.Port == p
+		conn.writeMu.Unlock()
+		if current {
+			break
+		}
+	}
+
+	sm.Shutdown()
+	<-conn.done
+	fakes.mu.Lock()
+	defer fakes.mu.Unlock()
+	if fakes.open[1] != 0 {
+		t.Errorf("%d ports left open after Shutdown", fakes.open[1])
+	}
+}
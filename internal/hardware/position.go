@@ -0,0 +1,437 @@
+package hardware
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"stoneweigh/internal/models"
+)
+
+// Position sensor modules accepted in WeighingStation.SensorProtocol
+const (
+	// SensorASCII is an input module (or a small controller) sending the
+	// state of its inputs as a line of 0s and 1s, input 1 first, e.g.
+	// "0110". Spaces and commas are ignored. It sends on every change and
+	// must repeat its state periodically: a module silent for
+	// ScaleManager.SensorStale counts as offline.
+	SensorASCII = "ascii"
+	// SensorModbusRTU and SensorModbusTCP poll the discrete inputs of a
+	// Modbus I/O module or PLC, input 1 being discrete input 0
+	SensorModbusRTU = "modbus_rtu"
+	SensorModbusTCP = "modbus_tcp"
+)
+
+// MaxSensorInput is the highest input number a beam can be wired to
+const MaxSensorInput = 32
+
+// sensorPoll is the poll interval of Modbus input modules
+const sensorPoll = 200 * time.Millisecond
+
+// DefaultSensorStale is how long an ASCII input module may stay silent
+// before its beams count as offline
+const DefaultSensorStale = 5 * time.Second
+
+// Position is the state of the position sensors of a station, the
+// photo-eyes or IR beams telling whether the vehicle stands wholly on
+// the platform. Inputs are bit masks, bit k-1 for input k.
+type Position struct {
+	Beams  uint32 `json:"beams"`  // Inputs wired to a beam, 0 on stations without sensors
+	Online bool   `json:"online"` // The input module answers
+	Broken uint32 `json:"broken"` // Beams currently broken
+}
+
+// Clear reports whether a weight may be captured: the station has no
+// sensors, or its module answers and no beam is broken
+func (p Position) Clear() bool {
+	return p.Beams == 0 || (p.Online && p.Broken == 0)
+}
+
+// BrokenInputs lists the inputs of the broken beams
+func (p Position) BrokenInputs() []int {
+	var inputs []int
+	for k := 1; k <= MaxSensorInput; k++ {
+		if p.Broken&(1<<(k-1)) != 0 {
+			inputs = append(inputs, k)
+		}
+	}
+	return inputs
+}
+
+// sensorSettings are the station settings running position sensors were
+// built from. Like the tag reader they are independent of the scale link.
+type sensorSettings struct {
+	Protocol       string
+	Port           string
+	BaudRate       int
+	UnitID         int
+	Inputs         string
+	NormallyClosed bool
+}
+
+func sensorsOf(st models.WeighingStation) sensorSettings {
+	return sensorSettings{
+		Protocol:       st.SensorProtocol,
+		Port:           strings.TrimSpace(st.SensorPort),
+		BaudRate:       st.SensorBaudRate,
+		UnitID:         st.SensorUnitID,
+		Inputs:         st.SensorInputs,
+		NormallyClosed: st.SensorNormallyClosed,
+	}
+}
+
+// transport opens the module port like a scale port, 8N1
+func (ss sensorSettings) transport() (Transport, error) {
+	if ss.Port == "" {
+		return nil, fmt.Errorf("position sensors without a port")
+	}
+	return NewTransport(models.WeighingStation{ScalePort: ss.Port, BaudRate: ss.BaudRate})
+}
+
+// beams returns the mask of the inputs wired to beams, "1,2" when unset:
+// one beam at each end of the platform
+func (ss sensorSettings) beams() (uint32, error) {
+	list := strings.TrimSpace(ss.Inputs)
+	if list == "" {
+		list = "1,2"
+	}
+	var mask uint32
+	for _, f := range strings.Split(list, ",") {
+		k, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || k < 1 || k > MaxSensorInput {
+			return 0, fmt.Errorf("invalid sensor input %q", strings.TrimSpace(f))
+		}
+		mask |= 1 << (k - 1)
+	}
+	return mask, nil
+}
+
+// unit is the Modbus slave address, 1 when unset
+func (ss sensorSettings) unit() (byte, error) {
+	switch {
+	case ss.UnitID == 0:
+		return 1, nil
+	case ss.UnitID < 0 || ss.UnitID > 247:
+		return 0, fmt.Errorf("invalid modbus unit id %d", ss.UnitID)
+	default:
+		return byte(ss.UnitID), nil
+	}
+}
+
+// validateSensors checks the position sensor settings of a station
+func validateSensors(st models.WeighingStation) error {
+	ss := sensorsOf(st)
+	switch ss.Protocol {
+	case "":
+		return nil
+	case SensorASCII, SensorModbusRTU, SensorModbusTCP:
+	default:
+		return fmt.Errorf("unknown position sensor protocol %q", ss.Protocol)
+	}
+	if _, err := ss.beams(); err != nil {
+		return err
+	}
+	if _, err := ss.unit(); err != nil {
+		return err
+	}
+	_, err := ss.transport()
+	return err
+}
+
+// parseInputStates decodes a line of an ASCII input module
+func parseInputStates(line string) ([]bool, error) {
+	var states []bool
+	for _, r := range line {
+		switch r {
+		case '0':
+			states = append(states, false)
+		case '1':
+			states = append(states, true)
+		case ' ', ',', '\t':
+		default:
+			return nil, fmt.Errorf("invalid input states %q", line)
+		}
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("invalid input states %q", line)
+	}
+	return states, nil
+}
+
+// positionSensors is the running input module of a station. Like a tag
+// reader it has one goroutine owning its port, stopped through stop and done.
+type positionSensors struct {
+	settings  sensorSettings
+	beams     uint32
+	transport Transport
+	stale     time.Duration // ASCII modules only
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu   sync.Mutex
+	port io.ReadWriteCloser
+}
+
+func (s *positionSensors) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown stops the module and returns a channel closed once its port
+// is released
+func (s *positionSensors) shutdown() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped() {
+		close(s.stop)
+		s.transport.Close()
+		if s.port != nil {
+			s.port.Close()
+		}
+	}
+	return s.done
+}
+
+// position maps input states, input 1 first, to the beams. A beam is
+// broken while its input is on, or off with normally closed wiring.
+func (s *positionSensors) position(states []bool) (Position, error) {
+	p := Position{Beams: s.beams, Online: true}
+	for k := 1; k <= MaxSensorInput; k++ {
+		bit := uint32(1) << (k - 1)
+		if s.beams&bit == 0 {
+			continue
+		}
+		if k > len(states) {
+			return Position{}, fmt.Errorf("no state for input %d", k)
+		}
+		if states[k-1] != s.settings.NormallyClosed {
+			p.Broken |= bit
+		}
+	}
+	return p, nil
+}
+
+// syncSensors starts, restarts or stops the position sensors of a station
+// to match its settings. Until a restarted module answers, the station
+// reports its beams offline. Callers must hold sm.Mu.
+func (sm *ScaleManager) syncSensors(st models.WeighingStation) {
+	want := sensorsOf(st)
+	old := sm.sensors[st.ID]
+	if old != nil && old.settings == want {
+		return
+	}
+	var prev <-chan struct{}
+	if old != nil {
+		prev = old.shutdown()
+		delete(sm.sensors, st.ID)
+	}
+	if want.Protocol == "" {
+		sm.setPosition(st.ID, Position{})
+		return
+	}
+
+	beams, err := want.beams()
+	var transport Transport
+	if err == nil {
+		transport, err = want.transport()
+	}
+	if err != nil {
+		log.Printf("Position sensors of station %d: %v", st.ID, err)
+		transport = errTransport{err}
+	}
+	if beams == 0 {
+		beams = 1 // Invalid inputs: stay offline, never clear
+	}
+	stale := sm.SensorStale
+	if stale <= 0 {
+		stale = DefaultSensorStale
+	}
+	s := &positionSensors{settings: want, beams: beams, transport: transport, stale: stale, stop: make(chan struct{}), done: make(chan struct{})}
+	if sm.sensors == nil {
+		sm.sensors = make(map[uint]*positionSensors)
+	}
+	sm.sensors[st.ID] = s
+	sm.setPosition(st.ID, Position{Beams: beams})
+
+	go func() {
+		defer close(s.done)
+		if prev != nil {
+			<-prev // The previous module may hold the same port
+		}
+		if s.stopped() {
+			return
+		}
+		sm.watchSensors(st.ID, s)
+	}()
+}
+
+// stopSensors stops the position sensors of a station, if any. The
+// returned channel is closed once their port is released. Callers must
+// hold sm.Mu.
+func (sm *ScaleManager) stopSensors(scaleID uint) <-chan struct{} {
+	s, ok := sm.sensors[scaleID]
+	if !ok {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	delete(sm.sensors, scaleID)
+	return s.shutdown()
+}
+
+// setPosition stores the sensor state of a station and broadcasts it
+// with the weight when it changed. Callers must hold sm.Mu.
+func (sm *ScaleManager) setPosition(scaleID uint, p Position) {
+	conn, ok := sm.Scales[scaleID]
+	if !ok || conn.position == p {
+		return
+	}
+	conn.position = p
+	now := time.Now()
+	sm.broadcast(conn.data(now), now)
+}
+
+// report is setPosition for the goroutine of s, unless it has been stopped
+func (sm *ScaleManager) report(scaleID uint, s *positionSensors, p Position) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	if !s.stopped() {
+		sm.setPosition(scaleID, p)
+	}
+}
+
+// watchSensors reads the input module of a station, reconnecting after
+// errors until it is stopped. The beams are offline while it is not read.
+func (sm *ScaleManager) watchSensors(scaleID uint, s *positionSensors) {
+	offline := Position{Beams: s.beams}
+	for {
+		port, err := s.transport.Open()
+		if err != nil {
+			sm.report(scaleID, s, offline)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-s.stop:
+				return
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		if s.stopped() {
+			s.mu.Unlock()
+			port.Close()
+			return
+		}
+		s.port = port
+		s.mu.Unlock()
+		log.Printf("Connected to position sensors of station %d on %s", scaleID, s.transport)
+
+		if s.settings.Protocol == SensorASCII {
+			err = sm.readInputLines(scaleID, s, port)
+		} else {
+			err = sm.pollInputs(scaleID, s, port)
+		}
+		port.Close()
+
+		s.mu.Lock()
+		s.port = nil
+		stopped := s.stopped()
+		s.mu.Unlock()
+		if stopped {
+			return
+		}
+		sm.report(scaleID, s, offline)
+		log.Printf("Error reading position sensors of station %d: %v", scaleID, err)
+		select {
+		case <-time.After(time.Second):
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// readInputLines applies the lines of an ASCII module until the stream
+// fails, or the module sends no valid line for s.stale: a link that went
+// quiet would otherwise keep the last state forever.
+func (sm *ScaleManager) readInputLines(scaleID uint, s *positionSensors, port io.ReadCloser) error {
+	var stale atomic.Bool
+	watchdog := time.AfterFunc(s.stale, func() {
+		stale.Store(true)
+		port.Close()
+	})
+	defer watchdog.Stop()
+
+	scanner := bufio.NewScanner(port)
+	scanner.Split(splitTagFrames)
+	for scanner.Scan() {
+		states, err := parseInputStates(strings.TrimSpace(scanner.Text()))
+		if err == nil {
+			var p Position
+			if p, err = s.position(states); err == nil {
+				watchdog.Reset(s.stale)
+				sm.report(scaleID, s, p)
+				continue
+			}
+		}
+		log.Printf("Position sensors of station %d: %v", scaleID, err)
+	}
+	if stale.Load() {
+		return fmt.Errorf("no input states for %s", s.stale)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// pollInputs reads the discrete inputs of a Modbus module on sensorPoll
+// until a request fails or the module is stopped
+func (sm *ScaleManager) pollInputs(scaleID uint, s *positionSensors, port io.ReadWriter) error {
+	unit, err := s.settings.unit()
+	if err != nil {
+		return err
+	}
+	client := &ModbusDriver{TCP: s.settings.Protocol == SensorModbusTCP, UnitID: unit}
+	count := 32 - bits.LeadingZeros32(s.beams)
+	pdu := []byte{modbusReadInputs, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(pdu[3:], uint16(count))
+
+	ticker := time.NewTicker(sensorPoll)
+	defer ticker.Stop()
+	for {
+		data, err := client.roundTrip(port, pdu)
+		if err != nil {
+			return err
+		}
+		if len(data)*8 < count {
+			return fmt.Errorf("modbus: %d input bytes for %d inputs: %w", len(data), count, ErrInvalidFrame)
+		}
+		states := make([]bool, count)
+		for i := range states {
+			states[i] = data[i/8]&(1<<(i%8)) != 0
+		}
+		p, err := s.position(states)
+		if err != nil {
+			return err
+		}
+		sm.report(scaleID, s, p)
+
+		select {
+		case <-s.stop:
+			return errStopped
+		case <-ticker.C:
+		}
+	}
+}
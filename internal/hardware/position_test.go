@@ -0,0 +1,233 @@
+package hardware
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/hub"
+)
+
+func TestPositionSettings(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		want []bool
+	}{
+		{"0110", []bool{false, true, true, false}},
+		{"1, 0", []bool{true, false}},
+		{"01x", nil},
+		{"", nil},
+	} {
+		got, err := parseInputStates(tt.line)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q accepted: %v", tt.line, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%q = %v, %v; want %v", tt.line, got, err, tt.want)
+		}
+	}
+
+	// Beams on inputs 1 and 3: normally open reads on as broken
+	s := &positionSensors{beams: 0b101}
+	p, err := s.position([]bool{true, true, false})
+	if err != nil || p.Broken != 0b001 || p.Clear() || !slices.Equal(p.BrokenInputs(), []int{1}) {
+		t.Errorf("normally open: %+v, %v", p, err)
+	}
+	s.settings.NormallyClosed = true
+	if p, _ := s.position([]bool{true, false, true}); p.Broken != 0 || !p.Clear() {
+		t.Errorf("normally closed: %+v", p)
+	}
+	if _, err := s.position([]bool{true}); err == nil {
+		t.Error("missing input 3 accepted")
+	}
+
+	if !(Position{}).Clear() || (Position{Beams: 3}).Clear() {
+		t.Error("stations without sensors must be clear, offline sensors must not")
+	}
+	for _, st := range []models.WeighingStation{
+		{SensorProtocol: "gpio", SensorPort: "/dev/ttyUSB3"},
+		{SensorProtocol: SensorASCII},
+		{SensorProtocol: SensorASCII, SensorPort: "/dev/ttyUSB3", SensorInputs: "1,33"},
+		{SensorProtocol: SensorModbusRTU, SensorPort: "/dev/ttyUSB3", SensorUnitID: 300},
+	} {
+		if err := validateSensors(st); err == nil {
+			t.Errorf("%+v accepted", st)
+		}
+	}
+	if err := validateSensors(models.WeighingStation{SensorProtocol: SensorModbusTCP, SensorPort: "tcp://10.0.0.30:502", SensorInputs: "2, 4"}); err != nil {
+		t.Error(err)
+	}
+}
+
+// waitForPosition follows broadcasts until the scale reports the wanted sensor state
+func waitForPosition(t *testing.T, events *hub.Subscription[ScaleData], want Position) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case d := <-events.C:
+			if d.Position == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("position %+v never reported", want)
+		}
+	}
+}
+
+func TestPositionSensorsASCII(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(256)
+	defer events.Close()
+	station := models.WeighingStation{
+		Model: gorm.Model{ID: 6}, SimScenario: "truck_cycle",
+		SensorProtocol: SensorASCII, SensorPort: "tcp://" + ln.Addr().String(),
+	}
+	sm.Sync([]models.WeighingStation{station})
+	defer sm.Shutdown()
+
+	// Offline until the module reports
+	waitForPosition(t, events, Position{Beams: 3})
+	var module net.Conn
+	select {
+	case module = <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("module never connected")
+	}
+	module.Write([]byte("00\r\n"))
+	waitForPosition(t, events, Position{Beams: 3, Online: true})
+	module.Write([]byte("01\r\n"))
+	waitForPosition(t, events, Position{Beams: 3, Online: true, Broken: 2})
+
+	// Scale settings keep the state, a lost module is offline again
+	station.Division = 10
+	sm.Sync([]models.WeighingStation{station})
+	if d, _ := sm.Status(6); d.Position.Broken != 2 {
+		t.Errorf("position lost on reconfigure: %+v", d.Position)
+	}
+	module.Close()
+	waitForPosition(t, events, Position{Beams: 3})
+
+	// Without sensors the station is clear
+	station.SensorProtocol = ""
+	sm.Sync([]models.WeighingStation{station})
+	if d, _ := sm.Status(6); d.Position != (Position{}) {
+		t.Errorf("sensors removed, position %+v", d.Position)
+	}
+}
+
+func TestPositionSensorsStale(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	module := func() net.Conn {
+		t.Helper()
+		select {
+		case conn := <-conns:
+			return conn
+		case <-time.After(5 * time.Second):
+			t.Fatal("module never connected")
+			return nil
+		}
+	}
+
+	sm := newTestManager()
+	sm.SensorStale = 300 * time.Millisecond
+	events := sm.Events.Subscribe(256)
+	defer events.Close()
+	sm.Sync([]models.WeighingStation{{
+		Model: gorm.Model{ID: 8}, SimScenario: "truck_cycle",
+		SensorProtocol: SensorASCII, SensorPort: "tcp://" + ln.Addr().String(),
+	}})
+	defer sm.Shutdown()
+
+	first := module()
+	defer first.Close()
+	first.Write([]byte("00\r\n"))
+	waitForPosition(t, events, Position{Beams: 3, Online: true})
+
+	// The module keeps the link open but stops sending
+	waitForPosition(t, events, Position{Beams: 3})
+	second := module()
+	defer second.Close()
+	second.Write([]byte("00\r\n"))
+	waitForPosition(t, events, Position{Beams: 3, Online: true})
+}
+
+func TestPositionSensorsModbus(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			req := make([]byte, 12)
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			if req[6] != 4 || req[7] != modbusReadInputs || binary.BigEndian.Uint16(req[10:]) != 2 {
+				t.Errorf("request % X", req)
+				return
+			}
+			// Input 2 on, input 1 off
+			resp := append([]byte{}, req[:4]...)
+			resp = binary.BigEndian.AppendUint16(resp, 4)
+			conn.Write(append(resp, req[6], req[7], 1, 0x02))
+		}
+	}()
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(256)
+	defer events.Close()
+	sm.Sync([]models.WeighingStation{{
+		Model: gorm.Model{ID: 7}, SimScenario: "truck_cycle",
+		SensorProtocol: SensorModbusTCP, SensorPort: "tcp://" + ln.Addr().String(),
+		SensorUnitID: 4, SensorNormallyClosed: true,
+	}})
+	defer sm.Shutdown()
+
+	// Normally closed: the beam of input 1 is broken, input 2 clear
+	waitForPosition(t, events, Position{Beams: 3, Online: true, Broken: 1})
+}
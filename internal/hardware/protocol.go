@@ -0,0 +1,121 @@
+package hardware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"stoneweigh/internal/models"
+)
+
+// WeighMode tells whether an indicator is showing gross or net weight
+type WeighMode string
+
+const (
+	ModeGross WeighMode = "gross"
+	ModeNet   WeighMode = "net"
+)
+
+// Reading is a single decoded frame from a weighing indicator
+type Reading struct {
+	Weight   float64   `json:"weight"`   // Signed weight, in Unit
+	Unit     string    `json:"unit"`     // "kg", "t", "lb"... empty if the frame does not say
+	Negative bool      `json:"negative"` // Sign reported by the indicator
+	Stable   bool      `json:"stable"`   // Only meaningful when HasMotion is true
+	Mode     WeighMode `json:"mode"`     // Gross or net, only meaningful when HasMode is true
+	Overload bool      `json:"overload"` // Over/under range reported by the indicator
+
+	// HasMotion is true when the protocol carries a motion/stable flag.
+	// Drivers that cannot tell leave it false and Stable must be ignored.
+	HasMotion bool `json:"-"`
+	// HasMode is true when the protocol carries a gross/net flag. Drivers
+	// that cannot tell report every reading as gross.
+	HasMode bool   `json:"-"`
+	Raw     string `json:"-"`
+}
+
+// ErrInvalidFrame is returned by drivers for frames they cannot decode
+var ErrInvalidFrame = errors.New("invalid frame")
+
+// Driver decodes the frames of one indicator protocol
+type Driver interface {
+	// Name is the protocol key stored in WeighingStation.Protocol
+	Name() string
+	// SplitFunc cuts the raw byte stream into frames for Parse
+	SplitFunc() bufio.SplitFunc
+	// Parse decodes one frame as returned by SplitFunc
+	Parse(frame []byte) (Reading, error)
+}
+
+// Poller is implemented by drivers for devices that only answer requests
+// (Modbus) instead of streaming frames. The monitor calls Poll every
+// Interval; Parse then decodes the data part of the response.
+type Poller interface {
+	Poll(rw io.ReadWriter) (Reading, error)
+	Interval() time.Duration
+}
+
+// Protocol keys accepted in WeighingStation.Protocol
+const (
+	ProtocolGeneric   = "generic"
+	ProtocolToledo    = "toledo"
+	ProtocolAND       = "and"
+	ProtocolRinstrun  = "rinstrun"
+	ProtocolModbusRTU = "modbus_rtu"
+	ProtocolModbusTCP = "modbus_tcp"
+)
+
+type driverFactory func(station models.WeighingStation) (Driver, error)
+
+var driverRegistry = map[string]driverFactory{
+	ProtocolGeneric: func(st models.WeighingStation) (Driver, error) {
+		return NewGenericDriver(st.ProtocolPattern)
+	},
+	ProtocolToledo: func(models.WeighingStation) (Driver, error) {
+		return &ToledoDriver{}, nil
+	},
+	ProtocolAND: func(models.WeighingStation) (Driver, error) {
+		return &ANDDriver{}, nil
+	},
+	ProtocolRinstrun: func(models.WeighingStation) (Driver, error) {
+		return &RinstrunDriver{}, nil
+	},
+	ProtocolModbusRTU: func(st models.WeighingStation) (Driver, error) {
+		return NewModbusDriver(st, false)
+	},
+	ProtocolModbusTCP: func(st models.WeighingStation) (Driver, error) {
+		return NewModbusDriver(st, true)
+	},
+	// Avery Weigh-Tronix indicators built on Rinstrun boards use the same output
+	"avery": func(models.WeighingStation) (Driver, error) {
+		return &RinstrunDriver{}, nil
+	},
+}
+
+// NewDriver builds the protocol driver configured for a station.
+// An empty protocol keeps the legacy "strip everything but digits" behaviour.
+func NewDriver(station models.WeighingStation) (Driver, error) {
+	name := strings.ToLower(strings.TrimSpace(station.Protocol))
+	if name == "" {
+		name = ProtocolGeneric
+	}
+	factory, ok := driverRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scale protocol %q", station.Protocol)
+	}
+	return factory(station)
+}
+
+// Protocols lists the registered protocol keys, for settings pages
+func Protocols() []string {
+	names := make([]string, 0, len(driverRegistry))
+	for name := range driverRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
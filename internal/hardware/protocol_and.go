@@ -0,0 +1,105 @@
+package hardware
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ANDDriver decodes the A&D standard output format:
+//
+//	ST,GS,+0012.345kg CR LF
+//
+// Header 1 is ST (stable), US (unstable) or OL (overload);
+// header 2 is GS (gross), NT (net) or TR (tare).
+type ANDDriver struct{}
+
+func (d *ANDDriver) Name() string { return ProtocolAND }
+
+func (d *ANDDriver) SplitFunc() bufio.SplitFunc { return splitCRorLF }
+
+// Encode implements Commander with the A&D Z/T/P commands, CR LF terminated
+func (d *ANDDriver) Encode(cmd Command) ([]byte, error) {
+	return asciiCommand(cmd, "\r\n")
+}
+
+// Frame implements Framer
+func (d *ANDDriver) Frame(r Reading) []byte {
+	header := "US"
+	switch {
+	case r.Overload:
+		header = "OL"
+	case r.Stable:
+		header = "ST"
+	}
+	mode := "GS"
+	if r.Mode == ModeNet {
+		mode = "NT"
+	}
+	return []byte(fmt.Sprintf("%s,%s,%+08.0f%s\r\n", header, mode, r.Weight, r.Unit))
+}
+
+func (d *ANDDriver) Parse(frame []byte) (Reading, error) {
+	text := strings.TrimSpace(string(frame))
+	parts := strings.SplitN(text, ",", 3)
+	if len(parts) != 3 {
+		return Reading{}, ErrInvalidFrame
+	}
+
+	r := Reading{HasMotion: true, HasMode: true, Raw: text}
+	switch strings.ToUpper(strings.TrimSpace(parts[0])) {
+	case "ST":
+		r.Stable = true
+	case "US":
+		r.Stable = false
+	case "OL":
+		r.Overload = true
+	default:
+		return Reading{}, ErrInvalidFrame
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(parts[1])) {
+	case "GS":
+		r.Mode = ModeGross
+	case "NT":
+		r.Mode = ModeNet
+	default:
+		// TR frames carry the stored tare, not the load on the platform
+		return Reading{}, ErrInvalidFrame
+	}
+
+	value, unit := splitValueUnit(parts[2])
+	r.Unit = strings.ToLower(unit)
+	if r.Overload {
+		// Overload frames blank the digits with 9s or letters
+		if w, err := strconv.ParseFloat(value, 64); err == nil {
+			r.Weight = w
+			r.Negative = w < 0
+		}
+		return r, nil
+	}
+
+	w, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return Reading{}, ErrInvalidFrame
+	}
+	r.Weight = w
+	r.Negative = strings.HasPrefix(value, "-")
+	return r, nil
+}
+
+// splitValueUnit separates "+0012.345 kg" into "+0012.345" and "kg"
+func splitValueUnit(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	end := len(s)
+	for end > 0 {
+		c := s[end-1]
+		if (c >= '0' && c <= '9') || c == '.' {
+			break
+		}
+		end--
+	}
+	value := strings.ReplaceAll(s[:end], " ", "")
+	return value, strings.TrimSpace(s[end:])
+}
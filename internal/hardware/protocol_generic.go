@@ -0,0 +1,113 @@
+package hardware
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GenericDriver reads line based ASCII indicators.
+//
+// With a pattern, the regular expression must have a named group "weight"
+// and may have "sign", "unit", "mode" (N/NT/NET = net) and "stable".
+// When a "stable" group exists the frame is stable only if it matched.
+// Without a pattern every non-digit character is stripped (legacy behaviour).
+type GenericDriver struct {
+	pattern *regexp.Regexp
+}
+
+func NewGenericDriver(pattern string) (*GenericDriver, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return &GenericDriver{}, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protocol pattern: %w", err)
+	}
+	if re.SubexpIndex("weight") < 0 {
+		return nil, fmt.Errorf("protocol pattern needs a (?P<weight>...) group")
+	}
+	return &GenericDriver{pattern: re}, nil
+}
+
+func (d *GenericDriver) Name() string { return ProtocolGeneric }
+
+func (d *GenericDriver) SplitFunc() bufio.SplitFunc { return splitCRorLF }
+
+// Encode implements Commander with the single letter commands most ASCII
+// indicators understand (Z, T, P), CR LF terminated
+func (d *GenericDriver) Encode(cmd Command) ([]byte, error) {
+	return asciiCommand(cmd, "\r\n")
+}
+
+// Frame implements Framer with a plain "ST +0012345 kg" line, which the
+// legacy parser reads as is and a pattern such as
+// (?P<stable>ST)?\s*(?P<sign>[+-])(?P<weight>\d+)\s*(?P<unit>\w+) fully decodes
+func (d *GenericDriver) Frame(r Reading) []byte {
+	status := "US"
+	if r.Stable {
+		status = "ST"
+	}
+	return []byte(fmt.Sprintf("%s %+08.0f %s\r\n", status, r.Weight, r.Unit))
+}
+
+func (d *GenericDriver) Parse(frame []byte) (Reading, error) {
+	text := string(frame)
+	if d.pattern == nil {
+		w := parseWeight(text)
+		return Reading{Weight: w, Negative: w < 0, Mode: ModeGross, Raw: text}, nil
+	}
+
+	m := d.pattern.FindStringSubmatch(text)
+	if m == nil {
+		return Reading{}, ErrInvalidFrame
+	}
+	group := func(name string) (string, bool) {
+		i := d.pattern.SubexpIndex(name)
+		if i < 0 {
+			return "", false
+		}
+		return strings.TrimSpace(m[i]), true
+	}
+
+	value, _ := group("weight")
+	w, err := strconv.ParseFloat(strings.ReplaceAll(value, " ", ""), 64)
+	if err != nil {
+		return Reading{}, ErrInvalidFrame
+	}
+	if sign, ok := group("sign"); ok && sign == "-" {
+		w = -w
+	}
+
+	r := Reading{Weight: w, Negative: w < 0, Mode: ModeGross, Raw: text}
+	if unit, ok := group("unit"); ok {
+		r.Unit = strings.ToLower(unit)
+	}
+	if mode, ok := group("mode"); ok {
+		r.HasMode = true
+		if strings.HasPrefix(strings.ToUpper(mode), "N") {
+			r.Mode = ModeNet
+		}
+	}
+	if stable, ok := group("stable"); ok {
+		r.HasMotion = true
+		r.Stable = stable != ""
+	}
+	return r, nil
+}
+
+func parseWeight(raw string) float64 {
+	clean := strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, raw)
+
+	if val, err := strconv.ParseFloat(clean, 64); err == nil {
+		return val
+	}
+	return 0.0
+}
@@ -0,0 +1,299 @@
+package hardware
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+	"stoneweigh/internal/models"
+)
+
+// Modbus register data types accepted in WeighingStation.ModbusDataType
+const (
+	ModbusInt16   = "int16"
+	ModbusUint16  = "uint16"
+	ModbusInt32   = "int32"
+	ModbusUint32  = "uint32"
+	ModbusFloat32 = "float32"
+)
+
+const (
+	modbusReadInputs    = 0x02 // Discrete inputs, see the position sensors
+	modbusReadHolding   = 0x03
+	modbusDefaultPoll   = 200 * time.Millisecond
+	modbusResponseLimit = time.Second // Per request, before the device counts as gone
+)
+
+var errModbusTimeout = errors.New("modbus: no response")
+
+// ModbusDriver polls the weight from holding registers of a PLC or a
+// load-cell summing box, either as Modbus RTU (serial, or RTU over a raw
+// TCP converter) or Modbus TCP (MBAP header, usually port 502).
+type ModbusDriver struct {
+	TCP       bool
+	UnitID    byte
+	Register  uint16
+	DataType  string
+	WordOrder string // "big" or "little"
+	Scale     float64
+	Every     time.Duration
+
+	txID uint16
+}
+
+// NewModbusDriver builds the poller from the station's register mapping
+func NewModbusDriver(st models.WeighingStation, tcp bool) (*ModbusDriver, error) {
+	d := &ModbusDriver{
+		TCP:       tcp,
+		UnitID:    1,
+		DataType:  strings.ToLower(strings.TrimSpace(st.ModbusDataType)),
+		WordOrder: strings.ToLower(strings.TrimSpace(st.ModbusWordOrder)),
+		Scale:     st.ModbusScale,
+		Every:     time.Duration(st.PollIntervalMs) * time.Millisecond,
+	}
+	if st.ModbusUnitID != 0 {
+		if st.ModbusUnitID < 0 || st.ModbusUnitID > 247 {
+			return nil, fmt.Errorf("invalid modbus unit id %d", st.ModbusUnitID)
+		}
+		d.UnitID = byte(st.ModbusUnitID)
+	}
+	if st.ModbusRegister < 0 || st.ModbusRegister > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid modbus register %d", st.ModbusRegister)
+	}
+	d.Register = uint16(st.ModbusRegister)
+
+	switch d.DataType {
+	case "":
+		d.DataType = ModbusInt32
+	case ModbusInt16, ModbusUint16, ModbusInt32, ModbusUint32, ModbusFloat32:
+	default:
+		return nil, fmt.Errorf("invalid modbus data type %q", st.ModbusDataType)
+	}
+	switch d.WordOrder {
+	case "":
+		d.WordOrder = "big"
+	case "big", "little":
+	default:
+		return nil, fmt.Errorf("invalid modbus word order %q", st.ModbusWordOrder)
+	}
+	if d.Scale == 0 {
+		d.Scale = 1
+	}
+	if d.Every <= 0 {
+		d.Every = modbusDefaultPoll
+	}
+	return d, nil
+}
+
+func (d *ModbusDriver) Name() string {
+	if d.TCP {
+		return ProtocolModbusTCP
+	}
+	return ProtocolModbusRTU
+}
+
+// SplitFunc is unused: Modbus devices are polled, see Poll
+func (d *ModbusDriver) SplitFunc() bufio.SplitFunc { return bufio.ScanBytes }
+
+func (d *ModbusDriver) Interval() time.Duration { return d.Every }
+
+// quantity is the number of 16-bit registers holding the value
+func (d *ModbusDriver) quantity() uint16 {
+	if d.DataType == ModbusInt16 || d.DataType == ModbusUint16 {
+		return 1
+	}
+	return 2
+}
+
+// Parse decodes the register bytes of a read holding registers response
+func (d *ModbusDriver) Parse(data []byte) (Reading, error) {
+	if len(data) != int(d.quantity())*2 {
+		return Reading{}, ErrInvalidFrame
+	}
+
+	var v float64
+	switch d.DataType {
+	case ModbusInt16:
+		v = float64(int16(binary.BigEndian.Uint16(data)))
+	case ModbusUint16:
+		v = float64(binary.BigEndian.Uint16(data))
+	default:
+		hi, lo := binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+		if d.WordOrder == "little" {
+			hi, lo = lo, hi
+		}
+		raw := uint32(hi)<<16 | uint32(lo)
+		switch d.DataType {
+		case ModbusInt32:
+			v = float64(int32(raw))
+		case ModbusUint32:
+			v = float64(raw)
+		case ModbusFloat32:
+			v = float64(math.Float32frombits(raw))
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return Reading{}, ErrInvalidFrame
+			}
+		}
+	}
+
+	w := roundTo(v*d.Scale, 6)
+	return Reading{
+		Weight:   w,
+		Negative: w < 0,
+		Mode:     ModeGross,
+		Raw:      fmt.Sprintf("% X", data),
+	}, nil
+}
+
+// Poll sends one read holding registers request and decodes the answer
+func (d *ModbusDriver) Poll(rw io.ReadWriter) (Reading, error) {
+	pdu := []byte{modbusReadHolding, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(pdu[1:], d.Register)
+	binary.BigEndian.PutUint16(pdu[3:], d.quantity())
+
+	data, err := d.roundTrip(rw, pdu)
+	if err != nil {
+		return Reading{}, err
+	}
+	return d.Parse(data)
+}
+
+// roundTrip sends a read request and returns the data bytes of the
+// answer, after the byte count. The function code is pdu[0].
+func (d *ModbusDriver) roundTrip(rw io.ReadWriter, pdu []byte) ([]byte, error) {
+	if d.TCP {
+		return d.roundTripTCP(rw, pdu)
+	}
+	return d.roundTripRTU(rw, pdu)
+}
+
+func (d *ModbusDriver) roundTripRTU(rw io.ReadWriter, pdu []byte) ([]byte, error) {
+	// Drop leftovers of a garbled previous answer so framing stays aligned
+	if r, ok := rw.(interface{ ResetInputBuffer() error }); ok {
+		r.ResetInputBuffer()
+	}
+
+	req := append([]byte{d.UnitID}, pdu...)
+	req = binary.LittleEndian.AppendUint16(req, crc16(req))
+	if _, err := rw.Write(req); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(modbusResponseLimit)
+	head := make([]byte, 3) // unit, function, byte count or exception code
+	if err := readFull(rw, head, deadline); err != nil {
+		return nil, err
+	}
+	if head[1] == pdu[0]|0x80 {
+		readFull(rw, make([]byte, 2), deadline) // CRC
+		return nil, fmt.Errorf("modbus exception %d: %w", head[2], ErrInvalidFrame)
+	}
+	rest := make([]byte, int(head[2])+2)
+	if err := readFull(rw, rest, deadline); err != nil {
+		return nil, err
+	}
+	frame := append(head, rest...)
+	body := frame[:len(frame)-2]
+	if crc16(body) != binary.LittleEndian.Uint16(frame[len(frame)-2:]) {
+		return nil, fmt.Errorf("modbus crc mismatch: %w", ErrInvalidFrame)
+	}
+	if head[0] != d.UnitID || head[1] != pdu[0] {
+		return nil, ErrInvalidFrame
+	}
+	return body[3:], nil
+}
+
+func (d *ModbusDriver) roundTripTCP(rw io.ReadWriter, pdu []byte) ([]byte, error) {
+	d.txID++
+	req := make([]byte, 7, 7+len(pdu))
+	binary.BigEndian.PutUint16(req[0:], d.txID)
+	binary.BigEndian.PutUint16(req[4:], uint16(len(pdu)+1))
+	req[6] = d.UnitID
+	req = append(req, pdu...)
+	if _, err := rw.Write(req); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(modbusResponseLimit)
+	for {
+		mbap := make([]byte, 7)
+		if err := readFull(rw, mbap, deadline); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(mbap[4:]))
+		if length < 3 || length > 254 {
+			return nil, fmt.Errorf("modbus length %d: %w", length, ErrInvalidFrame)
+		}
+		body := make([]byte, length-1)
+		if err := readFull(rw, body, deadline); err != nil {
+			return nil, err
+		}
+		// A late answer to an earlier, timed-out request: wait for ours
+		if binary.BigEndian.Uint16(mbap) != d.txID {
+			continue
+		}
+		if body[0] == pdu[0]|0x80 {
+			return nil, fmt.Errorf("modbus exception %d: %w", body[1], ErrInvalidFrame)
+		}
+		if body[0] != pdu[0] || int(body[1]) != len(body)-2 {
+			return nil, ErrInvalidFrame
+		}
+		return body[2:], nil
+	}
+}
+
+// readFull is io.ReadFull with a deadline. Serial ports signal a read
+// timeout with (0, nil) instead of an error, so set a short read timeout
+// where the stream supports one and loop until the deadline.
+func readFull(r io.Reader, buf []byte, deadline time.Time) error {
+	switch s := r.(type) {
+	case interface{ SetReadDeadline(time.Time) error }:
+		s.SetReadDeadline(deadline)
+		defer s.SetReadDeadline(time.Time{})
+	case interface{ SetReadTimeout(time.Duration) error }:
+		s.SetReadTimeout(50 * time.Millisecond)
+		defer s.SetReadTimeout(serial.NoTimeout)
+	}
+
+	for n := 0; n < len(buf); {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return errModbusTimeout
+			}
+			return err
+		}
+		if n < len(buf) && time.Now().After(deadline) {
+			return errModbusTimeout
+		}
+	}
+	return nil
+}
+
+// ModbusCRC is the CRC of Modbus RTU frames, for other Modbus clients
+// such as the relay outputs
+func ModbusCRC(data []byte) uint16 { return crc16(data) }
+
+// crc16 is the Modbus RTU CRC (poly 0xA001, init 0xFFFF)
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
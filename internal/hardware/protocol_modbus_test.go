@@ -0,0 +1,118 @@
+package hardware
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"testing"
+
+	"stoneweigh/internal/models"
+)
+
+func TestModbusCRC(t *testing.T) {
+	// Reference frame from the Modbus over serial line specification
+	req := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A}
+	if got := crc16(req); got != 0xCDC5 {
+		t.Errorf("crc16 = %04X, want CDC5", got)
+	}
+}
+
+func TestModbusParse(t *testing.T) {
+	float := make([]byte, 4)
+	binary.BigEndian.PutUint32(float, math.Float32bits(24510.5))
+
+	tests := []struct {
+		station models.WeighingStation
+		data    []byte
+		want    float64
+	}{
+		{models.WeighingStation{ModbusDataType: "int16"}, []byte{0xFF, 0x38}, -200},
+		{models.WeighingStation{ModbusDataType: "uint16", ModbusScale: 10}, []byte{0x09, 0x29}, 23450},
+		{models.WeighingStation{}, []byte{0x00, 0x01, 0x5F, 0x90}, 90000},
+		{models.WeighingStation{ModbusWordOrder: "little"}, []byte{0x5F, 0x90, 0x00, 0x01}, 90000},
+		{models.WeighingStation{ModbusDataType: "int32", ModbusScale: 0.1}, []byte{0xFF, 0xFF, 0xFF, 0x9C}, -10},
+		{models.WeighingStation{ModbusDataType: "float32"}, float, 24510.5},
+	}
+	for _, tt := range tests {
+		d, err := NewModbusDriver(tt.station, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := d.Parse(tt.data)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.station, err)
+		}
+		if r.Weight != tt.want || r.Negative != (tt.want < 0) {
+			t.Errorf("%s/%s: got %+v, want %v", d.DataType, d.WordOrder, r, tt.want)
+		}
+	}
+
+	if _, err := NewModbusDriver(models.WeighingStation{ModbusDataType: "int64"}, false); err == nil {
+		t.Error("expected error for unknown data type")
+	}
+}
+
+// fakeSlave answers one read holding registers request with the given registers
+func fakeSlave(t *testing.T, conn net.Conn, tcp bool, regs []byte) {
+	t.Helper()
+	if tcp {
+		req := make([]byte, 12)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			t.Error(err)
+			return
+		}
+		resp := append([]byte{}, req[:4]...)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(3+len(regs)))
+		resp = append(resp, req[6], req[7], byte(len(regs)))
+		conn.Write(append(resp, regs...))
+		return
+	}
+
+	req := make([]byte, 8)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		t.Error(err)
+		return
+	}
+	if crc16(req[:6]) != binary.LittleEndian.Uint16(req[6:]) {
+		t.Error("request CRC mismatch")
+	}
+	resp := append([]byte{req[0], req[1], byte(len(regs))}, regs...)
+	conn.Write(binary.LittleEndian.AppendUint16(resp, crc16(resp)))
+}
+
+func TestModbusPoll(t *testing.T) {
+	for _, protocol := range []string{ProtocolModbusRTU, ProtocolModbusTCP} {
+		d, err := NewDriver(models.WeighingStation{Protocol: protocol, ModbusUnitID: 5, ModbusRegister: 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		poller := d.(Poller)
+
+		client, device := net.Pipe()
+		go fakeSlave(t, device, protocol == ProtocolModbusTCP, []byte{0x00, 0x00, 0x5F, 0xB4})
+
+		r, err := poller.Poll(client)
+		if err != nil {
+			t.Fatalf("%s: %v", protocol, err)
+		}
+		if r.Weight != 24500 {
+			t.Errorf("%s: got %+v", protocol, r)
+		}
+		client.Close()
+		device.Close()
+	}
+}
+
+func TestModbusPollTimeout(t *testing.T) {
+	d, _ := NewModbusDriver(models.WeighingStation{}, true)
+	client, device := net.Pipe()
+	defer client.Close()
+	defer device.Close()
+
+	// The device swallows the request and never answers
+	go io.Copy(io.Discard, device)
+	if _, err := d.Poll(client); err != errModbusTimeout {
+		t.Errorf("expected timeout, got %v", err)
+	}
+}
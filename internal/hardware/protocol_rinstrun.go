@@ -0,0 +1,65 @@
+package hardware
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// RinstrunDriver decodes the Rinstrun / Avery auto output "format A":
+//
+//	STX S WWWWWWW S1 S2 S3 S4 [units] ETX
+//
+// S is the sign (' ' or '-'), the weight is 7 characters including the
+// decimal point, S1 is G/N (gross/net) or U/O/E (under, over, error),
+// S2 is 'M' while the load is in motion. Under, over and error frames are
+// reported as overload: their weight is not to be trusted.
+type RinstrunDriver struct{}
+
+func (d *RinstrunDriver) Name() string { return ProtocolRinstrun }
+
+func (d *RinstrunDriver) SplitFunc() bufio.SplitFunc { return splitSTXETX }
+
+func (d *RinstrunDriver) Parse(frame []byte) (Reading, error) {
+	if len(frame) < 10 {
+		return Reading{}, ErrInvalidFrame
+	}
+
+	r := Reading{
+		Mode:      ModeGross,
+		HasMotion: true,
+		HasMode:   true,
+		Raw:       string(frame),
+	}
+	r.Negative = frame[0] == '-'
+
+	digits := strings.ReplaceAll(string(frame[1:8]), " ", "")
+	status := frame[8]
+	switch status {
+	case 'G':
+	case 'N':
+		r.Mode = ModeNet
+	case 'U', 'O', 'E':
+		r.Overload = true
+	default:
+		return Reading{}, ErrInvalidFrame
+	}
+	r.Stable = frame[9] != 'M'
+
+	if len(frame) > 12 {
+		r.Unit = strings.ToLower(strings.TrimSpace(string(frame[12:])))
+	}
+
+	w, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		if r.Overload {
+			return r, nil
+		}
+		return Reading{}, ErrInvalidFrame
+	}
+	if r.Negative {
+		w = -w
+	}
+	r.Weight = w
+	return r, nil
+}
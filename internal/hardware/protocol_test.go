@@ -0,0 +1,209 @@
+package hardware
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"stoneweigh/internal/models"
+)
+
+// toledoFrame builds a continuous output frame with a valid checksum
+func toledoFrame(swa, swb byte, weight string, withChecksum bool) []byte {
+	frame := append([]byte{stx, swa, swb, 0x20}, []byte(weight+"000000")...)
+	frame = append(frame, cr)
+	if withChecksum {
+		var sum byte
+		for _, b := range frame {
+			sum += b
+		}
+		frame = append(frame, (-sum)&0x7F)
+	}
+	return frame
+}
+
+func TestToledoParse(t *testing.T) {
+	d := &ToledoDriver{}
+
+	// x1, gross, kg, stable
+	r, err := d.Parse(toledoFrame(0x22, 0x30, "012345", false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Weight != 12345 || r.Unit != "kg" || !r.Stable || r.Mode != ModeGross {
+		t.Errorf("got %+v", r)
+	}
+
+	// 1 decimal, net, negative, in motion, checksum present
+	r, err = d.Parse(toledoFrame(0x23, 0x3B, "001234", true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Weight != -123.4 || !r.Negative || r.Stable || r.Mode != ModeNet {
+		t.Errorf("got %+v", r)
+	}
+
+	bad := toledoFrame(0x22, 0x30, "012345", true)
+	bad[len(bad)-1] ^= 0x01
+	if _, err := d.Parse(bad); err == nil {
+		t.Error("expected checksum failure")
+	}
+}
+
+func TestToledoSplit(t *testing.T) {
+	var stream []byte
+	stream = append(stream, 'x', 'y') // line noise before the first frame
+	stream = append(stream, toledoFrame(0x22, 0x30, "000100", true)...)
+	stream = append(stream, toledoFrame(0x22, 0x30, "000200", true)...)
+	stream = append(stream, toledoFrame(0x22, 0x30, "000300", false)...)
+
+	d := &ToledoDriver{}
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	scanner.Split(d.SplitFunc())
+
+	var got []float64
+	for scanner.Scan() {
+		r, err := d.Parse(scanner.Bytes())
+		if err != nil {
+			t.Fatalf("frame %q: %v", scanner.Bytes(), err)
+		}
+		got = append(got, r.Weight)
+	}
+	if len(got) != 3 || got[0] != 100 || got[1] != 200 || got[2] != 300 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestToledoSplitChecksumSTX(t *testing.T) {
+	// A checksum that happens to be STX, then the same frame garbled in
+	// transit with its checksum intact
+	good := toledoFrame(0x25, 0x38, "599999", true)
+	if good[len(good)-1] != stx {
+		t.Fatalf("checksum %#x, want STX", good[len(good)-1])
+	}
+	garbled := append([]byte(nil), good...)
+	garbled[9] = '8'
+	var stream []byte
+	stream = append(stream, good...)
+	stream = append(stream, garbled...)
+	stream = append(stream, toledoFrame(0x22, 0x30, "000200", true)...)
+
+	d := &ToledoDriver{}
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	scanner.Split(d.SplitFunc())
+	var frames [][]byte
+	for scanner.Scan() {
+		frames = append(frames, append([]byte(nil), scanner.Bytes()...))
+	}
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames: %q", len(frames), frames)
+	}
+	if r, err := d.Parse(frames[0]); err != nil || r.Weight != 599.999 {
+		t.Errorf("first = %+v, %v", r, err)
+	}
+	if r, err := d.Parse(frames[1]); err == nil {
+		t.Errorf("garbled frame accepted: %+v", r)
+	}
+	if r, err := d.Parse(frames[2]); err != nil || r.Weight != 200 {
+		t.Errorf("third = %+v, %v", r, err)
+	}
+}
+
+func TestANDParse(t *testing.T) {
+	tests := []struct {
+		input  string
+		weight float64
+		stable bool
+		mode   WeighMode
+		err    bool
+	}{
+		{"ST,GS,+0012345kg", 12345, true, ModeGross, false},
+		{"US,NT,-0000123.5 kg", -123.5, false, ModeNet, false},
+		{"ST,TR,+0001000kg", 0, false, "", true},
+		{"garbage", 0, false, "", true},
+	}
+
+	d := &ANDDriver{}
+	for _, tt := range tests {
+		r, err := d.Parse([]byte(tt.input))
+		if tt.err {
+			if err == nil {
+				t.Errorf("Parse(%q) expected error", tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.input, err)
+			continue
+		}
+		if r.Weight != tt.weight || r.Stable != tt.stable || r.Mode != tt.mode || r.Unit != "kg" {
+			t.Errorf("Parse(%q) = %+v", tt.input, r)
+		}
+	}
+}
+
+func TestRinstrunParse(t *testing.T) {
+	d := &RinstrunDriver{}
+	scanner := bufio.NewScanner(bytes.NewReader([]byte("\x02   12340G  -kg\x03\x02-  150.5NM -\x03")))
+	scanner.Split(d.SplitFunc())
+
+	var readings []Reading
+	for scanner.Scan() {
+		r, err := d.Parse(scanner.Bytes())
+		if err != nil {
+			t.Fatalf("frame %q: %v", scanner.Bytes(), err)
+		}
+		readings = append(readings, r)
+	}
+	if len(readings) != 2 {
+		t.Fatalf("got %d readings", len(readings))
+	}
+	if r := readings[0]; r.Weight != 12340 || !r.Stable || r.Mode != ModeGross || r.Unit != "kg" {
+		t.Errorf("first = %+v", r)
+	}
+	if r := readings[1]; r.Weight != -150.5 || r.Stable || r.Mode != ModeNet {
+		t.Errorf("second = %+v", r)
+	}
+
+	// An indicator in error shows no weight
+	r, err := d.Parse([]byte(" -------E  -kg"))
+	if err != nil || !r.Overload {
+		t.Errorf("error frame = %+v, %v", r, err)
+	}
+}
+
+func TestGenericPattern(t *testing.T) {
+	d, err := NewGenericDriver(`^(?P<stable>S)?\s*W(?P<sign>[+-])(?P<weight>[\d.]+)(?P<unit>kg)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Parse([]byte("S W-00250kg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Weight != -250 || !r.HasMotion || !r.Stable || r.Unit != "kg" {
+		t.Errorf("got %+v", r)
+	}
+	r, _ = d.Parse([]byte("W+00100kg"))
+	if r.Stable {
+		t.Errorf("expected unstable, got %+v", r)
+	}
+
+	if _, err := NewGenericDriver(`(?P<kg>\d+)`); err == nil {
+		t.Error("expected error for pattern without weight group")
+	}
+}
+
+func TestNewDriver(t *testing.T) {
+	d, err := NewDriver(models.WeighingStation{})
+	if err != nil || d.Name() != ProtocolGeneric {
+		t.Errorf("empty protocol should default to generic, got %v, %v", d, err)
+	}
+	d, err = NewDriver(models.WeighingStation{Protocol: "Avery"})
+	if err != nil || d.Name() != ProtocolRinstrun {
+		t.Errorf("avery should map to rinstrun, got %v, %v", d, err)
+	}
+	if _, err := NewDriver(models.WeighingStation{Protocol: "unknown"}); err == nil {
+		t.Error("expected error for unknown protocol")
+	}
+}
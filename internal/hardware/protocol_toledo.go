@@ -0,0 +1,155 @@
+package hardware
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ToledoDriver decodes the Mettler Toledo "continuous output" format:
+//
+//	STX SWA SWB SWC W W W W W W T T T T T T CR [CKS]
+//
+// SWA carries the decimal point position, SWB the net/sign/range/motion/unit
+// bits. The optional checksum byte is verified when present.
+type ToledoDriver struct{}
+
+const toledoFrameLen = 17 // STX + 3 status + 6 weight + 6 tare + CR
+
+func (d *ToledoDriver) Name() string { return ProtocolToledo }
+
+func (d *ToledoDriver) SplitFunc() bufio.SplitFunc { return newToledoSplit() }
+
+// newToledoSplit finds STX-started, CR-terminated frames and keeps the
+// checksum byte with its frame when the indicator sends one. Whether it
+// does is decided once per stream from the first frame, since a checksum
+// byte may itself equal STX.
+func newToledoSplit() bufio.SplitFunc {
+	checksum := -1 // Bytes after the CR, unknown until the first frame
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		start := bytes.IndexByte(data, stx)
+		if start < 0 {
+			return len(data), nil, nil
+		}
+		avail := len(data) - start
+		need := toledoFrameLen + checksum
+		if checksum < 0 {
+			// The CR, the byte after it and the one after that
+			need = toledoFrameLen + 2
+		}
+		if avail < need {
+			if atEOF {
+				if avail >= toledoFrameLen && data[start+toledoFrameLen-1] == cr {
+					return len(data), data[start:], nil
+				}
+				return len(data), nil, nil
+			}
+			return start, nil, nil
+		}
+		if data[start+toledoFrameLen-1] != cr {
+			// STX was noise, resync on the next one
+			return start + 1, nil, nil
+		}
+		if checksum < 0 {
+			// The next frame starts right away, or after a checksum byte.
+			// SWA never equals STX, so STX twice is a checksum of STX.
+			checksum = 0
+			if next := data[start+toledoFrameLen]; next != stx || data[start+toledoFrameLen+1] == stx {
+				checksum = 1
+			}
+		}
+		n := toledoFrameLen + checksum
+		return start + n, data[start : start+n], nil
+	}
+}
+
+// Encode implements Commander: Toledo continuous output indicators accept
+// single letter commands (Z zero, T tare, P print) terminated by CR.
+func (d *ToledoDriver) Encode(cmd Command) ([]byte, error) {
+	return asciiCommand(cmd, "\r")
+}
+
+// Frame implements Framer: x1 weight, kg, no tare, with checksum
+func (d *ToledoDriver) Frame(r Reading) []byte {
+	swa, swb := byte(0x22), byte(0x30)
+	if r.Mode == ModeNet {
+		swb |= 0x01
+	}
+	if r.Weight < 0 {
+		swb |= 0x02
+	}
+	if r.Overload {
+		swb |= 0x04
+	}
+	if !r.Stable {
+		swb |= 0x08
+	}
+	digits := math.Min(math.Round(math.Abs(r.Weight)), 999999)
+	frame := append([]byte{stx, swa, swb, 0x20}, fmt.Sprintf("%06.0f000000", digits)...)
+	frame = append(frame, cr)
+	var sum byte
+	for _, b := range frame {
+		sum += b
+	}
+	return append(frame, (-sum)&0x7F)
+}
+
+func (d *ToledoDriver) Parse(frame []byte) (Reading, error) {
+	if len(frame) < toledoFrameLen || frame[0] != stx || frame[toledoFrameLen-1] != cr {
+		return Reading{}, ErrInvalidFrame
+	}
+	if len(frame) > toledoFrameLen {
+		var sum byte
+		for _, b := range frame[:toledoFrameLen+1] {
+			sum += b
+		}
+		if sum&0x7F != 0 {
+			return Reading{}, ErrInvalidFrame
+		}
+	}
+
+	swa, swb := frame[1], frame[2]
+	digits := strings.TrimSpace(string(frame[4:10]))
+	raw, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return Reading{}, ErrInvalidFrame
+	}
+
+	// SWA bits 0-2: 0 = x100, 1 = x10, 2 = x1, 3..7 = 1..5 decimal places
+	exp := 2 - int(swa&0x07)
+	weight := float64(raw) * math.Pow10(exp)
+
+	r := Reading{
+		Mode:      ModeGross,
+		Unit:      "lb",
+		Negative:  swb&0x02 != 0,
+		Overload:  swb&0x04 != 0,
+		Stable:    swb&0x08 == 0,
+		HasMotion: true,
+		HasMode:   true,
+		Raw:       string(frame),
+	}
+	if swb&0x01 != 0 {
+		r.Mode = ModeNet
+	}
+	if swb&0x10 != 0 {
+		r.Unit = "kg"
+	}
+	if r.Negative {
+		weight = -weight
+	}
+	r.Weight = roundTo(weight, int(swa&0x07)-2)
+	return r, nil
+}
+
+// roundTo trims float noise introduced by scaling to the given decimals
+func roundTo(v float64, decimals int) float64 {
+	if decimals <= 0 {
+		return math.Round(v)
+	}
+	p := math.Pow10(decimals)
+	return math.Round(v*p) / p
+}
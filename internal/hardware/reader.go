@@ -0,0 +1,347 @@
+package hardware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"stoneweigh/internal/models"
+)
+
+// Tag reader protocols accepted in WeighingStation.ReaderProtocol
+const (
+	// ReaderWiegand is a Wiegand-to-RS232 converter sending one card per
+	// line: the card number in decimal, or the raw frame as "W26 <hex>" /
+	// "W34 <hex>", whose parity is checked and whose card number is kept
+	ReaderWiegand = "wiegand"
+	// ReaderASCII is a reader sending tag IDs in hex, one per line (UHF
+	// readers in ASCII output mode), or EM4100 frames of 10 hex digits and
+	// an XOR checksum between STX and ETX (RDM6300 style)
+	ReaderASCII = "ascii"
+)
+
+// TagRepeat is how long a tag must be out of the reader's field before a
+// read of it counts again. UHF readers repeat a tag many times a second
+// while the truck stands on the scale.
+const TagRepeat = 5 * time.Second
+
+// TagRead is a card or tag read at a station
+type TagRead struct {
+	ScaleID uint      `json:"scale_id"`
+	Tag     string    `json:"tag"`
+	At      time.Time `json:"at"`
+}
+
+// NormalizeTag brings a tag ID into the form reads are reported in, so IDs
+// typed into the vehicle master match: upper case hex without separators,
+// short decimal card numbers padded to the 10 digits printed on the cards
+func NormalizeTag(s string) (string, error) {
+	s = strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == ' ' || r == ':' || r == '-' {
+			return -1
+		}
+		return r
+	}, s))
+	if len(s) < 4 || len(s) > 64 {
+		return "", fmt.Errorf("invalid tag ID %q", s)
+	}
+	digits := true
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+		case r >= 'A' && r <= 'F':
+			digits = false
+		default:
+			return "", fmt.Errorf("invalid tag ID %q", s)
+		}
+	}
+	if digits && len(s) < 10 {
+		s = strings.Repeat("0", 10-len(s)) + s
+	}
+	return s, nil
+}
+
+// ParseTag decodes one reader frame into a normalized tag ID
+func ParseTag(protocol string, frame []byte) (string, error) {
+	switch protocol {
+	case ReaderWiegand:
+		return parseWiegand(strings.TrimSpace(string(frame)))
+	case ReaderASCII:
+		if i := bytes.LastIndexByte(frame, stx); i >= 0 {
+			return parseEM4100(strings.TrimSpace(string(frame[i+1:])))
+		}
+		return NormalizeTag(strings.TrimSpace(string(frame)))
+	default:
+		return "", fmt.Errorf("unknown tag reader protocol %q", protocol)
+	}
+}
+
+// parseWiegand reads a converter line: a decimal card number, or a raw
+// 26 or 34 bit frame. Raw frames carry an even parity bit over the first
+// half of the data and an odd one over the second.
+func parseWiegand(line string) (string, error) {
+	upper := strings.ToUpper(line)
+	var length int
+	switch {
+	case strings.HasPrefix(upper, "W26"):
+		length = 26
+	case strings.HasPrefix(upper, "W34"):
+		length = 34
+	default:
+		return NormalizeTag(line)
+	}
+	raw := strings.TrimLeft(upper[3:], " :,")
+	v, err := strconv.ParseUint(raw, 16, 64)
+	if err != nil || v>>length != 0 {
+		return "", fmt.Errorf("invalid Wiegand frame %q", line)
+	}
+	half := uint(length-2) / 2
+	mask := uint64(1)<<(half+1) - 1
+	if bits.OnesCount64(v>>(half+1))%2 != 0 || bits.OnesCount64(v&mask)%2 != 1 {
+		return "", fmt.Errorf("Wiegand parity error in %q", line)
+	}
+	card := (v >> 1) & (uint64(1)<<(length-2) - 1)
+	return NormalizeTag(strconv.FormatUint(card, 10))
+}
+
+// parseEM4100 checks the XOR checksum of an STX...ETX frame payload
+func parseEM4100(payload string) (string, error) {
+	data, err := hex.DecodeString(payload)
+	if err != nil || len(data) != 6 {
+		return "", fmt.Errorf("invalid EM4100 frame %q", payload)
+	}
+	var sum byte
+	for _, b := range data[:5] {
+		sum ^= b
+	}
+	if sum != data[5] {
+		return "", fmt.Errorf("EM4100 checksum error in %q", payload)
+	}
+	return NormalizeTag(payload[:10])
+}
+
+// splitTagFrames cuts reader output at CR, LF or ETX and drops empty
+// frames. An STX stays in the frame, it marks EM4100 framing.
+func splitTagFrames(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < len(data) && (data[start] == cr || data[start] == lf || data[start] == etx) {
+		start++
+	}
+	if i := bytes.IndexAny(data[start:], "\r\n\x03"); i >= 0 {
+		return start + i + 1, data[start : start+i], nil
+	}
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil
+	}
+	if len(data)-start > maxFrameLen {
+		return len(data), nil, nil
+	}
+	return start, nil, nil
+}
+
+// readerSettings are the station settings a running tag reader was built
+// from. The reader is independent of the scale link: changing one never
+// restarts the other.
+type readerSettings struct {
+	Protocol string
+	Port     string
+	BaudRate int
+}
+
+func readerOf(st models.WeighingStation) readerSettings {
+	return readerSettings{Protocol: st.ReaderProtocol, Port: strings.TrimSpace(st.ReaderPort), BaudRate: st.ReaderBaudRate}
+}
+
+// transport opens the reader port like a scale port, 8N1
+func (rs readerSettings) transport() (Transport, error) {
+	if rs.Port == "" {
+		return nil, fmt.Errorf("tag reader without a port")
+	}
+	return NewTransport(models.WeighingStation{ScalePort: rs.Port, BaudRate: rs.BaudRate})
+}
+
+// validateReader checks the tag reader settings of a station
+func validateReader(st models.WeighingStation) error {
+	rs := readerOf(st)
+	switch rs.Protocol {
+	case "":
+		return nil
+	case ReaderWiegand, ReaderASCII:
+		_, err := rs.transport()
+		return err
+	default:
+		return fmt.Errorf("unknown tag reader protocol %q", rs.Protocol)
+	}
+}
+
+// tagReader is the running reader of a station. Like a scale connection it
+// has one goroutine owning its port, stopped through stop and done.
+type tagReader struct {
+	settings  readerSettings
+	transport Transport
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu   sync.Mutex
+	port io.ReadWriteCloser
+}
+
+func (r *tagReader) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown stops the reader and returns a channel closed once its port
+// is released
+func (r *tagReader) shutdown() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopped() {
+		close(r.stop)
+		r.transport.Close()
+		if r.port != nil {
+			r.port.Close()
+		}
+	}
+	return r.done
+}
+
+// syncReader starts, restarts or stops the tag reader of a station to
+// match its settings. Callers must hold sm.Mu.
+func (sm *ScaleManager) syncReader(st models.WeighingStation) {
+	want := readerOf(st)
+	old := sm.readers[st.ID]
+	if old != nil && old.settings == want {
+		return
+	}
+	var prev <-chan struct{}
+	if old != nil {
+		prev = old.shutdown()
+		delete(sm.readers, st.ID)
+	}
+	if want.Protocol == "" {
+		return
+	}
+
+	transport, err := want.transport()
+	if err != nil {
+		log.Printf("Tag reader of station %d: %v", st.ID, err)
+		transport = errTransport{err}
+	}
+	r := &tagReader{settings: want, transport: transport, stop: make(chan struct{}), done: make(chan struct{})}
+	if sm.readers == nil {
+		sm.readers = make(map[uint]*tagReader)
+	}
+	sm.readers[st.ID] = r
+
+	go func() {
+		defer close(r.done)
+		if prev != nil {
+			<-prev // The previous reader may hold the same port
+		}
+		if r.stopped() {
+			return
+		}
+		sm.readTags(st.ID, r)
+	}()
+}
+
+// stopReader stops the tag reader of a station, if any. The returned
+// channel is closed once its port is released. Callers must hold sm.Mu.
+func (sm *ScaleManager) stopReader(scaleID uint) <-chan struct{} {
+	r, ok := sm.readers[scaleID]
+	if !ok {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	delete(sm.readers, scaleID)
+	return r.shutdown()
+}
+
+// readTags publishes the reads of a tag reader on sm.Tags, reconnecting
+// after errors until the reader is stopped
+func (sm *ScaleManager) readTags(scaleID uint, r *tagReader) {
+	var last string
+	var lastAt time.Time
+	for {
+		port, err := r.transport.Open()
+		if err != nil {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.stop:
+				return
+			}
+			continue
+		}
+
+		r.mu.Lock()
+		if r.stopped() {
+			r.mu.Unlock()
+			port.Close()
+			return
+		}
+		r.port = port
+		r.mu.Unlock()
+		log.Printf("Connected to tag reader of station %d on %s", scaleID, r.transport)
+
+		scanner := bufio.NewScanner(port)
+		scanner.Split(splitTagFrames)
+		for scanner.Scan() {
+			tag, err := ParseTag(r.settings.Protocol, scanner.Bytes())
+			if err != nil {
+				log.Printf("Tag reader of station %d: %v", scaleID, err)
+				continue
+			}
+			now := time.Now()
+			if tag == last && now.Sub(lastAt) < TagRepeat {
+				lastAt = now
+				continue
+			}
+			last, lastAt = tag, now
+			sm.Tags.Publish(TagRead{ScaleID: scaleID, Tag: tag, At: now})
+		}
+		port.Close()
+
+		r.mu.Lock()
+		r.port = nil
+		stopped := r.stopped()
+		r.mu.Unlock()
+		if stopped {
+			return
+		}
+		err = scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		log.Printf("Error reading tag reader of station %d: %v", scaleID, err)
+		select {
+		case <-time.After(time.Second):
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// PublishTag reports a tag read that did not come from a station reader,
+// such as one typed in for testing; repeats are not filtered
+func (sm *ScaleManager) PublishTag(scaleID uint, tag string) error {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	sm.Tags.Publish(TagRead{ScaleID: scaleID, Tag: tag, At: time.Now()})
+	return nil
+}
@@ -0,0 +1,154 @@
+package hardware
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		protocol string
+		frame    string
+		want     string // Empty when the frame must be refused
+	}{
+		{ReaderASCII, "E2 00 00 17 22 0B 01 23 18 60 4A 8F", "E2000017220B012318604A8F"},
+		{ReaderASCII, "e200001722", "E200001722"},
+		{ReaderASCII, "\x0212003AB45CC0", "12003AB45C"},
+		{ReaderASCII, "noise\x0212003AB45CC0", "12003AB45C"},
+		{ReaderASCII, "\x0212003AB45CC1", ""}, // Checksum
+		{ReaderASCII, "READY", ""},
+		{ReaderWiegand, "0000077881", "0000077881"},
+		{ReaderWiegand, "77881", "0000077881"},
+		{ReaderWiegand, "W26 2026073", "0000077881"},
+		{ReaderWiegand, "w26:2026073", "0000077881"},
+		{ReaderWiegand, "W26 2026072", ""}, // Odd parity
+		{ReaderWiegand, "W26 3026073", ""}, // Even parity
+		{ReaderWiegand, "W34 3BD5B7DDE", "3735928559"},
+		{ReaderWiegand, "W26 FFFFFFF", ""}, // More than 26 bits
+		{"rfid", "E200001722", ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseTag(tt.protocol, []byte(tt.frame))
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s %q: accepted as %q", tt.protocol, tt.frame, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s %q = %q, %v; want %q", tt.protocol, tt.frame, got, err, tt.want)
+		}
+	}
+}
+
+func TestTagReader(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	sm := newTestManager()
+	reads := sm.Tags.Subscribe(16)
+	defer reads.Close()
+	station := models.WeighingStation{
+		Model: gorm.Model{ID: 4}, SimScenario: "truck_cycle",
+		ReaderProtocol: ReaderASCII, ReaderPort: "tcp://" + ln.Addr().String(),
+	}
+	sm.Sync([]models.WeighingStation{station})
+	defer sm.Shutdown()
+
+	var reader net.Conn
+	select {
+	case reader = <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader never connected")
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case r := <-reads.C:
+			if r.ScaleID != 4 || r.Tag != want {
+				t.Fatalf("read %+v, want %s", r, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not read", want)
+		}
+	}
+
+	// A UHF reader repeats the tag while the truck stands in its field
+	reader.Write([]byte("E2000017220B\r\nE2000017220B\r\nE2000017220B\r\n\x0212003AB45CC0\x03"))
+	expect("E2000017220B")
+	expect("12003AB45C")
+	select {
+	case r := <-reads.C:
+		t.Fatalf("repeat published: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Scale settings do not touch the reader, removing the reader closes it
+	station.Division = 10
+	sm.Sync([]models.WeighingStation{station})
+	station.ReaderProtocol = ""
+	sm.Sync([]models.WeighingStation{station})
+	reader.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := reader.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("reader connection not closed: %v", err)
+	}
+	select {
+	case conn := <-conns:
+		t.Errorf("reader reconnected from %v", conn.RemoteAddr())
+	default:
+	}
+}
+
+func TestTagReaderReconnectBackoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conn.Close() // A peer hanging up at once
+		}
+	}()
+
+	sm := newTestManager()
+	sm.Sync([]models.WeighingStation{{
+		Model: gorm.Model{ID: 4}, SimScenario: "truck_cycle",
+		ReaderProtocol: ReaderASCII, ReaderPort: "tcp://" + ln.Addr().String(),
+	}})
+	defer sm.Shutdown()
+
+	time.Sleep(500 * time.Millisecond)
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("reader connected %d times in 500ms", n)
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
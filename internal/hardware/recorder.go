@@ -0,0 +1,112 @@
+package hardware
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultRecordDir is where raw stream captures go unless SCALE_RECORD_DIR says otherwise
+const DefaultRecordDir = "data/recordings"
+
+// CaptureChunk is one read from an indicator as stored in a capture file.
+// Capture files are JSON lines, so they survive being cut off mid-write
+// and can be inspected or trimmed with ordinary tools.
+type CaptureChunk struct {
+	At   time.Time `json:"at"`
+	Data []byte    `json:"data"` // base64 in the file
+}
+
+// Recorder appends raw chunks with their arrival time to a capture file
+type Recorder struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewRecorder writes captures to w; Close closes w if it is an io.Closer
+func NewRecorder(w io.Writer) *Recorder {
+	bw := bufio.NewWriter(w)
+	r := &Recorder{w: bw, enc: json.NewEncoder(bw)}
+	if c, ok := w.(io.Closer); ok {
+		r.c = c
+	}
+	return r
+}
+
+// OpenRecorder creates a new capture file for one connection of a station
+func OpenRecorder(dir string, scaleID uint, now time.Time) (*Recorder, string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("scale-%d-%s.jsonl", scaleID, now.Format("20060102-150405")))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, "", err
+	}
+	return NewRecorder(f), path, nil
+}
+
+// Record stores one chunk. Data is copied, the caller may reuse it.
+func (r *Recorder) Record(data []byte, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(CaptureChunk{At: at, Data: data}); err != nil {
+		return err
+	}
+	// Flush per chunk: a capture is most useful right after a crash
+	return r.w.Flush()
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.w.Flush()
+	if r.c != nil {
+		if cerr := r.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ReadCapture loads every chunk of a capture file, for tests and tooling
+func ReadCapture(r io.Reader) ([]CaptureChunk, error) {
+	var chunks []CaptureChunk
+	dec := json.NewDecoder(r)
+	for {
+		var chunk CaptureChunk
+		if err := dec.Decode(&chunk); err == io.EOF {
+			return chunks, nil
+		} else if err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+// recordingPort tees everything read from the indicator into a Recorder
+type recordingPort struct {
+	io.ReadWriteCloser
+	rec *Recorder
+}
+
+func (p *recordingPort) Read(b []byte) (int, error) {
+	n, err := p.ReadWriteCloser.Read(b)
+	if n > 0 {
+		p.rec.Record(b[:n], time.Now())
+	}
+	return n, err
+}
+
+func (p *recordingPort) Close() error {
+	err := p.ReadWriteCloser.Close()
+	p.rec.Close()
+	return err
+}
@@ -0,0 +1,116 @@
+package hardware
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	dir := t.TempDir()
+	sm := newTestManager()
+	sm.RecordDir = dir
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+	sm.AddOrUpdateScale(models.WeighingStation{
+		Model:     gorm.Model{ID: 4},
+		ScalePort: "tcp://" + ln.Addr().String(),
+		Protocol:  ProtocolAND,
+		RecordRaw: true,
+	})
+
+	indicator, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Split a frame across two writes, as serial converters do
+	indicator.Write([]byte("ST,GS,+00123"))
+	time.Sleep(20 * time.Millisecond)
+	indicator.Write([]byte("40kg\r\nUS,GS,+0020000kg\r\n"))
+	waitForWeight(t, events, 20000)
+	sm.RemoveScale(4)
+	indicator.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "scale-4-*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("expected one capture file, got %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := ReadCapture(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw []byte
+	for _, c := range chunks {
+		raw = append(raw, c.Data...)
+	}
+	if !bytes.Equal(raw, []byte("ST,GS,+0012340kg\r\nUS,GS,+0020000kg\r\n")) {
+		t.Fatalf("recorded %q", raw)
+	}
+
+	// Play the capture back into a fresh station, as fast as possible
+	sm.AddOrUpdateScale(models.WeighingStation{
+		Model:     gorm.Model{ID: 5},
+		ScalePort: "replay://" + files[0] + "?speed=0",
+		Protocol:  ProtocolAND,
+	})
+	defer sm.RemoveScale(5)
+	waitForWeight(t, events, 12340)
+	waitForWeight(t, events, 20000)
+}
+
+func TestReplayTiming(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	start := time.Now()
+	rec.Record([]byte("a"), start)
+	rec.Record([]byte("b"), start.Add(400*time.Millisecond))
+	rec.Close()
+
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	os.WriteFile(path, buf.Bytes(), 0o644)
+
+	tr, err := newReplayTransport("replay://" + path + "?speed=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := tr.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	b := make([]byte, 8)
+	stream.Read(b)
+	began := time.Now()
+	stream.Read(b)
+	// 400ms recorded gap at 4x speed
+	if took := time.Since(began); took < 80*time.Millisecond || took > 300*time.Millisecond {
+		t.Errorf("second chunk after %v, want ~100ms", took)
+	}
+
+	if _, err := tr.Open(); err != errReplayDone {
+		t.Errorf("expected replay to finish without loop, got %v", err)
+	}
+	for _, bad := range []string{"replay://", "replay://x.jsonl?speed=-1", "replay://x.jsonl?speed=0&loop=1"} {
+		if _, err := newReplayTransport(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
@@ -2,245 +2,594 @@ package hardware
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"os"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
-	"go.bug.st/serial"
 	"gorm.io/gorm"
 	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/hub"
+	"stoneweigh/internal/pkg/units"
 )
 
 // ScaleManager handles connections to multiple scales
 type ScaleManager struct {
 	Scales      map[uint]*ScaleConnection
-	DataChannel chan ScaleData // Channel to broadcast updates
+	Events      *hub.Hub[ScaleData] // Every reading and connection change, for SSE and other consumers
 	Mu          sync.Mutex
-	stopChans   map[uint]chan bool // To stop monitoring goroutines
+	RecordDir   string // Capture files of stations with RecordRaw
+	ScenarioDir string // Simulator scenarios, besides the built-in ones
+	demo        bool   // Simulate stations without a scenario of their own
+
+	// transport opens station ports, NewTransport when nil (tests use fakes)
+	transport func(models.WeighingStation) (Transport, error)
+
+	HealthEvents *hub.Hub[HealthEvent] // Connects, disconnects and silent/stuck alerts
+	SilentAfter  time.Duration         // See CheckHealth, DefaultSilentAfter when 0
+	StuckAfter   time.Duration         // See CheckHealth, DefaultStuckAfter when 0
+
+	Tags    *hub.Hub[TagRead]   // Cards and tags read by the station readers
+	readers map[uint]*tagReader // Running tag readers by station
+
+	sensors     map[uint]*positionSensors // Running position sensors by station
+	SensorStale time.Duration             // See SensorASCII, DefaultSensorStale when 0
 }
 
 type ScaleConnection struct {
-	Config models.WeighingStation // UPDATED: Use WeighingStation
-	Port   serial.Port
-	LastWeight float64
-	Connected  bool
+	Config      models.WeighingStation // UPDATED: Use WeighingStation
+	Transport   Transport              // Serial port or TCP socket, from Config.ScalePort
+	Port        io.ReadWriteCloser     // Open stream while Connected
+	Driver      Driver                 // Protocol decoder picked from Config.Protocol
+	LastWeight  float64
+	LastReading Reading
+	Connected   bool
+
+	stability *StabilityDetector
+	axles     *AxleDetector   // Only for stations in axle weighing mode
+	split     bufio.SplitFunc // Station terminator, or the driver's own framing
+	writeMu   sync.Mutex      // Serializes commands and guards Port against reconnects
+	external  bool            // Fed by demo mode or the remote API instead of a port
+	health    Health
+	position  Position // Last state of the station's position sensors
+
+	// Lifecycle of the goroutine reading the station (see startScale)
+	stop chan struct{} // Closed under ScaleManager.Mu to stop it
+	done chan struct{} // Closed once it has exited and released the port
 }
 
 type ScaleData struct {
-	ScaleID   uint    `json:"scale_id"`
-	Weight    float64 `json:"weight"`
-	Connected bool    `json:"connected"`
-	Timestamp int64   `json:"timestamp"`
+	ScaleID       uint      `json:"scale_id"`
+	Weight        float64   `json:"weight"`
+	Unit          string    `json:"unit,omitempty"` // Weights are always kg, see DisplayUnit
+	DisplayUnit   string    `json:"display_unit"`   // Station unit for showing the weights
+	Division      float64   `json:"division,omitempty"`
+	Negative      bool      `json:"negative"`
+	Stable        bool      `json:"stable"`
+	StableSince   int64     `json:"stable_since,omitempty"` // Unix time the reading settled
+	SettledWeight float64   `json:"settled_weight"`
+	Mode          WeighMode `json:"mode,omitempty"`
+	HasMode       bool      `json:"-"` // See Reading.HasMode
+	Overload      bool      `json:"overload"`
+	Connected     bool      `json:"connected"`
+	Timestamp     int64     `json:"timestamp"`
+
+	// Axle weighing mode: axles counted so far for the vehicle crossing,
+	// and the completed pass waiting to be captured
+	Axles     int     `json:"axles,omitempty"`
+	AxleTotal float64 `json:"axle_total,omitempty"`
+	PassReady bool    `json:"pass_ready,omitempty"`
+	PassTotal float64 `json:"pass_total,omitempty"`
+
+	// Position sensors: no capture unless Position.Clear()
+	Position Position `json:"position"`
 }
 
-var Manager *ScaleManager
+// Tared reports whether the indicator shows a net weight after a tare.
+// Such a weight depends on what was on the platform when it was tared, so
+// it is never captured or booked.
+func (d ScaleData) Tared() bool {
+	return d.HasMode && d.Mode == ModeNet
+}
 
-func InitScaleManager() {
-	Manager = &ScaleManager{
-		Scales:      make(map[uint]*ScaleConnection),
-		DataChannel: make(chan ScaleData, 100),
-		stopChans:   make(map[uint]chan bool),
+// apply stores a decoded reading and runs it through the stability engine.
+// Callers must hold ScaleManager.Mu.
+func (c *ScaleConnection) apply(r Reading, now time.Time) ScaleData {
+	r = c.normalize(r)
+	c.frame(r.Weight, now)
+	c.LastWeight = r.Weight
+	c.LastReading = r
+	st := c.stability.Update(r, now)
+	if c.axles != nil {
+		c.axles.Update(r.Weight, st, now)
 	}
+	return c.data(now)
 }
 
-// ReloadConfig loads configuration from the DB and restarts connections
-func (sm *ScaleManager) ReloadConfig(db *gorm.DB) {
-	log.Println("Reloading Scale Configurations...")
-	var stations []models.WeighingStation
-	if err := db.Where("enabled = ?", true).Find(&stations).Error; err != nil {
-		log.Printf("Error loading stations: %v", err)
-		return
+// normalize converts a reading to kg, rounded to the station division.
+// Frames without a unit, or with one we do not know, are in the station
+// unit. Callers must hold ScaleManager.Mu.
+func (c *ScaleConnection) normalize(r Reading) Reading {
+	display, _ := units.Parse(c.Config.Unit)
+	unit, err := units.Parse(r.Unit)
+	if r.Unit == "" || err != nil {
+		unit = display
 	}
+	r.Weight = units.Normalize(r.Weight, unit, display, c.Config.Division)
+	r.Unit = units.Kilogram
+	return r
+}
 
-	// 1. Identify removed or updated stations
-	sm.Mu.Lock()
-	currentIDs := make(map[uint]bool)
-	for _, s := range stations {
-		currentIDs[s.ID] = true
+// reset forgets the reading history after a (re)connect or disconnect.
+// Callers must hold ScaleManager.Mu.
+func (c *ScaleConnection) reset() {
+	c.stability.Reset()
+	if c.axles != nil {
+		c.axles.Reset()
 	}
+}
 
-	// Stop monitors for stations that no longer exist or are disabled
-	for id, _ := range sm.Scales {
-		if !currentIDs[id] {
-			if stop, ok := sm.stopChans[id]; ok {
-				close(stop)
-				delete(sm.stopChans, id)
-			}
-			if conn, ok := sm.Scales[id]; ok && conn.Port != nil {
-				conn.Port.Close()
-			}
-			delete(sm.Scales, id)
-			log.Printf("Stopped Scale %d", id)
+// data builds the broadcast payload from the connection state.
+// Callers must hold ScaleManager.Mu.
+func (c *ScaleConnection) data(now time.Time) ScaleData {
+	st := c.stability.State()
+	d := ScaleData{
+		ScaleID:       c.Config.ID,
+		Weight:        c.LastWeight,
+		Unit:          c.LastReading.Unit,
+		DisplayUnit:   c.displayUnit(),
+		Division:      c.Config.Division,
+		Negative:      c.LastReading.Negative,
+		Stable:        st.Stable,
+		SettledWeight: st.Settled,
+		Mode:          c.LastReading.Mode,
+		HasMode:       c.LastReading.HasMode,
+		Overload:      c.LastReading.Overload,
+		Connected:     c.Connected || c.external,
+		Timestamp:     now.Unix(),
+		Position:      c.position,
+	}
+	if st.Stable {
+		d.StableSince = st.Since.Unix()
+	}
+	if c.axles != nil {
+		if p := c.axles.Current(); p != nil {
+			d.Axles, d.AxleTotal = len(p.Axles), p.Total
+		}
+		if p := c.axles.Last(); p != nil {
+			d.PassReady, d.PassTotal = true, p.Total
 		}
 	}
-	sm.Mu.Unlock()
+	return d
+}
 
-	// 2. Add or Update stations
-	// For simplicity, we'll stop and restart even if unchanged,
-	// or we could check diffs. Let's restart to ensure clean state.
-	for _, station := range stations {
-		sm.AddOrUpdateScale(station)
+// displayUnit is the station unit, kg when unset or unknown
+func (c *ScaleConnection) displayUnit() string {
+	if u, err := units.Parse(c.Config.Unit); err == nil {
+		return u
 	}
+	return units.Kilogram
 }
 
-// AddOrUpdateScale registers and attempts to connect to a scale
-func (sm *ScaleManager) AddOrUpdateScale(config models.WeighingStation) {
+// close releases the open stream and the transport, unblocking the
+// goroutine reading them. Callers must hold ScaleManager.Mu.
+func (c *ScaleConnection) close() {
+	c.writeMu.Lock()
+	if c.Port != nil {
+		c.Port.Close()
+	}
+	c.writeMu.Unlock()
+	if c.Transport != nil {
+		c.Transport.Close()
+	}
+}
+
+// stopped reports whether the connection has been shut down. Checked under
+// ScaleManager.Mu, a stopped connection never publishes again.
+func (c *ScaleConnection) stopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Status returns a snapshot of one scale, false if it is not managed
+func (sm *ScaleManager) Status(scaleID uint) (ScaleData, bool) {
 	sm.Mu.Lock()
 	defer sm.Mu.Unlock()
+	conn, ok := sm.Scales[scaleID]
+	if !ok {
+		return ScaleData{}, false
+	}
+	return conn.data(time.Now()), true
+}
 
-	// If exists, stop first
-	if _, exists := sm.Scales[config.ID]; exists {
-		if stop, ok := sm.stopChans[config.ID]; ok {
-			close(stop)
-			delete(sm.stopChans, config.ID)
-		}
-		// Close port if open
-		if sm.Scales[config.ID].Port != nil {
-			sm.Scales[config.ID].Port.Close()
-		}
+// Snapshot returns the current state of every managed scale
+func (sm *ScaleManager) Snapshot() []ScaleData {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	now := time.Now()
+	out := make([]ScaleData, 0, len(sm.Scales))
+	for _, conn := range sm.Scales {
+		out = append(out, conn.data(now))
+	}
+	return out
+}
+
+var Manager *ScaleManager
+
+// NewScaleManager creates a manager without any scales
+func NewScaleManager() *ScaleManager {
+	return &ScaleManager{
+		Scales:      make(map[uint]*ScaleConnection),
+		Events:      hub.New[ScaleData](),
+		RecordDir:   DefaultRecordDir,
+		ScenarioDir: DefaultScenarioDir,
+
+		HealthEvents: hub.New[HealthEvent](),
+		Tags:         hub.New[TagRead](),
+		readers:      make(map[uint]*tagReader),
+		sensors:      make(map[uint]*positionSensors),
+	}
+}
+
+func InitScaleManager() {
+	Manager = NewScaleManager()
+	if dir := os.Getenv("SCALE_RECORD_DIR"); dir != "" {
+		Manager.RecordDir = dir
+	}
+	if dir := os.Getenv("SIM_SCENARIO_DIR"); dir != "" {
+		Manager.ScenarioDir = dir
+	}
+	if v, err := strconv.Atoi(os.Getenv("SCALE_SILENT_SECONDS")); err == nil && v > 0 {
+		Manager.SilentAfter = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(os.Getenv("SCALE_STUCK_MINUTES")); err == nil && v > 0 {
+		Manager.StuckAfter = time.Duration(v) * time.Minute
+	}
+	if v, err := strconv.Atoi(os.Getenv("POSITION_SENSOR_STALE_SECONDS")); err == nil && v > 0 {
+		Manager.SensorStale = time.Duration(v) * time.Second
+	}
+}
+
+// newScaleConnection prepares the driver and stability engine for a station
+func newScaleConnection(config models.WeighingStation) *ScaleConnection {
+	driver, err := NewDriver(config)
+	if err != nil {
+		log.Printf("Scale %d: %v, falling back to generic parser", config.ID, err)
+		driver, _ = NewGenericDriver("")
+	}
+
+	transport, err := NewTransport(config)
+	if err != nil {
+		log.Printf("Scale %d: %v", config.ID, err)
+		transport = errTransport{err}
+	}
+
+	split, err := splitFuncFor(config.Terminator)
+	if err != nil {
+		log.Printf("Scale %d: %v, using protocol framing", config.ID, err)
+	}
+	if split == nil {
+		split = driver.SplitFunc()
 	}
 
 	conn := &ScaleConnection{
-		Config: config,
+		Config:    config,
+		Transport: transport,
+		Driver:    driver,
+		split:     split,
+		stability: NewStabilityDetector(
+			time.Duration(config.StableWindowMs)*time.Millisecond,
+			config.StableTolerance,
+		),
+	}
+	if config.AxleMode {
+		conn.axles = NewAxleDetector(
+			time.Duration(config.AxleTimeoutMs)*time.Millisecond,
+			config.AxleMinWeight,
+			conn.stability.Tolerance,
+		)
 	}
-	sm.Scales[config.ID] = conn
+	return conn
+}
 
-	stop := make(chan bool)
-	sm.stopChans[config.ID] = stop
+// SetSimulatedReading feeds a reading for a scale that has no real port
+// (demo mode, tests). The scale is registered if it is not managed yet.
+func (sm *ScaleManager) SetSimulatedReading(scaleID uint, r Reading, now time.Time) ScaleData {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	return sm.ingest(scaleID, r, now)
+}
 
-	go sm.monitorScale(config.ID, stop)
+// IngestRemote takes a reading pushed by a remote sender (scale PC posting
+// to the external API) through the same stability engine and broadcast.
+func (sm *ScaleManager) IngestRemote(scaleID uint, r Reading) ScaleData {
+	return sm.SetSimulatedReading(scaleID, r, time.Now())
+}
+
+// ingest is SetSimulatedReading for callers already holding sm.Mu
+func (sm *ScaleManager) ingest(scaleID uint, r Reading, now time.Time) ScaleData {
+	conn, ok := sm.Scales[scaleID]
+	if !ok {
+		conn = newScaleConnection(models.WeighingStation{Model: gorm.Model{ID: scaleID}})
+		sm.Scales[scaleID] = conn
+	}
+	if !conn.external {
+		sm.linkChanged(conn, true, "remote", now)
+	}
+	conn.external = true
+	data := conn.apply(r, now)
+	sm.broadcast(data, now)
+	return data
+}
+
+// TakeAxlePass hands out the last completed axle pass of a station and
+// forgets it, so the same vehicle cannot be captured twice. It returns
+// nil when no pass is waiting.
+func (sm *ScaleManager) TakeAxlePass(scaleID uint) *AxlePass {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	conn, ok := sm.Scales[scaleID]
+	if !ok || conn.axles == nil {
+		return nil
+	}
+	pass := conn.axles.Take()
+	if pass != nil {
+		now := time.Now()
+		sm.broadcast(conn.data(now), now)
+	}
+	return pass
 }
 
-// monitorScale constantly tries to read from the scale
-func (sm *ScaleManager) monitorScale(scaleID uint, stopChan chan bool) {
+// monitorScale keeps a station's port open and decodes it until the
+// connection is stopped, reconnecting after failures
+func (sm *ScaleManager) monitorScale(conn *ScaleConnection) {
+	// Config is replaced in place by reconfigure, read it under the lock
+	sm.Mu.Lock()
+	scaleID, recordRaw := conn.Config.ID, conn.Config.RecordRaw
+	sm.Mu.Unlock()
+
 	for {
-		select {
-		case <-stopChan:
-			return
-		default:
-			// Continue
+		// Attempt connection (serial line settings or TCP socket)
+		port, err := conn.Transport.Open()
+		if err != nil {
+			// Failed to connect, wait and retry
+			now := time.Now()
+			sm.Mu.Lock()
+			if !conn.stopped() {
+				sm.broadcast(conn.data(now), now)
+			}
+			sm.Mu.Unlock()
+
+			// Sleep with check for stop
+			select {
+			case <-time.After(5 * time.Second):
+			case <-conn.stop:
+				return
+			}
+			continue
+		}
+
+		if _, polled := conn.Driver.(Poller); recordRaw && !polled {
+			port = sm.record(scaleID, port)
 		}
 
 		sm.Mu.Lock()
-		conn, exists := sm.Scales[scaleID]
+		if conn.stopped() {
+			// Stopped while opening: close hands the port back right away
+			sm.Mu.Unlock()
+			port.Close()
+			return
+		}
+		conn.writeMu.Lock()
+		conn.Port = port
+		conn.writeMu.Unlock()
+		conn.Connected = true
+		conn.external = false
+		conn.reset()
+		sm.linkChanged(conn, true, fmt.Sprint(conn.Transport), time.Now())
+		log.Printf("Connected to Scale %d (%s) on %s", scaleID, conn.Config.Name, conn.Transport)
 		sm.Mu.Unlock()
 
-		if !exists {
-			return
+		if poller, ok := conn.Driver.(Poller); ok {
+			err = sm.pollLoop(conn, poller, port)
+		} else {
+			err = sm.readLoop(conn, port)
 		}
+		port.Close()
 
-		if !conn.Connected {
-			// Attempt connection
-			// Default serial settings if not specified
-			baud := conn.Config.BaudRate
-			if baud == 0 { baud = 9600 }
-
-			mode := &serial.Mode{
-				BaudRate: baud,
-				DataBits: 8,
-				Parity:   serial.NoParity,
-				StopBits: serial.OneStopBit,
-			}
+		sm.Mu.Lock()
+		conn.writeMu.Lock()
+		conn.Port = nil
+		conn.writeMu.Unlock()
+		if conn.stopped() {
+			// Removed or replaced: its successor reports the link from now on
+			sm.Mu.Unlock()
+			return
+		}
 
-			port, err := serial.Open(conn.Config.ScalePort, mode)
-			if err != nil {
-				// Failed to connect, wait and retry
-				sm.DataChannel <- ScaleData{ScaleID: scaleID, Connected: false, Timestamp: time.Now().Unix()}
-
-				// Sleep with check for stop
-				select {
-				case <-time.After(5 * time.Second):
-				case <-stopChan:
-					return
-				}
-				continue
-			}
+		// A read error or EOF (TCP peer hung up) both mean reconnect
+		log.Printf("Error reading scale %d: %v", scaleID, err)
+		conn.Connected = false
+		conn.reset()
+		now := time.Now()
+		sm.linkChanged(conn, false, err.Error(), now)
+		sm.broadcast(conn.data(now), now)
+		sm.Mu.Unlock()
+	}
+}
 
-			conn.Port = port
-			conn.Connected = true
-			log.Printf("Connected to Scale %d (%s) on %s", scaleID, conn.Config.Name, conn.Config.ScalePort)
-		}
+// record tees a freshly opened stream into a new capture file. Recording
+// is best effort: if the file cannot be created the scale runs unrecorded.
+func (sm *ScaleManager) record(scaleID uint, port io.ReadWriteCloser) io.ReadWriteCloser {
+	dir := sm.RecordDir
+	if dir == "" {
+		dir = DefaultRecordDir
+	}
+	rec, path, err := OpenRecorder(dir, scaleID, time.Now())
+	if err != nil {
+		log.Printf("Scale %d: cannot record raw stream: %v", scaleID, err)
+		return port
+	}
+	log.Printf("Scale %d: recording raw stream to %s", scaleID, path)
+	return &recordingPort{ReadWriteCloser: port, rec: rec}
+}
 
-		// Read loop
-		scanner := bufio.NewScanner(conn.Port)
-		for scanner.Scan() {
-			select {
-			case <-stopChan:
-				conn.Port.Close()
-				return
-			default:
-			}
+// errStopped ends a read or poll loop when the monitor is stopped
+var errStopped = errors.New("scale monitor stopped")
 
-			text := scanner.Text()
-			weight := parseWeight(text)
+// readLoop decodes frames from a streaming indicator until the stream fails
+func (sm *ScaleManager) readLoop(conn *ScaleConnection, port io.Reader) error {
+	scanner := bufio.NewScanner(port)
+	scanner.Split(conn.split)
+	for scanner.Scan() {
+		select {
+		case <-conn.stop:
+			return errStopped
+		default:
+		}
 
-			conn.LastWeight = weight
+		reading, err := conn.Driver.Parse(scanner.Bytes())
+		if err != nil {
+			// Noise, partial or checksum-failed frame: keep the last good reading
+			sm.frameError(conn, err)
+			continue
+		}
+		sm.publish(conn, reading)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
 
-			// Broadcast
-			sm.DataChannel <- ScaleData{
-				ScaleID:   scaleID,
-				Weight:    weight,
-				Connected: true,
-				Timestamp: time.Now().Unix(),
-			}
+// pollLoop queries a request/response device (Modbus) on its interval.
+// Bad answers are skipped like noisy frames; I/O errors and timeouts
+// end the loop so the monitor reconnects.
+func (sm *ScaleManager) pollLoop(conn *ScaleConnection, poller Poller, port io.ReadWriter) error {
+	ticker := time.NewTicker(poller.Interval())
+	defer ticker.Stop()
+	for {
+		reading, err := poller.Poll(port)
+		if err == nil {
+			sm.publish(conn, reading)
+		} else if errors.Is(err, ErrInvalidFrame) {
+			sm.frameError(conn, err)
+		} else {
+			return err
 		}
 
-		if err := scanner.Err(); err != nil {
-			log.Printf("Error reading scale %d: %v", scaleID, err)
-			conn.Port.Close()
-			conn.Connected = false
+		select {
+		case <-conn.stop:
+			return errStopped
+		case <-ticker.C:
 		}
 	}
 }
 
-// Demo Mode: Simulates scale activity
+// broadcast publishes a scale's state and, for a deck of a summing
+// station, the recomputed sum. Callers must hold sm.Mu.
+func (sm *ScaleManager) broadcast(data ScaleData, now time.Time) {
+	sm.Events.Publish(data)
+	if conn, ok := sm.Scales[data.ScaleID]; ok && conn.Config.SumStationID != 0 {
+		sm.updateSum(conn.Config.SumStationID, now)
+	}
+}
+
+// publish applies a decoded reading and broadcasts it, unless the
+// connection has been stopped in the meantime
+func (sm *ScaleManager) publish(conn *ScaleConnection, reading Reading) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	if conn.stopped() {
+		return
+	}
+	now := time.Now()
+	sm.broadcast(conn.apply(reading, now), now)
+}
+
+// StartDemoMode simulates every station without a scenario of its own
+// with DefaultScenario instead of opening its port. Stations added or
+// reloaded later are simulated too.
 func (sm *ScaleManager) StartDemoMode() {
-	go func() {
-		log.Println("Starting Demo Scale Simulation...")
-		ticker := time.NewTicker(500 * time.Millisecond)
-		defer ticker.Stop()
+	log.Println("Starting Demo Scale Simulation...")
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	sm.demo = true
+
+	// Restart every station: the mode changes how they are fed. The configs
+	// are collected first as restarting replaces the connections.
+	configs := make([]models.WeighingStation, 0, len(sm.Scales))
+	for _, conn := range sm.Scales {
+		configs = append(configs, conn.Config)
+	}
+	for _, config := range configs {
+		sm.restartScale(config)
+	}
+}
+
+// scenarioFor returns the scenario a station runs on, empty for real hardware.
+// Callers must hold sm.Mu.
+func (sm *ScaleManager) scenarioFor(config models.WeighingStation) string {
+	if config.SimScenario != "" {
+		return config.SimScenario
+	}
+	if sm.demo {
+		return DefaultScenario
+	}
+	return ""
+}
+
+// simulate plays a scenario into a scale until stopped, in place of monitorScale
+func (sm *ScaleManager) simulate(conn *ScaleConnection, name string) {
+	sm.Mu.Lock()
+	scaleID := conn.Config.ID
+	sm.Mu.Unlock()
+
+	sc, err := LoadScenario(name, sm.ScenarioDir)
+	if err != nil {
+		log.Printf("Scale %d: %v, scale stays offline", scaleID, err)
+		return
+	}
+	log.Printf("Scale %d: simulating scenario %q", scaleID, name)
+
+	player := sc.Player()
+	ticker := time.NewTicker(sc.Interval)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-conn.stop:
+			return
+		case now := <-ticker.C:
+			sample := player.At(now.Sub(start))
 
-		for range ticker.C {
 			sm.Mu.Lock()
-			// Simulate random weights for Scale 1 (or any existing scale)
-			// Iterate through all scales and simulate if not connected
-			for id, conn := range sm.Scales {
-				if !conn.Connected {
-					// Toggle between empty (0) and loaded (~25000)
-					now := time.Now().Unix()
-					if (now/20)%2 == 0 {
-						conn.LastWeight = 0
-					} else {
-						// Jitter
-						conn.LastWeight = 24500 + float64(now%100)
-					}
-
-					// Broadcast fake data
-					sm.DataChannel <- ScaleData{
-						ScaleID:   id,
-						Weight:    conn.LastWeight,
-						Connected: true,
-						Timestamp: time.Now().Unix(),
-					}
-				}
+			if conn.stopped() {
+				sm.Mu.Unlock()
+				return
+			}
+			var data ScaleData
+			if sample.Connected != conn.external {
+				sm.linkChanged(conn, sample.Connected, "scenario "+name, now)
+			}
+			if sample.Connected {
+				conn.external = true
+				data = conn.apply(sample.Reading, now)
+			} else {
+				conn.external = false
+				conn.reset()
+				data = conn.data(now)
 			}
+			sm.broadcast(data, now)
 			sm.Mu.Unlock()
 		}
-	}()
-}
-
-func parseWeight(raw string) float64 {
-	clean := strings.Map(func(r rune) rune {
-		if (r >= '0' && r <= '9') || r == '.' || r == '-' {
-			return r
-		}
-		return -1
-	}, raw)
-
-	if val, err := strconv.ParseFloat(clean, 64); err == nil {
-		return val
 	}
-	return 0.0
 }
@@ -1,7 +1,12 @@
 package hardware
 
 import (
+	"math"
 	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
 )
 
 func TestParseWeight(t *testing.T) {
@@ -24,3 +29,54 @@ func TestParseWeight(t *testing.T) {
 		}
 	}
 }
+
+func TestEventsNeverBlockPublishers(t *testing.T) {
+	sm := newTestManager()
+	slow := sm.Events.Subscribe(10)
+	defer slow.Close()
+
+	// Far more readings than any buffer, with nobody reading
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			sm.IngestRemote(7, Reading{Weight: float64(i)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publishing blocked")
+	}
+
+	// The slow subscriber keeps the newest readings
+	var last ScaleData
+	for len(slow.C) > 0 {
+		last = <-slow.C
+	}
+	if last.ScaleID != 7 || last.Weight != 999 || !last.Connected {
+		t.Errorf("got %+v", last)
+	}
+}
+
+func TestReadingsNormalizedToKg(t *testing.T) {
+	sm := newTestManager()
+	sm.Scales[3] = newScaleConnection(models.WeighingStation{Model: gorm.Model{ID: 3}, Unit: "t", Division: 0.01})
+
+	// Frames without a unit are in the station unit, the rest are converted;
+	// both are rounded to the 10 kg division
+	for _, c := range []struct {
+		r    Reading
+		want float64
+	}{
+		{Reading{Weight: 12.344}, 12340},
+		{Reading{Weight: 12346, Unit: "kg"}, 12350},
+		{Reading{Weight: 1000, Unit: "LB"}, 450},
+		{Reading{Weight: 5, Unit: "pcs"}, 5000},
+	} {
+		d := sm.IngestRemote(3, c.r)
+		if math.Abs(d.Weight-c.want) > 1e-9 || d.Unit != "kg" || d.DisplayUnit != "t" || d.Division != 0.01 {
+			t.Errorf("%+v: got %+v, want %v kg", c.r, d, c.want)
+		}
+	}
+}
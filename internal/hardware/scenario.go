@@ -0,0 +1,214 @@
+package hardware
+
+import (
+	"embed"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario actions
+const (
+	ActionHold       = "hold"       // Stay at Weight (or the current weight) for Duration
+	ActionRamp       = "ramp"       // Move linearly to Weight over Duration
+	ActionSettle     = "settle"     // Damped swing onto Weight, like a truck coming to rest
+	ActionOverload   = "overload"   // Indicator reports over range
+	ActionDisconnect = "disconnect" // Indicator goes silent
+)
+
+// DefaultScenario is what demo mode runs on stations without their own scenario
+const DefaultScenario = "truck_cycle"
+
+// DefaultScenarioDir holds site specific scenarios unless SIM_SCENARIO_DIR says otherwise
+const DefaultScenarioDir = "data/scenarios"
+
+//go:embed scenarios/*.yaml
+var builtinScenarios embed.FS
+
+// Scenario is a scripted indicator behaviour, loaded from YAML or JSON:
+//
+//	name: truck_cycle
+//	interval: 200ms
+//	loop: true
+//	seed: 1
+//	steps:
+//	  - {action: hold, weight: 0, duration: 5s, noise: 2}
+//	  - {action: ramp, weight: 24500, duration: 4s, noise: 150}
+//	  - {action: settle, weight: 24500, duration: 3s, noise: 40}
+type Scenario struct {
+	Name     string         `yaml:"name" json:"name"`
+	Unit     string         `yaml:"unit" json:"unit"`         // Default "kg"
+	Interval time.Duration  `yaml:"interval" json:"interval"` // Frame period, default 200ms
+	Loop     bool           `yaml:"loop" json:"loop"`         // Start over after the last step
+	Seed     uint64         `yaml:"seed" json:"seed"`         // Noise seed, same seed = same readings
+	Steps    []ScenarioStep `yaml:"steps" json:"steps"`
+}
+
+type ScenarioStep struct {
+	Action   string        `yaml:"action" json:"action"`
+	Weight   *float64      `yaml:"weight" json:"weight"` // Target; hold keeps the current weight when omitted
+	Duration time.Duration `yaml:"duration" json:"duration"`
+	Noise    float64       `yaml:"noise" json:"noise"` // Jitter amplitude; for settle also the overshoot
+}
+
+// ParseScenario decodes a YAML (or JSON, which is valid YAML) scenario
+func ParseScenario(data []byte) (*Scenario, error) {
+	var sc Scenario
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %v", err)
+	}
+	if sc.Unit == "" {
+		sc.Unit = "kg"
+	}
+	if sc.Interval <= 0 {
+		sc.Interval = 200 * time.Millisecond
+	}
+	if len(sc.Steps) == 0 {
+		return nil, fmt.Errorf("scenario %q has no steps", sc.Name)
+	}
+	for i, step := range sc.Steps {
+		switch step.Action {
+		case ActionHold, ActionOverload, ActionDisconnect:
+		case ActionRamp, ActionSettle:
+			if step.Weight == nil {
+				return nil, fmt.Errorf("scenario %q step %d: %s needs a weight", sc.Name, i+1, step.Action)
+			}
+		default:
+			return nil, fmt.Errorf("scenario %q step %d: unknown action %q", sc.Name, i+1, step.Action)
+		}
+		if step.Duration <= 0 {
+			return nil, fmt.Errorf("scenario %q step %d: duration must be positive", sc.Name, i+1)
+		}
+	}
+	return &sc, nil
+}
+
+// LoadScenario resolves a station's SimScenario: a file path (anything
+// with an extension), a file in dir, or one of the built-in scenarios.
+func LoadScenario(name, dir string) (*Scenario, error) {
+	name = strings.TrimSpace(name)
+	if ext := filepath.Ext(name); ext != "" {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return ParseScenario(data)
+	}
+	if dir != "" {
+		for _, ext := range []string{".yaml", ".yml", ".json"} {
+			if data, err := os.ReadFile(filepath.Join(dir, name+ext)); err == nil {
+				return ParseScenario(data)
+			}
+		}
+	}
+	data, err := builtinScenarios.ReadFile("scenarios/" + name + ".yaml")
+	if err != nil {
+		return nil, fmt.Errorf("unknown scenario %q", name)
+	}
+	return ParseScenario(data)
+}
+
+// BuiltinScenarios lists the scenario names shipped with the binary
+func BuiltinScenarios() []string {
+	entries, _ := builtinScenarios.ReadDir("scenarios")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sample is the simulated indicator state at one instant
+type Sample struct {
+	Reading   Reading
+	Connected bool
+}
+
+// ScenarioPlayer walks a scenario on a clock supplied by the caller, so
+// tests can step it deterministically while the demo runner uses real time.
+type ScenarioPlayer struct {
+	sc    *Scenario
+	rng   *rand.Rand
+	total time.Duration
+	// starts[i] is the noiseless weight at the beginning of step i
+	starts []float64
+}
+
+func (sc *Scenario) Player() *ScenarioPlayer {
+	p := &ScenarioPlayer{
+		sc:     sc,
+		rng:    rand.New(rand.NewPCG(sc.Seed, sc.Seed^0x5eed)),
+		starts: make([]float64, len(sc.Steps)),
+	}
+	weight := 0.0
+	for i, step := range sc.Steps {
+		p.starts[i] = weight
+		p.total += step.Duration
+		if step.Weight != nil && step.Action != ActionOverload && step.Action != ActionDisconnect {
+			weight = *step.Weight
+		}
+	}
+	return p
+}
+
+// At returns the indicator state elapsed time after the scenario started.
+// A finished non-looping scenario stays in its final state.
+func (p *ScenarioPlayer) At(elapsed time.Duration) Sample {
+	if p.sc.Loop {
+		elapsed %= p.total
+	} else if elapsed >= p.total {
+		elapsed = p.total - 1
+	}
+
+	i := 0
+	for elapsed >= p.sc.Steps[i].Duration {
+		elapsed -= p.sc.Steps[i].Duration
+		i++
+	}
+	step := p.sc.Steps[i]
+	start := p.starts[i]
+	frac := float64(elapsed) / float64(step.Duration)
+
+	r := Reading{Unit: p.sc.Unit, Mode: ModeGross}
+	noise := step.Noise
+	switch step.Action {
+	case ActionDisconnect:
+		return Sample{}
+	case ActionOverload:
+		r.Weight = start
+		r.Overload = true
+		return Sample{Reading: r, Connected: true}
+	case ActionHold:
+		r.Weight = start
+		if step.Weight != nil {
+			r.Weight = *step.Weight
+		}
+	case ActionRamp:
+		r.Weight = start + (*step.Weight-start)*frac
+	case ActionSettle:
+		// Swing around the target with Noise as the first overshoot,
+		// dying out over the step
+		target := *step.Weight
+		decay := math.Exp(-5 * frac)
+		swing := start - target + step.Noise
+		r.Weight = target + swing*decay*math.Cos(3*2*math.Pi*frac)
+		noise *= decay / 4
+	}
+	if noise > 0 {
+		r.Weight += (p.rng.Float64()*2 - 1) * noise
+	}
+	r.Weight = math.Round(r.Weight)
+	r.Negative = r.Weight < 0
+	return Sample{Reading: r, Connected: true}
+}
+
+// Duration is the length of one pass through the scenario
+func (p *ScenarioPlayer) Duration() time.Duration { return p.total }
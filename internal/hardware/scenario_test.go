@@ -0,0 +1,124 @@
+package hardware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+)
+
+func TestBuiltinScenarios(t *testing.T) {
+	names := BuiltinScenarios()
+	if len(names) == 0 {
+		t.Fatal("no built-in scenarios")
+	}
+	for _, name := range names {
+		if _, err := LoadScenario(name, ""); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestScenarioDeterministic(t *testing.T) {
+	sc, err := LoadScenario(DefaultScenario, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := sc.Player(), sc.Player()
+	for at := time.Duration(0); at < a.Duration(); at += sc.Interval {
+		if sa, sb := a.At(at), b.At(at); sa != sb {
+			t.Fatalf("at %v: %+v != %+v", at, sa, sb)
+		}
+	}
+}
+
+func TestTruckCycleStability(t *testing.T) {
+	sc, err := LoadScenario("truck_cycle", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := sc.Player()
+	det := NewStabilityDetector(0, 0)
+	t0 := time.Unix(1700000000, 0)
+
+	var stableLoaded, stableWhileMoving bool
+	for at := time.Duration(0); at < player.Duration(); at += sc.Interval {
+		sample := player.At(at)
+		st := det.Update(sample.Reading, t0.Add(at))
+		// 8s empty, 4s ramp, 3s settle, 12s hold
+		switch {
+		case at >= 8*time.Second && at < 12*time.Second && st.Stable:
+			stableWhileMoving = true
+		case at >= 20*time.Second && at < 27*time.Second:
+			if st.Stable && st.Settled > 24400 && st.Settled < 24600 {
+				stableLoaded = true
+			}
+		}
+	}
+	if stableWhileMoving {
+		t.Error("stable while the truck was driving on")
+	}
+	if !stableLoaded {
+		t.Error("never stable at the loaded weight")
+	}
+}
+
+func TestParseScenarioJSON(t *testing.T) {
+	sc, err := ParseScenario([]byte(`{"name":"j","interval":"50ms","steps":[
+		{"action":"ramp","weight":1000,"duration":"1s"},
+		{"action":"disconnect","duration":"1s"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := sc.Player()
+	if s := p.At(500 * time.Millisecond); !s.Connected || s.Reading.Weight != 500 {
+		t.Errorf("half way up the ramp: %+v", s)
+	}
+	if s := p.At(1500 * time.Millisecond); s.Connected {
+		t.Errorf("expected disconnect, got %+v", s)
+	}
+
+	for _, bad := range []string{
+		`steps: []`,
+		`steps: [{action: ramp, duration: 1s}]`,
+		`steps: [{action: fly, weight: 1, duration: 1s}]`,
+		`steps: [{action: hold, weight: 1}]`,
+	} {
+		if _, err := ParseScenario([]byte(bad)); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestManagerRunsScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "short.yaml")
+	os.WriteFile(path, []byte(`
+name: short
+interval: 10ms
+steps:
+  - {action: hold, weight: 7000, duration: 200ms}
+  - {action: disconnect, duration: 1h}
+`), 0o644)
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+	sm.AddOrUpdateScale(models.WeighingStation{Model: gorm.Model{ID: 6}, SimScenario: path})
+	defer sm.RemoveScale(6)
+
+	waitForWeight(t, events, 7000)
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case data := <-events.C:
+			if !data.Connected {
+				return
+			}
+		case <-timeout:
+			t.Fatal("scenario never disconnected")
+		}
+	}
+}
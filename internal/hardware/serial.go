@@ -0,0 +1,161 @@
+package hardware
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/units"
+)
+
+// Flow control modes accepted in WeighingStation.FlowControl
+const (
+	FlowNone   = "none"
+	FlowRTSCTS = "rtscts"
+)
+
+// ctsTimeout bounds how long a write waits for the indicator to raise CTS
+const ctsTimeout = 2 * time.Second
+
+// SerialMode builds the line settings of a station. Zero values fall back
+// to 9600 8N1, which is what every station used before these were configurable.
+func SerialMode(st models.WeighingStation) (*serial.Mode, error) {
+	mode := &serial.Mode{
+		BaudRate: st.BaudRate,
+		DataBits: st.DataBits,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	}
+	if mode.BaudRate == 0 {
+		mode.BaudRate = 9600
+	}
+	if mode.DataBits == 0 {
+		mode.DataBits = 8
+	}
+	if mode.DataBits < 5 || mode.DataBits > 8 {
+		return nil, fmt.Errorf("invalid data bits %d", st.DataBits)
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(st.Parity)) {
+	case "", "N", "NONE":
+	case "E", "EVEN":
+		mode.Parity = serial.EvenParity
+	case "O", "ODD":
+		mode.Parity = serial.OddParity
+	case "M", "MARK":
+		mode.Parity = serial.MarkParity
+	case "S", "SPACE":
+		mode.Parity = serial.SpaceParity
+	default:
+		return nil, fmt.Errorf("invalid parity %q", st.Parity)
+	}
+
+	switch strings.TrimSpace(st.StopBits) {
+	case "", "1":
+	case "1.5":
+		mode.StopBits = serial.OnePointFiveStopBits
+	case "2":
+		mode.StopBits = serial.TwoStopBits
+	default:
+		return nil, fmt.Errorf("invalid stop bits %q", st.StopBits)
+	}
+
+	switch flowControl(st) {
+	case FlowNone:
+	case FlowRTSCTS:
+		// Hold RTS so the indicator is allowed to transmit
+		mode.InitialStatusBits = &serial.ModemOutputBits{RTS: true, DTR: true}
+	default:
+		return nil, fmt.Errorf("invalid flow control %q", st.FlowControl)
+	}
+
+	return mode, nil
+}
+
+func flowControl(st models.WeighingStation) string {
+	fc := strings.ToLower(strings.TrimSpace(st.FlowControl))
+	if fc == "" {
+		return FlowNone
+	}
+	return fc
+}
+
+// ValidateStation checks the hardware settings of a station before saving,
+// so a typo shows up on the settings page instead of as a silent reconnect loop.
+func ValidateStation(st models.WeighingStation) error {
+	if _, err := units.Parse(st.Unit); err != nil {
+		return err
+	}
+	if st.Division < 0 {
+		return fmt.Errorf("invalid division %v", st.Division)
+	}
+	if err := validateReader(st); err != nil {
+		return err
+	}
+	if err := validateSensors(st); err != nil {
+		return err
+	}
+	if st.Summing {
+		// No port of its own, only the decks are opened
+		if st.SumStationID != 0 {
+			return fmt.Errorf("a summing station cannot be a deck of another station")
+		}
+		return nil
+	}
+	if _, err := NewTransport(st); err != nil {
+		return err
+	}
+	if _, err := NewDriver(st); err != nil {
+		return err
+	}
+	if _, err := SerialMode(st); err != nil {
+		return err
+	}
+	_, err := splitFuncFor(st.Terminator)
+	return err
+}
+
+// openSerial opens the station port with its full line settings
+func openSerial(st models.WeighingStation) (serial.Port, error) {
+	mode, err := SerialMode(st)
+	if err != nil {
+		return nil, err
+	}
+	port, err := serial.Open(st.ScalePort, mode)
+	if err != nil {
+		return nil, err
+	}
+	if flowControl(st) == FlowRTSCTS {
+		return &rtsctsPort{Port: port}, nil
+	}
+	return port, nil
+}
+
+var errCTSTimeout = errors.New("timeout waiting for CTS")
+
+// rtsctsPort adds RTS/CTS handshaking on top of go.bug.st/serial, which
+// does not support hardware flow control itself: RTS stays asserted so the
+// indicator may send, and writes wait until the indicator asserts CTS.
+type rtsctsPort struct {
+	serial.Port
+}
+
+func (p *rtsctsPort) Write(b []byte) (int, error) {
+	deadline := time.Now().Add(ctsTimeout)
+	for {
+		bits, err := p.GetModemStatusBits()
+		if err != nil {
+			return 0, err
+		}
+		if bits.CTS {
+			return p.Port.Write(b)
+		}
+		if time.Now().After(deadline) {
+			return 0, errCTSTimeout
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
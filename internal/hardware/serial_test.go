@@ -0,0 +1,73 @@
+package hardware
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"go.bug.st/serial"
+	"stoneweigh/internal/models"
+)
+
+func TestSerialMode(t *testing.T) {
+	// Zero values keep the historical 9600 8N1
+	mode, err := SerialMode(models.WeighingStation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode.BaudRate != 9600 || mode.DataBits != 8 || mode.Parity != serial.NoParity || mode.StopBits != serial.OneStopBit {
+		t.Errorf("got %+v", mode)
+	}
+
+	mode, err = SerialMode(models.WeighingStation{BaudRate: 4800, DataBits: 7, Parity: "E", StopBits: "1", FlowControl: "rtscts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode.BaudRate != 4800 || mode.DataBits != 7 || mode.Parity != serial.EvenParity {
+		t.Errorf("got %+v", mode)
+	}
+	if mode.InitialStatusBits == nil || !mode.InitialStatusBits.RTS {
+		t.Error("RTS/CTS must assert RTS")
+	}
+
+	for _, bad := range []models.WeighingStation{
+		{DataBits: 9},
+		{Parity: "X"},
+		{StopBits: "3"},
+		{FlowControl: "xonxoff"},
+	} {
+		if _, err := SerialMode(bad); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestTerminatorOverridesDriverFraming(t *testing.T) {
+	tests := []struct {
+		terminator string
+		stream     string
+		want       []string
+	}{
+		{"CR", "ST,GS,+100kg\r\rST,GS,+200kg\r", []string{"ST,GS,+100kg", "ST,GS,+200kg"}},
+		{"LF", "ST,GS,+100kg\nST,GS,+200kg\n", []string{"ST,GS,+100kg", "ST,GS,+200kg"}},
+		{"CRLF", "ST,GS,+100kg\r\nST,GS,+200kg\r\n", []string{"ST,GS,+100kg", "ST,GS,+200kg"}},
+		{"STX_ETX", "\x02ST,GS,+100kg\x03\x02ST,GS,+200kg\x03", []string{"ST,GS,+100kg", "ST,GS,+200kg"}},
+	}
+	for _, tt := range tests {
+		conn := newScaleConnection(models.WeighingStation{Protocol: ProtocolAND, Terminator: tt.terminator})
+		scanner := bufio.NewScanner(strings.NewReader(tt.stream))
+		scanner.Split(conn.split)
+
+		var got []string
+		for scanner.Scan() {
+			got = append(got, scanner.Text())
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: got %q, want %q", tt.terminator, got, tt.want)
+		}
+	}
+
+	if err := ValidateStation(models.WeighingStation{Terminator: "ETB"}); err == nil {
+		t.Error("expected error for unknown terminator")
+	}
+}
@@ -0,0 +1,100 @@
+package hardware
+
+import (
+	"time"
+)
+
+// Defaults used when a station leaves the stability settings empty
+const (
+	DefaultStableWindow    = 1500 * time.Millisecond
+	DefaultStableTolerance = 20.0
+)
+
+// StabilityState is the published result of the stability engine
+type StabilityState struct {
+	Stable  bool      `json:"stable"`
+	Since   time.Time `json:"stable_since"`
+	Settled float64   `json:"settled_weight"` // Weight the load settled at, valid while Stable
+}
+
+type weightSample struct {
+	at     time.Time
+	weight float64
+}
+
+// StabilityDetector decides whether a scale reading has settled.
+// It trusts the indicator's motion flag when the protocol has one,
+// otherwise the weight must stay within Tolerance for a full Window.
+type StabilityDetector struct {
+	Window    time.Duration
+	Tolerance float64
+
+	samples []weightSample
+	state   StabilityState
+}
+
+func NewStabilityDetector(window time.Duration, tolerance float64) *StabilityDetector {
+	if window <= 0 {
+		window = DefaultStableWindow
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultStableTolerance
+	}
+	return &StabilityDetector{Window: window, Tolerance: tolerance}
+}
+
+// Update feeds one reading and returns the new state
+func (d *StabilityDetector) Update(r Reading, now time.Time) StabilityState {
+	d.samples = append(d.samples, weightSample{at: now, weight: r.Weight})
+	// Keep exactly one sample at or before the window start so we know
+	// whether the history covers the whole window.
+	cutoff := now.Add(-d.Window)
+	for len(d.samples) > 1 && !d.samples[1].at.After(cutoff) {
+		d.samples = d.samples[1:]
+	}
+
+	var stable bool
+	switch {
+	case r.Overload:
+		stable = false
+	case r.HasMotion:
+		stable = r.Stable
+	default:
+		stable = d.windowStable(cutoff)
+	}
+
+	if !stable {
+		d.state = StabilityState{}
+		return d.state
+	}
+	if !d.state.Stable {
+		d.state = StabilityState{Stable: true, Since: now, Settled: r.Weight}
+	} else if r.HasMotion {
+		// The indicator is authoritative, follow it while it reports no motion
+		d.state.Settled = r.Weight
+	}
+	return d.state
+}
+
+func (d *StabilityDetector) windowStable(cutoff time.Time) bool {
+	if len(d.samples) < 2 || d.samples[0].at.After(cutoff) {
+		return false
+	}
+	lo, hi := d.samples[0].weight, d.samples[0].weight
+	for _, s := range d.samples[1:] {
+		lo = min(lo, s.weight)
+		hi = max(hi, s.weight)
+	}
+	return hi-lo <= d.Tolerance
+}
+
+// Reset forgets the history, e.g. after a disconnect
+func (d *StabilityDetector) Reset() {
+	d.samples = nil
+	d.state = StabilityState{}
+}
+
+// State returns the last computed state
+func (d *StabilityDetector) State() StabilityState {
+	return d.state
+}
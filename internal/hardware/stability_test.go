@@ -0,0 +1,51 @@
+package hardware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStabilityWindow(t *testing.T) {
+	d := NewStabilityDetector(time.Second, 10)
+	start := time.Unix(1000, 0)
+
+	// Ramp up: never stable
+	for i, w := range []float64{0, 5000, 12000, 16000} {
+		if st := d.Update(Reading{Weight: w}, start.Add(time.Duration(i)*200*time.Millisecond)); st.Stable {
+			t.Fatalf("stable during ramp at %v", w)
+		}
+	}
+
+	// Hold within tolerance; stable only once the window is covered
+	base := start.Add(time.Second)
+	var st StabilityState
+	for i := 0; i <= 5; i++ {
+		st = d.Update(Reading{Weight: 18000 + float64(i%2)*5}, base.Add(time.Duration(i)*200*time.Millisecond))
+		if i < 5 && st.Stable {
+			t.Fatalf("stable too early at step %d", i)
+		}
+	}
+	if !st.Stable || st.Settled != 18005 || !st.Since.Equal(base.Add(time.Second)) {
+		t.Fatalf("expected stable at 18005, got %+v", st)
+	}
+
+	// A jump beyond tolerance drops stability immediately
+	if st := d.Update(Reading{Weight: 18100}, base.Add(1200*time.Millisecond)); st.Stable {
+		t.Fatal("expected unstable after jump")
+	}
+}
+
+func TestStabilityMotionFlag(t *testing.T) {
+	d := NewStabilityDetector(time.Hour, 1)
+	now := time.Unix(1000, 0)
+
+	if st := d.Update(Reading{Weight: 500, HasMotion: true, Stable: true}, now); !st.Stable || st.Settled != 500 {
+		t.Fatalf("indicator flag should be trusted, got %+v", st)
+	}
+	if st := d.Update(Reading{Weight: 520, HasMotion: true, Stable: false}, now); st.Stable {
+		t.Fatal("expected unstable when indicator reports motion")
+	}
+	if st := d.Update(Reading{Weight: 520, HasMotion: true, Stable: true, Overload: true}, now); st.Stable {
+		t.Fatal("overload must never be stable")
+	}
+}
@@ -0,0 +1,63 @@
+package hardware
+
+import (
+	"sort"
+	"time"
+)
+
+// decks returns the member connections of a summing station, by ID.
+// Callers must hold sm.Mu.
+func (sm *ScaleManager) decks(sumID uint) []*ScaleConnection {
+	var decks []*ScaleConnection
+	for id, conn := range sm.Scales {
+		if id != sumID && conn.Config.SumStationID == sumID {
+			decks = append(decks, conn)
+		}
+	}
+	sort.Slice(decks, func(i, j int) bool { return decks[i].Config.ID < decks[j].Config.ID })
+	return decks
+}
+
+// updateSum recomputes a summing station from its decks and broadcasts
+// it. The sum is only connected while every deck is, and only stable
+// while every deck is stable. Callers must hold sm.Mu.
+func (sm *ScaleManager) updateSum(sumID uint, now time.Time) {
+	conn, ok := sm.Scales[sumID]
+	if !ok || !conn.Config.Summing {
+		return
+	}
+	decks := sm.decks(sumID)
+
+	connected := len(decks) > 0
+	sum := Reading{Mode: ModeNet, Stable: true, HasMotion: true, HasMode: true}
+	for i, deck := range decks {
+		d := deck.data(now)
+		if !d.Connected {
+			connected = false
+			break
+		}
+		if i == 0 {
+			sum.Unit = d.Unit
+		}
+		sum.Weight += d.Weight
+		sum.Stable = sum.Stable && d.Stable
+		sum.Overload = sum.Overload || d.Overload
+		sum.HasMode = sum.HasMode && deck.LastReading.HasMode
+		// Net only if every deck is tared, anything else sums gross weights
+		if d.Mode != ModeNet {
+			sum.Mode = ModeGross
+		}
+	}
+
+	if !connected {
+		if conn.Connected {
+			conn.Connected = false
+			conn.reset()
+		}
+		sm.Events.Publish(conn.data(now))
+		return
+	}
+	conn.Connected = true
+	sum.Negative = sum.Weight < 0
+	sm.Events.Publish(conn.apply(sum, now))
+}
@@ -0,0 +1,70 @@
+package hardware
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+)
+
+func TestSummingStation(t *testing.T) {
+	sm := newTestManager()
+	status := func() ScaleData {
+		d, _ := sm.Status(10)
+		return d
+	}
+	sm.AddOrUpdateScale(models.WeighingStation{Model: gorm.Model{ID: 10}, Summing: true})
+	if status().Connected {
+		t.Fatal("summing station without decks must be disconnected")
+	}
+
+	sm.Mu.Lock()
+	for _, id := range []uint{11, 12} {
+		sm.Scales[id] = newScaleConnection(models.WeighingStation{Model: gorm.Model{ID: id}, SumStationID: 10})
+	}
+	sm.Mu.Unlock()
+
+	t0 := time.Unix(1700000000, 0)
+	feed := func(at time.Duration, front, rear float64) {
+		now := t0.Add(at)
+		sm.SetSimulatedReading(11, Reading{Weight: front, Unit: "kg", Stable: true}, now)
+		sm.SetSimulatedReading(12, Reading{Weight: rear, Unit: "kg", Stable: true}, now)
+	}
+
+	// Front deck settles, rear deck still moving: the sum must not be stable
+	for at := time.Duration(0); at <= 3*time.Second; at += 250 * time.Millisecond {
+		feed(at, 14000, 9000+float64(at/time.Millisecond))
+	}
+	if d := status(); !d.Connected || d.Stable {
+		t.Fatalf("sum while rear deck moves: %+v", d)
+	}
+
+	for at := 3 * time.Second; at <= 6*time.Second; at += 250 * time.Millisecond {
+		feed(at, 14000, 10500)
+	}
+	d := status()
+	if !d.Connected || !d.Stable || d.Weight != 24500 || d.Mode != ModeGross {
+		t.Fatalf("settled sum: %+v", d)
+	}
+
+	// One deck dropping its link takes the whole station offline
+	sm.Mu.Lock()
+	rear := sm.Scales[12]
+	rear.external, rear.Connected = false, false
+	rear.reset()
+	sm.broadcast(rear.data(t0.Add(7*time.Second)), t0.Add(7*time.Second))
+	sm.Mu.Unlock()
+	if d := status(); d.Connected || d.Stable {
+		t.Fatalf("sum with a deck missing: %+v", d)
+	}
+}
+
+func TestValidateSummingStation(t *testing.T) {
+	if err := ValidateStation(models.WeighingStation{Summing: true}); err != nil {
+		t.Errorf("summing station needs no port: %v", err)
+	}
+	if err := ValidateStation(models.WeighingStation{Summing: true, SumStationID: 3}); err == nil {
+		t.Error("a summing station cannot be a deck itself")
+	}
+}
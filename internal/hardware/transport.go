@@ -0,0 +1,145 @@
+package hardware
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"stoneweigh/internal/models"
+)
+
+// Transport schemes accepted in WeighingStation.ScalePort (see also
+// SchemeReplay). Anything without a scheme is a serial device name
+// (COM3, /dev/ttyUSB0).
+const (
+	SchemeTCP       = "tcp://"        // Connect to an Ethernet indicator or ser2net
+	SchemeTCPListen = "tcp-listen://" // Wait for the indicator/converter to connect to us
+)
+
+// dialTimeout bounds a single TCP connection attempt
+const dialTimeout = 5 * time.Second
+
+// Transport opens the byte stream a station's indicator talks on.
+// Open is called again after every disconnect; Close releases anything
+// that outlives a single connection (such as a listening socket).
+type Transport interface {
+	Open() (io.ReadWriteCloser, error)
+	Close() error
+	String() string
+}
+
+// NewTransport picks the transport from the station's ScalePort
+func NewTransport(st models.WeighingStation) (Transport, error) {
+	addr := strings.TrimSpace(st.ScalePort)
+	switch {
+	case strings.HasPrefix(addr, SchemeTCP):
+		hostPort := strings.TrimPrefix(addr, SchemeTCP)
+		if _, _, err := net.SplitHostPort(hostPort); err != nil {
+			return nil, fmt.Errorf("invalid TCP address %q: %v", addr, err)
+		}
+		return &tcpClientTransport{addr: hostPort}, nil
+	case strings.HasPrefix(addr, SchemeTCPListen):
+		hostPort := strings.TrimPrefix(addr, SchemeTCPListen)
+		if _, _, err := net.SplitHostPort(hostPort); err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %v", addr, err)
+		}
+		return &tcpServerTransport{addr: hostPort}, nil
+	case strings.HasPrefix(addr, SchemeReplay):
+		return newReplayTransport(addr)
+	case strings.Contains(addr, "://"):
+		return nil, fmt.Errorf("unsupported scale port %q", addr)
+	default:
+		return &serialTransport{station: st}, nil
+	}
+}
+
+// serialTransport opens a local serial port with the station's line settings
+type serialTransport struct {
+	station models.WeighingStation
+}
+
+func (t *serialTransport) Open() (io.ReadWriteCloser, error) { return openSerial(t.station) }
+func (t *serialTransport) Close() error                      { return nil }
+func (t *serialTransport) String() string                    { return t.station.ScalePort }
+
+// tcpClientTransport dials an indicator with an Ethernet port, or a
+// serial-to-Ethernet converter in raw TCP mode (ser2net, Moxa NPort...)
+type tcpClientTransport struct {
+	addr string
+}
+
+func (t *tcpClientTransport) Open() (io.ReadWriteCloser, error) {
+	dialer := net.Dialer{Timeout: dialTimeout, KeepAlive: 15 * time.Second}
+	return dialer.Dial("tcp", t.addr)
+}
+
+func (t *tcpClientTransport) Close() error   { return nil }
+func (t *tcpClientTransport) String() string { return SchemeTCP + t.addr }
+
+// tcpServerTransport listens for a converter configured as TCP client.
+// One indicator connection is served at a time; the listener stays open
+// between connections and is only released by Close.
+type tcpServerTransport struct {
+	addr string
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+func (t *tcpServerTransport) listen() (net.Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, net.ErrClosed
+	}
+	if t.listener == nil {
+		l, err := net.Listen("tcp", t.addr)
+		if err != nil {
+			return nil, err
+		}
+		t.listener = l
+	}
+	return t.listener, nil
+}
+
+func (t *tcpServerTransport) Open() (io.ReadWriteCloser, error) {
+	l, err := t.listen()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetKeepAlive(true)
+		tcp.SetKeepAlivePeriod(15 * time.Second)
+	}
+	return conn, nil
+}
+
+func (t *tcpServerTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.listener != nil {
+		return t.listener.Close()
+	}
+	return nil
+}
+
+func (t *tcpServerTransport) String() string { return SchemeTCPListen + t.addr }
+
+// errTransport stands in for a station whose port setting cannot be used,
+// so the monitor keeps reporting it as disconnected instead of crashing.
+type errTransport struct {
+	err error
+}
+
+func (t errTransport) Open() (io.ReadWriteCloser, error) { return nil, t.err }
+func (t errTransport) Close() error                      { return nil }
+func (t errTransport) String() string                    { return "invalid port" }
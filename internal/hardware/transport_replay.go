@@ -0,0 +1,119 @@
+package hardware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemeReplay plays a capture file back as if it came from the indicator:
+//
+//	replay://data/recordings/scale-1-20240101-080000.jsonl?speed=10&loop=1
+//
+// speed scales the recorded gaps (1 = real time, 0 = as fast as possible),
+// loop restarts the file at the end instead of going offline. A looping
+// replay needs a speed: at 0 it would spin through the file without pause.
+const SchemeReplay = "replay://"
+
+var errReplayDone = errors.New("replay finished")
+
+type replayTransport struct {
+	path  string
+	speed float64
+	loop  bool
+
+	played bool
+}
+
+func newReplayTransport(addr string) (*replayTransport, error) {
+	path, rawQuery, _ := strings.Cut(strings.TrimPrefix(addr, SchemeReplay), "?")
+	if path == "" {
+		return nil, fmt.Errorf("replay needs a capture file: %q", addr)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replay options %q: %v", addr, err)
+	}
+
+	t := &replayTransport{path: path, speed: 1}
+	if v := query.Get("speed"); v != "" {
+		t.speed, err = strconv.ParseFloat(v, 64)
+		if err != nil || t.speed < 0 {
+			return nil, fmt.Errorf("invalid replay speed %q", v)
+		}
+	}
+	t.loop = query.Get("loop") == "1" || query.Get("loop") == "true"
+	if t.loop && t.speed == 0 {
+		return nil, fmt.Errorf("replay cannot loop at speed 0: %q", addr)
+	}
+	return t, nil
+}
+
+func (t *replayTransport) Open() (io.ReadWriteCloser, error) {
+	// Without loop a capture plays once, then the scale stays offline
+	if t.played && !t.loop {
+		return nil, errReplayDone
+	}
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	t.played = true
+	return &replayStream{f: f, dec: json.NewDecoder(f), speed: t.speed, done: make(chan struct{})}, nil
+}
+
+func (t *replayTransport) Close() error   { return nil }
+func (t *replayTransport) String() string { return SchemeReplay + t.path }
+
+// replayStream hands out recorded chunks, sleeping the recorded gap
+// (divided by speed) before each one. Writes (commands) are discarded.
+type replayStream struct {
+	f       *os.File
+	dec     *json.Decoder
+	speed   float64
+	pending []byte
+	prev    time.Time
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (s *replayStream) Read(b []byte) (int, error) {
+	for len(s.pending) == 0 {
+		var chunk CaptureChunk
+		if err := s.dec.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, fmt.Errorf("replay %s: %v", s.f.Name(), err)
+		}
+		if !s.prev.IsZero() && s.speed > 0 {
+			gap := time.Duration(float64(chunk.At.Sub(s.prev)) / s.speed)
+			if gap > 0 {
+				select {
+				case <-time.After(gap):
+				case <-s.done:
+					return 0, os.ErrClosed
+				}
+			}
+		}
+		s.prev = chunk.At
+		s.pending = chunk.Data
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *replayStream) Write(b []byte) (int, error) { return len(b), nil }
+
+func (s *replayStream) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.f.Close()
+}
@@ -0,0 +1,127 @@
+package hardware
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/hub"
+)
+
+func newTestManager() *ScaleManager {
+	return &ScaleManager{
+		Scales: make(map[uint]*ScaleConnection),
+		Events: hub.New[ScaleData](),
+
+		HealthEvents: hub.New[HealthEvent](),
+		Tags:         hub.New[TagRead](),
+	}
+}
+
+// waitForWeight follows broadcasts until the scale reports the wanted weight
+func waitForWeight(t *testing.T, events *hub.Subscription[ScaleData], want float64) ScaleData {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case data := <-events.C:
+			if data.Connected && data.Weight == want {
+				return data
+			}
+		case <-timeout:
+			t.Fatalf("no reading of %v received", want)
+		}
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	tests := []struct {
+		port string
+		want string
+	}{
+		{"/dev/ttyUSB0", "/dev/ttyUSB0"},
+		{"COM3", "COM3"},
+		{"tcp://192.168.1.50:4001", "tcp://192.168.1.50:4001"},
+		{"tcp-listen://:4001", "tcp-listen://:4001"},
+	}
+	for _, tt := range tests {
+		tr, err := NewTransport(models.WeighingStation{ScalePort: tt.port})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.port, err)
+		}
+		if tr.String() != tt.want {
+			t.Errorf("%s: got %s", tt.port, tr)
+		}
+	}
+
+	for _, bad := range []string{"tcp://no-port", "udp://1.2.3.4:5"} {
+		if _, err := NewTransport(models.WeighingStation{ScalePort: bad}); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestTCPClientReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+	sm.AddOrUpdateScale(models.WeighingStation{
+		Model:     gorm.Model{ID: 1},
+		ScalePort: "tcp://" + ln.Addr().String(),
+		Protocol:  ProtocolAND,
+	})
+	defer sm.RemoveScale(1)
+
+	// First session: the indicator sends one frame and hangs up
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("ST,GS,+0012340kg\r\n"))
+	waitForWeight(t, events, 12340)
+	conn.Close()
+
+	// The manager dials again and picks up the new stream
+	conn, err = ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ST,GS,+0005000kg\r\n"))
+	waitForWeight(t, events, 5000)
+}
+
+func TestTCPServerMode(t *testing.T) {
+	tr := &tcpServerTransport{addr: "127.0.0.1:0"}
+	ln, err := tr.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := newTestManager()
+	events := sm.Events.Subscribe(0)
+	defer events.Close()
+	conn := newScaleConnection(models.WeighingStation{Model: gorm.Model{ID: 2}, Protocol: ProtocolAND})
+	conn.Transport = tr
+	sm.Mu.Lock()
+	sm.Scales[2] = conn
+	sm.startScale(conn, nil)
+	sm.Mu.Unlock()
+	defer sm.RemoveScale(2)
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Write([]byte("ST,GS,+0024500kg\r\n"))
+	waitForWeight(t, events, 24500)
+}
@@ -0,0 +1,599 @@
+package kiosk
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/hub"
+)
+
+// Defaults used for the zero values of Config
+const (
+	DefaultOccupiedWeight  = 200 // kg
+	DefaultSettleTime      = 3 * time.Second
+	DefaultIdentifyTimeout = 30 * time.Second
+	DefaultStableTimeout   = 2 * time.Minute
+)
+
+// Config holds the thresholds of the state machine
+type Config struct {
+	OccupiedWeight  float64       // kg from which a vehicle is on the platform
+	SettleTime      time.Duration // How long a reading must stay stable before it is weighed
+	IdentifyTimeout time.Duration // From arrival until the vehicle must be identified
+	StableTimeout   time.Duration // From identification until the weight must have settled
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.OccupiedWeight <= 0 {
+		cfg.OccupiedWeight = DefaultOccupiedWeight
+	}
+	if cfg.SettleTime <= 0 {
+		cfg.SettleTime = DefaultSettleTime
+	}
+	if cfg.IdentifyTimeout <= 0 {
+		cfg.IdentifyTimeout = DefaultIdentifyTimeout
+	}
+	if cfg.StableTimeout <= 0 {
+		cfg.StableTimeout = DefaultStableTimeout
+	}
+	return cfg
+}
+
+// Controller runs the state machine of every kiosk station. Scale readings
+// come in through Observe, tag reads through ObserveTag and the passing of
+// time through Tick (or all three through Run); supervisors answer
+// escalations through Resolve.
+type Controller struct {
+	Config
+
+	backend  Backend
+	mu       sync.Mutex
+	stations map[uint]*station
+}
+
+// station is the state of one kiosk station
+type station struct {
+	id    uint
+	name  string
+	mode  string
+	state string
+	since time.Time // When state was entered
+
+	reading  hardware.ScaleData // Latest connected reading
+	stableAt time.Time          // When the reading settled, zero while moving
+	captured hardware.ScaleData // Reading being booked, kept for an approval
+
+	plate   string // Identified vehicle
+	source  string
+	driver  string   // Named by a supervisor along with the plate
+	unknown []string // Tags and plates not in the vehicle master
+	lastTag hardware.TagRead
+
+	ticket     *Ticket
+	escalation *Escalation
+	recognize  int // Counts ANPR runs, so a stale result is dropped
+}
+
+// StationStatus is a kiosk station on the supervisor console
+type StationStatus struct {
+	StationID  uint              `json:"station_id"`
+	Name       string            `json:"name"`
+	Mode       string            `json:"mode"`
+	State      string            `json:"state"`
+	Since      time.Time         `json:"since"`
+	Weight     float64           `json:"weight"`
+	Stable     bool              `json:"stable"`
+	Position   hardware.Position `json:"position"`
+	Plate      string            `json:"plate,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Ticket     *Ticket           `json:"ticket,omitempty"`
+	Escalation *Escalation       `json:"escalation,omitempty"`
+}
+
+// NewController creates a controller without kiosk stations
+func NewController(backend Backend) *Controller {
+	return &Controller{backend: backend, stations: make(map[uint]*station)}
+}
+
+// Load applies the enabled kiosk stations of the database
+func (c *Controller) Load(db *gorm.DB) error {
+	var stations []models.WeighingStation
+	if err := db.Where("enabled = ? AND kiosk_mode <> ?", true, "").Find(&stations).Error; err != nil {
+		return err
+	}
+	c.Configure(stations, time.Now())
+	return nil
+}
+
+// Configure sets the kiosk stations. Stations that stay in kiosk mode keep
+// their state; a vehicle on a station leaving kiosk mode is left to the
+// operators.
+func (c *Controller) Configure(stations []models.WeighingStation, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.stations
+	c.stations = make(map[uint]*station, len(stations))
+	for _, cfg := range stations {
+		if cfg.KioskMode == "" {
+			continue
+		}
+		st, ok := old[cfg.ID]
+		if !ok {
+			st = &station{id: cfg.ID, state: StateIdle, since: now}
+		}
+		st.name, st.mode = cfg.Name, cfg.KioskMode
+		c.stations[cfg.ID] = st
+	}
+}
+
+// Run feeds the readings and tag reads of a scale manager to the
+// controller and checks the timeouts every second, until stop is closed.
+// Run it in its own goroutine.
+func (c *Controller) Run(events *hub.Hub[hardware.ScaleData], tags *hub.Hub[hardware.TagRead], stop <-chan struct{}) {
+	readings := events.Subscribe(256)
+	defer readings.Close()
+	reads := tags.Subscribe(16)
+	defer reads.Close()
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case d := <-readings.C:
+			c.Observe(d, time.Now())
+		case r := <-reads.C:
+			c.ObserveTag(r, time.Now())
+		case now := <-tick.C:
+			c.Tick(now)
+		}
+	}
+}
+
+// Observe advances a station on a scale reading: a vehicle arriving starts
+// its identification, one standing still long enough is weighed and one
+// leaving ends its turn. Disconnected readings are ignored, the timeouts
+// escalate a scale that stays away.
+func (c *Controller) Observe(d hardware.ScaleData, now time.Time) {
+	if !d.Connected {
+		return
+	}
+	c.mu.Lock()
+	st := c.stations[d.ScaleID]
+	if st == nil {
+		c.mu.Unlock()
+		return
+	}
+	// Settled counts from when the reading is stable with every beam clear
+	if !d.Stable || !d.Position.Clear() {
+		st.stableAt = time.Time{}
+	} else if !st.reading.Stable || !st.reading.Position.Clear() || st.stableAt.IsZero() {
+		st.stableAt = now
+	}
+	st.reading = d
+
+	var next func()
+	switch {
+	case st.state == StateIdle && d.Weight >= c.occupied():
+		next = c.arrive(st, now)
+	case st.state != StateIdle && st.state != StateSaving && d.Weight < c.occupied()/2:
+		next = c.leave(st, now)
+	default:
+		next = c.weighIfReady(st, now)
+	}
+	c.mu.Unlock()
+	if next != nil {
+		next()
+	}
+}
+
+// ObserveTag identifies the vehicle on a station by a tag read. A read
+// just before the vehicle is on the platform counts for its arrival.
+func (c *Controller) ObserveTag(r hardware.TagRead, now time.Time) {
+	c.mu.Lock()
+	st := c.stations[r.ScaleID]
+	if st == nil {
+		c.mu.Unlock()
+		return
+	}
+	st.lastTag = r
+	identifying := st.state == StateIdentifying || st.state == StateWeighing
+	c.mu.Unlock()
+	if identifying {
+		c.identify(r.ScaleID, Identity{Source: SourceTag, Value: r.Tag}, now)
+	}
+}
+
+// Tick escalates the stations whose vehicle was not identified or did not
+// settle in time, and weighs those that settled without a new reading
+func (c *Controller) Tick(now time.Time) {
+	type timeout struct {
+		id      uint
+		reason  string
+		message string
+	}
+	var timeouts []timeout
+	var next []func()
+	c.mu.Lock()
+	cfg := c.Config.withDefaults()
+	for _, st := range c.stations {
+		switch {
+		case st.state == StateIdentifying && now.Sub(st.since) >= cfg.IdentifyTimeout:
+			if len(st.unknown) > 0 {
+				timeouts = append(timeouts, timeout{st.id, ReasonUnregistered,
+					"Tidak terdaftar: " + strings.Join(st.unknown, ", ")})
+			} else {
+				timeouts = append(timeouts, timeout{st.id, ReasonUnidentified, "Kendaraan tidak dikenali dari tag maupun plat nomor"})
+			}
+		case st.state == StateWeighing && now.Sub(st.since) >= cfg.StableTimeout && st.reading.Tared():
+			timeouts = append(timeouts, timeout{st.id, ReasonUnstable, "Indikator dalam mode net, kembalikan ke mode gross agar kendaraan dapat ditimbang"})
+		case st.state == StateWeighing && now.Sub(st.since) >= cfg.StableTimeout && !st.reading.Position.Clear():
+			timeouts = append(timeouts, timeout{st.id, ReasonPosition, PositionMessage(st.reading.Position)})
+		case st.state == StateWeighing && now.Sub(st.since) >= cfg.StableTimeout:
+			timeouts = append(timeouts, timeout{st.id, ReasonUnstable,
+				fmt.Sprintf("Berat tidak stabil dalam %s, pastikan kendaraan berada penuh di atas timbangan", cfg.StableTimeout)})
+		default:
+			if f := c.weighIfReady(st, now); f != nil {
+				next = append(next, f)
+			}
+		}
+	}
+	c.mu.Unlock()
+	for _, t := range timeouts {
+		c.escalate(t.id, []string{StateIdentifying, StateWeighing}, t.reason, t.message, now)
+	}
+	for _, f := range next {
+		f()
+	}
+}
+
+func (c *Controller) occupied() float64 {
+	return c.Config.withDefaults().OccupiedWeight
+}
+
+// enter moves a station to a state. Callers must hold c.mu.
+func (st *station) enter(state string, now time.Time) {
+	st.state, st.since = state, now
+}
+
+// arrive starts the turn of a vehicle: a recent tag read identifies it,
+// the camera is asked for its plate. Callers must hold c.mu; the returned
+// function does the lookups and must be run without it.
+func (c *Controller) arrive(st *station, now time.Time) func() {
+	st.enter(StateIdentifying, now)
+	st.plate, st.source, st.driver, st.unknown = "", "", "", nil
+	st.ticket, st.escalation = nil, nil
+	tag, id, weight := st.lastTag, st.id, st.reading.Weight
+	start := c.recognizer(st)
+	return func() {
+		c.backend.Audit(Operator, "kiosk_arrival", id, 0, fmt.Sprintf("weight=%.2f", weight))
+		if tag.Tag != "" && now.Sub(tag.At) < c.Config.withDefaults().IdentifyTimeout {
+			c.identify(id, Identity{Source: SourceTag, Value: tag.Tag}, now)
+		}
+		start()
+	}
+}
+
+// recognizer returns a function running ANPR for the vehicle on a station
+// in the background. Callers must hold c.mu.
+func (c *Controller) recognizer(st *station) func() {
+	st.recognize++
+	run, id := st.recognize, st.id
+	return func() {
+		go func() {
+			plate, err := c.backend.Recognize(id)
+			if err != nil {
+				log.Printf("Kiosk station %d: ANPR: %v", id, err)
+				return
+			}
+			c.mu.Lock()
+			stale := c.stations[id] == nil || c.stations[id].recognize != run
+			c.mu.Unlock()
+			if !stale && plate != "" {
+				c.identify(id, Identity{Source: SourceANPR, Value: plate}, time.Now())
+			}
+		}()
+	}
+}
+
+// identify looks up a tag or plate and applies it to the vehicle on a
+// station. Unknown identities escalate only once the identification times
+// out, since a misread plate may still be followed by a good tag read.
+// Two registered vehicles for one turn are escalated at once.
+func (c *Controller) identify(id uint, ident Identity, now time.Time) {
+	plate, err := c.backend.Lookup(ident)
+	if err != nil && !errors.Is(err, ErrUnknownVehicle) {
+		log.Printf("Kiosk station %d: looking up %s %s: %v", id, ident.Source, ident.Value, err)
+		return
+	}
+
+	c.mu.Lock()
+	st := c.stations[id]
+	if st == nil || (st.state != StateIdentifying && st.state != StateWeighing) {
+		c.mu.Unlock()
+		return
+	}
+	switch {
+	case err != nil:
+		label := sourceLabel(ident.Source) + " " + ident.Value
+		for _, u := range st.unknown {
+			if u == label {
+				c.mu.Unlock()
+				return
+			}
+		}
+		st.unknown = append(st.unknown, label)
+		c.mu.Unlock()
+		c.backend.Audit(Operator, "kiosk_unknown_vehicle", id, 0, fmt.Sprintf("source=%s value=%s", ident.Source, ident.Value))
+	case st.plate == "":
+		st.plate, st.source = plate, ident.Source
+		st.enter(StateWeighing, now)
+		next := c.weighIfReady(st, now)
+		c.mu.Unlock()
+		c.backend.Audit(Operator, "kiosk_identified", id, 0, fmt.Sprintf("plate=%s source=%s value=%s", plate, ident.Source, ident.Value))
+		if next != nil {
+			next()
+		}
+	case samePlate(st.plate, plate):
+		c.mu.Unlock()
+	default:
+		first, source := st.plate, st.source
+		c.mu.Unlock()
+		c.escalate(id, []string{StateIdentifying, StateWeighing}, ReasonConflict,
+			fmt.Sprintf("%s menunjuk %s, %s menunjuk %s", sourceLabel(source), first, sourceLabel(ident.Source), plate), now)
+	}
+}
+
+// weighIfReady starts booking the vehicle of a station once it stands
+// still on the platform for SettleTime. Callers must hold c.mu; the
+// returned function books and must be run without it.
+func (c *Controller) weighIfReady(st *station, now time.Time) func() {
+	cfg := c.Config.withDefaults()
+	d := st.reading
+	if st.state != StateWeighing || !d.Stable || d.Overload || d.Tared() || !d.Position.Clear() || d.Weight < cfg.OccupiedWeight ||
+		st.stableAt.IsZero() || now.Sub(st.stableAt) < cfg.SettleTime {
+		return nil
+	}
+	st.enter(StateSaving, now)
+	st.captured = d
+	b := Booking{StationID: st.id, Plate: st.plate, DriverName: st.driver, Reading: d}
+	return func() { c.book(b, now) }
+}
+
+// book saves, prints and lets out the vehicle of a station in StateSaving
+func (c *Controller) book(b Booking, now time.Time) {
+	ticket, err := c.backend.Book(b)
+	if err != nil {
+		var p *Problem
+		if !errors.As(err, &p) {
+			log.Printf("Kiosk station %d: saving %s: %v", b.StationID, b.Plate, err)
+			p = &Problem{Reason: ReasonError, Message: "Gagal menyimpan penimbangan: " + err.Error()}
+		}
+		c.escalate(b.StationID, []string{StateSaving}, p.Reason, p.Message, now)
+		return
+	}
+	c.backend.Audit(Operator, "kiosk_weighed", b.StationID, ticket.RecordID,
+		fmt.Sprintf("ticket=%s status=%s plate=%s weight=%.2f", ticket.Number, ticket.Status, b.Plate, ticket.Weight))
+
+	c.mu.Lock()
+	if st := c.stations[b.StationID]; st != nil {
+		st.ticket = &ticket
+	}
+	c.mu.Unlock()
+
+	if err := c.backend.Print(b.StationID, ticket); err != nil {
+		log.Printf("Kiosk station %d: printing ticket %s: %v", b.StationID, ticket.Number, err)
+		c.escalate(b.StationID, []string{StateSaving}, ReasonPrint,
+			fmt.Sprintf("Tiket %s tersimpan tetapi gagal dicetak: %v", ticket.Number, err), now)
+		return
+	}
+	c.release(b.StationID, ticket)
+}
+
+// release opens the gate for a ticketed vehicle
+func (c *Controller) release(id uint, ticket Ticket) {
+	c.backend.OpenGate(id)
+	c.backend.Audit(Operator, "kiosk_gate_opened", id, ticket.RecordID, "ticket="+ticket.Number)
+	c.mu.Lock()
+	if st := c.stations[id]; st != nil {
+		st.enter(StateDone, time.Now())
+	}
+	c.mu.Unlock()
+}
+
+// escalate hands the vehicle of a station to the supervisors, if the
+// station is still in one of the states the escalation was decided in
+func (c *Controller) escalate(id uint, from []string, reason, message string, now time.Time) {
+	c.mu.Lock()
+	st := c.stations[id]
+	if st == nil || !slices.Contains(from, st.state) {
+		c.mu.Unlock()
+		return
+	}
+	e := Escalation{StationID: id, Reason: reason, Message: message, Plate: st.plate, At: now}
+	st.escalation = &e
+	st.enter(StateEscalated, now)
+	var recordID uint
+	if st.ticket != nil {
+		recordID = st.ticket.RecordID
+	}
+	c.mu.Unlock()
+
+	c.backend.Audit(Operator, "kiosk_escalated", id, recordID, fmt.Sprintf("reason=%s plate=%s: %s", reason, e.Plate, message))
+	c.backend.Notify(e)
+}
+
+// leave ends the turn of a vehicle that drove off the platform. Leaving
+// before being let out is audited and reported to the supervisors.
+// Callers must hold c.mu; the returned function must be run without it.
+func (c *Controller) leave(st *station, now time.Time) func() {
+	handled := st.state == StateDone
+	e := Escalation{StationID: st.id, Reason: ReasonLeft, Plate: st.plate, At: now,
+		Message: "Kendaraan meninggalkan timbangan tanpa tiket"}
+	var recordID uint
+	if st.ticket != nil {
+		recordID = st.ticket.RecordID
+		e.Message = fmt.Sprintf("Kendaraan meninggalkan timbangan sebelum dilepas (tiket %s)", st.ticket.Number)
+	}
+	if st.escalation != nil {
+		e.Message += " saat menunggu supervisor: " + st.escalation.Message
+	}
+	st.enter(StateIdle, now)
+	st.escalation = nil
+	st.recognize++
+	id := st.id
+	return func() {
+		if handled {
+			c.backend.Audit(Operator, "kiosk_departure", id, recordID, "")
+			return
+		}
+		c.backend.Audit(Operator, "kiosk_left_without_ticket", id, recordID, fmt.Sprintf("plate=%s: %s", e.Plate, e.Message))
+		c.backend.Notify(e)
+	}
+}
+
+// Resolve applies a supervisor's answer to the escalation of a station.
+// The supervisor is recorded as the approver of what they let through.
+func (c *Controller) Resolve(id uint, r Resolution, now time.Time) error {
+	c.mu.Lock()
+	st := c.stations[id]
+	if st == nil {
+		c.mu.Unlock()
+		return ErrNotKioskStation
+	}
+	if st.state != StateEscalated || st.escalation == nil {
+		c.mu.Unlock()
+		return ErrNotEscalated
+	}
+	reason := st.escalation.Reason
+	saved := reason == ReasonPrint
+	var next func()
+	switch r.Action {
+	case ActionIdentify:
+		plate := strings.TrimSpace(r.Plate)
+		if plate == "" {
+			c.mu.Unlock()
+			return ErrPlateRequired
+		}
+		if reason != ReasonUnidentified && reason != ReasonUnregistered && reason != ReasonConflict {
+			c.mu.Unlock()
+			return ErrNotApplicable
+		}
+		st.plate, st.source, st.driver = plate, SourceSupervisor, strings.TrimSpace(r.Driver)
+		st.enter(StateWeighing, now)
+		next = c.weighIfReady(st, now)
+	case ActionRetry:
+		switch {
+		case saved:
+			c.mu.Unlock()
+			return ErrNotApplicable
+		case reason == ReasonUnidentified || reason == ReasonUnregistered || reason == ReasonConflict:
+			st.plate, st.source, st.driver, st.unknown = "", "", "", nil
+			st.enter(StateIdentifying, now)
+			next = c.recognizer(st)
+		default:
+			st.enter(StateWeighing, now)
+			next = c.weighIfReady(st, now)
+		}
+	case ActionApprove:
+		switch {
+		case reason == ReasonOverload:
+			st.enter(StateSaving, now)
+			b := Booking{StationID: id, Plate: st.plate, DriverName: st.driver, Reading: st.captured, ApprovedBy: r.By}
+			next = func() { c.book(b, now) }
+		case saved && st.ticket != nil:
+			ticket := *st.ticket
+			st.enter(StateSaving, now)
+			next = func() { c.release(id, ticket) }
+		default:
+			c.mu.Unlock()
+			return ErrNotApplicable
+		}
+	case ActionCancel:
+		if saved {
+			c.mu.Unlock()
+			return ErrNotApplicable
+		}
+		st.enter(StateDone, now)
+	default:
+		c.mu.Unlock()
+		return ErrUnknownAction
+	}
+	detail := fmt.Sprintf("reason=%s action=%s plate=%s", reason, r.Action, st.plate)
+	var recordID uint
+	if st.ticket != nil {
+		recordID = st.ticket.RecordID
+	}
+	st.escalation = nil
+	c.mu.Unlock()
+
+	c.backend.Audit(r.By, "kiosk_resolved", id, recordID, detail)
+	if next != nil {
+		next()
+	}
+	return nil
+}
+
+// Status lists the kiosk stations, by ID
+func (c *Controller) Status() []StationStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]StationStatus, 0, len(c.stations))
+	for _, st := range c.stations {
+		s := StationStatus{
+			StationID: st.id, Name: st.name, Mode: st.mode, State: st.state, Since: st.since,
+			Weight: st.reading.Weight, Stable: st.reading.Stable, Position: st.reading.Position, Plate: st.plate, Source: st.source,
+		}
+		if st.ticket != nil {
+			t := *st.ticket
+			s.Ticket = &t
+		}
+		if st.escalation != nil {
+			e := *st.escalation
+			s.Escalation = &e
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StationID < out[j].StationID })
+	return out
+}
+
+// PositionMessage explains why the position sensors keep a vehicle from
+// being weighed, at the kiosk and at the operator desk alike
+func PositionMessage(p hardware.Position) string {
+	if !p.Online {
+		return "Sensor posisi tidak terhubung, kendaraan tidak dapat ditimbang"
+	}
+	inputs := make([]string, 0, len(p.BrokenInputs()))
+	for _, k := range p.BrokenInputs() {
+		inputs = append(inputs, strconv.Itoa(k))
+	}
+	return "Kendaraan belum berada penuh di atas timbangan: sensor posisi " + strings.Join(inputs, ", ") + " terhalang, pastikan semua roda berada di atas timbangan"
+}
+
+func sourceLabel(source string) string {
+	switch source {
+	case SourceTag:
+		return "Tag"
+	case SourceANPR:
+		return "Plat (ANPR)"
+	default:
+		return "Supervisor"
+	}
+}
+
+// samePlate compares plates the way operators type them, ignoring case and spaces
+func samePlate(a, b string) bool {
+	strip := func(s string) string { return strings.ToUpper(strings.ReplaceAll(s, " ", "")) }
+	return strip(a) == strip(b)
+}
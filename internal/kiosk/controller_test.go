@@ -0,0 +1,353 @@
+package kiosk
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/models"
+)
+
+// fakeBackend knows two trucks by tag and plate and records what the
+// kiosk does
+type fakeBackend struct {
+	mu       sync.Mutex
+	plate    string // Recognized by the camera, "" none
+	overload bool   // Book refuses without approval
+	printErr error
+	bookings []Booking
+	gates    int
+	audits   []string
+	notified []Escalation
+}
+
+func (b *fakeBackend) Lookup(id Identity) (string, error) {
+	switch id.Value {
+	case "E2000017220B", "B 1234 XY", "B1234XY":
+		return "B 1234 XY", nil
+	case "E20000172999", "B 5678 ZZ":
+		return "B 5678 ZZ", nil
+	}
+	return "", ErrUnknownVehicle
+}
+
+func (b *fakeBackend) Recognize(stationID uint) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.plate, nil
+}
+
+func (b *fakeBackend) Book(bk Booking) (Ticket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.overload && bk.ApprovedBy == "" {
+		return Ticket{}, &Problem{Reason: ReasonOverload, Message: "Muatan di atas JBI"}
+	}
+	b.bookings = append(b.bookings, bk)
+	n := len(b.bookings)
+	return Ticket{RecordID: uint(n), Number: fmt.Sprintf("T%d", n), Status: "PENDING", Weight: bk.Reading.SettledWeight}, nil
+}
+
+func (b *fakeBackend) Print(stationID uint, t Ticket) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.printErr
+}
+
+func (b *fakeBackend) OpenGate(stationID uint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.gates++
+}
+
+func (b *fakeBackend) Audit(username, action string, stationID, recordID uint, detail string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.audits = append(b.audits, username+":"+action)
+}
+
+func (b *fakeBackend) Notify(e Escalation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.notified = append(b.notified, e)
+}
+
+func (b *fakeBackend) audited(entry string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Contains(b.audits, entry)
+}
+
+// newKiosk is a controller running station 5 in two-pass mode
+func newKiosk(t *testing.T) (*Controller, *fakeBackend) {
+	t.Helper()
+	b := &fakeBackend{}
+	c := NewController(b)
+	c.Configure([]models.WeighingStation{
+		{Model: gorm.Model{ID: 5}, Name: "Gerbang Malam", KioskMode: ModeTwoPass},
+		{Model: gorm.Model{ID: 6}, Name: "Operator"},
+	}, time.Now())
+	return c, b
+}
+
+func reading(weight float64, stable bool) hardware.ScaleData {
+	return hardware.ScaleData{ScaleID: 5, Weight: weight, SettledWeight: weight, Stable: stable, Connected: true}
+}
+
+func wantState(t *testing.T, c *Controller, state string) StationStatus {
+	t.Helper()
+	for _, st := range c.Status() {
+		if st.StationID == 5 {
+			if st.State != state {
+				t.Fatalf("state %s, want %s (%+v)", st.State, state, st.Escalation)
+			}
+			return st
+		}
+	}
+	t.Fatal("station 5 is not a kiosk station")
+	return StationStatus{}
+}
+
+func TestKioskWeighsTaggedTruck(t *testing.T) {
+	c, b := newKiosk(t)
+	t0 := time.Now()
+	if got := len(c.Status()); got != 1 {
+		t.Fatalf("%d kiosk stations, want 1", got)
+	}
+
+	// The UHF reader at the entrance sees the truck before it is on
+	c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "E2000017220B", At: t0}, t0)
+	wantState(t, c, StateIdle)
+	c.Observe(reading(9000, false), t0.Add(time.Second))
+	st := wantState(t, c, StateWeighing)
+	if st.Plate != "B 1234 XY" || st.Source != SourceTag {
+		t.Fatalf("identified %s by %s", st.Plate, st.Source)
+	}
+
+	// Weighed once it has been still for SettleTime, not before
+	c.Observe(reading(15230, true), t0.Add(2*time.Second))
+	c.Observe(reading(15230, true), t0.Add(4*time.Second))
+	wantState(t, c, StateWeighing)
+	c.Observe(reading(15240, false), t0.Add(4500*time.Millisecond))
+	c.Observe(reading(15240, true), t0.Add(5*time.Second))
+	c.Tick(t0.Add(8 * time.Second))
+	st = wantState(t, c, StateDone)
+	if len(b.bookings) != 1 || b.bookings[0].Plate != "B 1234 XY" || b.bookings[0].Reading.SettledWeight != 15240 {
+		t.Fatalf("bookings %+v", b.bookings)
+	}
+	if st.Ticket == nil || st.Ticket.Number != "T1" || b.gates != 1 {
+		t.Fatalf("ticket %+v, gate opened %d times", st.Ticket, b.gates)
+	}
+
+	// Driving off ends the turn; the next truck starts over
+	c.Observe(reading(50, true), t0.Add(20*time.Second))
+	wantState(t, c, StateIdle)
+	for _, want := range []string{"kiosk:kiosk_arrival", "kiosk:kiosk_identified", "kiosk:kiosk_weighed", "kiosk:kiosk_gate_opened", "kiosk:kiosk_departure"} {
+		if !b.audited(want) {
+			t.Errorf("%s not audited: %v", want, b.audits)
+		}
+	}
+	if len(b.notified) != 0 {
+		t.Errorf("escalated: %+v", b.notified)
+	}
+
+	// Readings of other stations are not the kiosk's business
+	c.Observe(hardware.ScaleData{ScaleID: 6, Weight: 9000, Connected: true}, t0.Add(21*time.Second))
+	if len(c.Status()) != 1 {
+		t.Error("operator station picked up")
+	}
+}
+
+func TestKioskEscalations(t *testing.T) {
+	t.Run("unidentified", func(t *testing.T) {
+		c, b := newKiosk(t)
+		t0 := time.Now()
+		c.Observe(reading(9000, true), t0)
+		c.Tick(t0.Add(DefaultIdentifyTimeout - time.Second))
+		wantState(t, c, StateIdentifying)
+		c.Tick(t0.Add(DefaultIdentifyTimeout))
+		st := wantState(t, c, StateEscalated)
+		if st.Escalation.Reason != ReasonUnidentified || len(b.notified) != 1 {
+			t.Fatalf("escalation %+v, notified %d", st.Escalation, len(b.notified))
+		}
+
+		if err := c.Resolve(5, Resolution{Action: ActionApprove, By: "spv"}, t0); !errors.Is(err, ErrNotApplicable) {
+			t.Errorf("approve: %v", err)
+		}
+		if err := c.Resolve(5, Resolution{Action: ActionIdentify, By: "spv"}, t0); !errors.Is(err, ErrPlateRequired) {
+			t.Errorf("identify without plate: %v", err)
+		}
+		// The truck has been standing still all along, so it is weighed at once
+		if err := c.Resolve(5, Resolution{Action: ActionIdentify, Plate: "B 9999 NEW", Driver: " Andi ", By: "spv"}, t0.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		st = wantState(t, c, StateDone)
+		if st.Source != SourceSupervisor || b.bookings[0].Plate != "B 9999 NEW" || b.bookings[0].DriverName != "Andi" {
+			t.Errorf("booked %+v by %s", b.bookings, st.Source)
+		}
+		if !b.audited("spv:kiosk_resolved") {
+			t.Errorf("resolution not audited: %v", b.audits)
+		}
+		if err := c.Resolve(5, Resolution{Action: ActionCancel, By: "spv"}, t0); !errors.Is(err, ErrNotEscalated) {
+			t.Errorf("resolving twice: %v", err)
+		}
+		if err := c.Resolve(6, Resolution{Action: ActionCancel, By: "spv"}, t0); !errors.Is(err, ErrNotKioskStation) {
+			t.Errorf("operator station: %v", err)
+		}
+	})
+
+	t.Run("unregistered", func(t *testing.T) {
+		c, _ := newKiosk(t)
+		t0 := time.Now()
+		c.Observe(reading(9000, false), t0)
+		c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "12003AB45C", At: t0}, t0)
+		wantState(t, c, StateIdentifying)
+		c.Tick(t0.Add(DefaultIdentifyTimeout))
+		st := wantState(t, c, StateEscalated)
+		if st.Escalation.Reason != ReasonUnregistered {
+			t.Fatalf("escalation %+v", st.Escalation)
+		}
+		// Retrying waits for a new identification
+		if err := c.Resolve(5, Resolution{Action: ActionRetry, By: "spv"}, t0.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		wantState(t, c, StateIdentifying)
+		c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "E20000172999", At: t0}, t0.Add(time.Minute))
+		if st := wantState(t, c, StateWeighing); st.Plate != "B 5678 ZZ" {
+			t.Errorf("plate %s", st.Plate)
+		}
+	})
+
+	t.Run("tag and plate disagree", func(t *testing.T) {
+		c, b := newKiosk(t)
+		b.plate = "B 5678 ZZ"
+		t0 := time.Now()
+		c.Observe(reading(9000, false), t0)
+		c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "E2000017220B", At: t0}, t0)
+		deadline := time.Now().Add(time.Second)
+		for c.Status()[0].State != StateEscalated && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		st := wantState(t, c, StateEscalated)
+		if st.Escalation.Reason != ReasonConflict {
+			t.Fatalf("escalation %+v", st.Escalation)
+		}
+	})
+
+	t.Run("overload", func(t *testing.T) {
+		c, b := newKiosk(t)
+		b.overload = true
+		t0 := time.Now()
+		c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "E2000017220B", At: t0}, t0)
+		c.Observe(reading(31000, true), t0)
+		c.Observe(reading(31000, true), t0.Add(DefaultSettleTime))
+		st := wantState(t, c, StateEscalated)
+		if st.Escalation.Reason != ReasonOverload || b.gates != 0 {
+			t.Fatalf("escalation %+v, gate opened %d times", st.Escalation, b.gates)
+		}
+		if err := c.Resolve(5, Resolution{Action: ActionApprove, By: "spv"}, t0.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		wantState(t, c, StateDone)
+		if len(b.bookings) != 1 || b.bookings[0].ApprovedBy != "spv" || b.bookings[0].Reading.SettledWeight != 31000 || b.gates != 1 {
+			t.Errorf("bookings %+v, gate opened %d times", b.bookings, b.gates)
+		}
+	})
+
+	t.Run("ticket not printed", func(t *testing.T) {
+		c, b := newKiosk(t)
+		b.printErr = errors.New("printer offline")
+		t0 := time.Now()
+		c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "E2000017220B", At: t0}, t0)
+		c.Observe(reading(15000, true), t0)
+		c.Observe(reading(15000, true), t0.Add(DefaultSettleTime))
+		st := wantState(t, c, StateEscalated)
+		if st.Escalation.Reason != ReasonPrint || st.Ticket == nil || b.gates != 0 {
+			t.Fatalf("escalation %+v, ticket %+v, gate opened %d times", st.Escalation, st.Ticket, b.gates)
+		}
+		if err := c.Resolve(5, Resolution{Action: ActionCancel, By: "spv"}, t0); !errors.Is(err, ErrNotApplicable) {
+			t.Errorf("cancelling a saved ticket: %v", err)
+		}
+		if err := c.Resolve(5, Resolution{Action: ActionApprove, By: "spv"}, t0); err != nil {
+			t.Fatal(err)
+		}
+		wantState(t, c, StateDone)
+		if len(b.bookings) != 1 || b.gates != 1 {
+			t.Errorf("%d bookings, gate opened %d times", len(b.bookings), b.gates)
+		}
+	})
+
+	t.Run("trailer off the platform", func(t *testing.T) {
+		c, b := newKiosk(t)
+		t0 := time.Now()
+		c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "E2000017220B", At: t0}, t0)
+		broken := reading(12000, true)
+		broken.Position = hardware.Position{Beams: 3, Online: true, Broken: 2}
+		c.Observe(broken, t0)
+		c.Tick(t0.Add(10 * time.Second))
+		wantState(t, c, StateWeighing)
+		c.Tick(t0.Add(DefaultStableTimeout))
+		st := wantState(t, c, StateEscalated)
+		if st.Escalation.Reason != ReasonPosition || !strings.Contains(st.Escalation.Message, "sensor posisi 2") {
+			t.Fatalf("escalation %+v", st.Escalation)
+		}
+
+		// Pulled forward: weighed once settled with every beam clear
+		if err := c.Resolve(5, Resolution{Action: ActionRetry, By: "spv"}, t0.Add(DefaultStableTimeout)); err != nil {
+			t.Fatal(err)
+		}
+		onPlatform := reading(15000, true)
+		onPlatform.Position = hardware.Position{Beams: 3, Online: true}
+		later := t0.Add(DefaultStableTimeout + time.Second)
+		c.Observe(onPlatform, later)
+		c.Tick(later.Add(time.Second))
+		wantState(t, c, StateWeighing)
+		c.Tick(later.Add(DefaultSettleTime))
+		wantState(t, c, StateDone)
+		if len(b.bookings) != 1 || b.bookings[0].Reading.SettledWeight != 15000 {
+			t.Errorf("bookings %+v", b.bookings)
+		}
+	})
+
+	t.Run("indicator left tared", func(t *testing.T) {
+		c, b := newKiosk(t)
+		t0 := time.Now()
+		c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "E2000017220B", At: t0}, t0)
+		net := reading(9500, true)
+		net.Mode, net.HasMode = hardware.ModeNet, true
+		c.Observe(net, t0)
+		c.Tick(t0.Add(10 * time.Second))
+		wantState(t, c, StateWeighing)
+		c.Tick(t0.Add(DefaultStableTimeout))
+		st := wantState(t, c, StateEscalated)
+		if st.Escalation.Reason != ReasonUnstable || !strings.Contains(st.Escalation.Message, "mode net") || len(b.bookings) != 0 {
+			t.Fatalf("escalation %+v, bookings %+v", st.Escalation, b.bookings)
+		}
+	})
+
+	t.Run("not settling, then leaving", func(t *testing.T) {
+		c, b := newKiosk(t)
+		t0 := time.Now()
+		c.ObserveTag(hardware.TagRead{ScaleID: 5, Tag: "E2000017220B", At: t0}, t0)
+		c.Observe(reading(15000, false), t0)
+		c.Tick(t0.Add(DefaultStableTimeout))
+		st := wantState(t, c, StateEscalated)
+		if st.Escalation.Reason != ReasonUnstable {
+			t.Fatalf("escalation %+v", st.Escalation)
+		}
+		c.Observe(reading(0, true), t0.Add(DefaultStableTimeout+time.Second))
+		wantState(t, c, StateIdle)
+		if !b.audited("kiosk:kiosk_left_without_ticket") || len(b.notified) != 2 || b.notified[1].Reason != ReasonLeft {
+			t.Errorf("departure without ticket: audits %v, notified %+v", b.audits, b.notified)
+		}
+		if len(b.bookings) != 0 {
+			t.Errorf("booked %+v", b.bookings)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+// Package kiosk runs unattended weighing stations: the vehicle is
+// identified by its tag or plate, weighed once it stands still on the
+// platform, ticketed and let out without an operator. Anything the kiosk
+// cannot decide on its own is escalated to a supervisor.
+package kiosk
+
+import (
+	"errors"
+	"time"
+
+	"stoneweigh/internal/hardware"
+)
+
+// Station modes accepted in WeighingStation.KioskMode
+const (
+	ModeTwoPass = "two_pass" // Entry opens a PENDING ticket, exit completes it
+	ModeSingle  = "single"   // One weighing against the stored tare while it is valid
+)
+
+// Operator is the user name the kiosk's own actions are booked and audited under
+const Operator = "kiosk"
+
+// Station states
+const (
+	StateIdle        = "idle"        // No vehicle on the platform
+	StateIdentifying = "identifying" // Vehicle on, waiting for its tag or plate
+	StateWeighing    = "weighing"    // Identified, waiting for a settled reading
+	StateSaving      = "saving"      // Booking, printing and opening the gate
+	StateDone        = "done"        // Handled, waiting for the vehicle to leave
+	StateEscalated   = "escalated"   // Waiting for a supervisor
+)
+
+// Escalation reasons
+const (
+	ReasonUnidentified = "unidentified" // Neither tag nor plate in time
+	ReasonUnregistered = "unregistered" // Only tags or plates unknown to the vehicle master
+	ReasonConflict     = "conflict"     // Tag and plate name different vehicles
+	ReasonUnstable     = "unstable"     // No settled reading in time
+	ReasonPosition     = "position"     // A position sensor beam still broken, or the sensors offline
+	ReasonOverload     = "overload"     // Above the approval threshold of the JBI
+	ReasonBlocked      = "blocked"      // Above the blocking threshold, must not leave
+	ReasonPrint        = "print"        // Ticket saved but not printed, gate still closed
+	ReasonError        = "error"        // Saving failed
+	ReasonLeft         = "left"         // Vehicle left the platform without a ticket
+)
+
+// Identification sources
+const (
+	SourceTag        = "tag"
+	SourceANPR       = "anpr"
+	SourceSupervisor = "supervisor"
+)
+
+// Supervisor actions on an escalation
+const (
+	ActionIdentify = "identify" // Name the vehicle, registered or not
+	ActionRetry    = "retry"    // Identify or weigh again
+	ActionApprove  = "approve"  // Approve an overload, or let out a vehicle whose ticket did not print
+	ActionCancel   = "cancel"   // Turn the vehicle away without a ticket
+)
+
+var (
+	ErrUnknownVehicle  = errors.New("kendaraan tidak terdaftar")
+	ErrNotEscalated    = errors.New("stasiun tidak menunggu supervisor")
+	ErrPlateRequired   = errors.New("nomor polisi wajib diisi")
+	ErrNotApplicable   = errors.New("tindakan tidak berlaku untuk eskalasi ini")
+	ErrUnknownAction   = errors.New("tindakan tidak dikenal")
+	ErrNotKioskStation = errors.New("stasiun tidak dalam mode kiosk")
+)
+
+// Problem is a booking refused for a reason a supervisor has to resolve,
+// such as an overload. Backends return it from Book.
+type Problem struct {
+	Reason  string
+	Message string
+}
+
+func (p *Problem) Error() string { return p.Message }
+
+// Identity is a tag read or a recognized plate
+type Identity struct {
+	Source string
+	Value  string
+}
+
+// Booking is a settled weighing of an identified vehicle to save
+type Booking struct {
+	StationID  uint
+	Plate      string
+	DriverName string             // Named by a supervisor, "" to take the vehicle master's
+	Reading    hardware.ScaleData // The weight is its SettledWeight
+	ApprovedBy string             // Supervisor approving an overload
+}
+
+// Ticket is a saved weighing
+type Ticket struct {
+	RecordID uint    `json:"record_id"`
+	Number   string  `json:"number"`
+	Status   string  `json:"status"` // PENDING after an entry weighing, COMPLETED otherwise
+	Weight   float64 `json:"weight"`
+	Invoice  string  `json:"invoice,omitempty"` // PDF to print
+}
+
+// Escalation is a vehicle waiting for a supervisor
+type Escalation struct {
+	StationID uint      `json:"station_id"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Plate     string    `json:"plate,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Resolution is a supervisor's answer to an escalation
+type Resolution struct {
+	Action string `json:"action"`
+	Plate  string `json:"plate"`  // ActionIdentify only
+	Driver string `json:"driver"` // ActionIdentify only, needed for an unregistered vehicle
+	By     string `json:"-"`      // Supervisor username
+}
+
+// Backend books and prints for the kiosk. Its methods are called without
+// any kiosk lock held and may block.
+type Backend interface {
+	// Lookup returns the registered plate of a tag or recognized plate,
+	// ErrUnknownVehicle when there is none
+	Lookup(id Identity) (string, error)
+	// Recognize reads the plate of the vehicle on a station from its
+	// camera, "" when the station has none
+	Recognize(stationID uint) (string, error)
+	// Book saves a weighing: it completes an open ticket of the vehicle or
+	// opens or completes a new one, depending on the station mode
+	Book(b Booking) (Ticket, error)
+	// Print prints the ticket at the station
+	Print(stationID uint, t Ticket) error
+	// OpenGate lets the vehicle out
+	OpenGate(stationID uint)
+	// Audit records an action of the kiosk or of a supervisor
+	Audit(username, action string, stationID, recordID uint, detail string)
+	// Notify tells the remote supervisors about an escalation
+	Notify(e Escalation)
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
@@ -72,12 +73,12 @@ func AuthRequired() gin.HandlerFunc {
 	}
 }
 
-// RoleRequired checks for specific roles
-func RoleRequired(role string) gin.HandlerFunc {
+// RoleRequired checks for specific roles, any of the given ones
+func RoleRequired(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
-		userRole := session.Get("role")
-		if userRole != role {
+		userRole, _ := session.Get("role").(string)
+		if !slices.Contains(roles, userRole) {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
 			return
 		}
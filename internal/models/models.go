@@ -5,6 +5,14 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"stoneweigh/internal/pkg/units"
+)
+
+// WeighingRecord statuses
+const (
+	StatusPending   = "PENDING"
+	StatusCompleted = "COMPLETED"
+	StatusVoid      = "VOID"
 )
 
 // WeighingRecord represents a single weighing transaction
@@ -22,14 +30,74 @@ type WeighingRecord struct {
 	TareWeight  float64 `json:"tare_weight"`                  // Empty weight
 	NetWeight   float64 `json:"net_weight"`                   // Gross - Tare
 
+	// Weights are kilograms; Unit and Division are the station's display
+	// settings at the time of weighing, used on the invoice and reports
+	Unit     string  `json:"unit"`
+	Division float64 `json:"division"`
+
 	Status string `json:"status"` // "PENDING", "COMPLETED", "VOID"
 
+	// Two-pass weighing: the truck is weighed on entry and on exit,
+	// gross/tare are derived from whichever weight is larger once both exist.
+	FirstWeight     float64    `json:"first_weight"`
+	FirstWeighedAt  *time.Time `json:"first_weighed_at"`
+	SecondWeight    float64    `json:"second_weight"`
+	SecondWeighedAt *time.Time `json:"second_weighed_at"`
+
+	// Weight source: CaptureID links to the server-side capture token,
+	// ManualEntry marks typed weights (audited, see AuditLog)
+	CaptureID       string `gorm:"index" json:"capture_id"`
+	SecondCaptureID string `gorm:"index" json:"second_capture_id"`
+	ManualEntry     bool   `json:"manual_entry"`
+	ManualReason    string `json:"manual_reason,omitempty"`
+
 	// Snapshots paths
 	SnapshotFront string `json:"snapshot_front"` // CCTV Path
 	SnapshotBack  string `json:"snapshot_back"`  // CCTV Path
 	InvoicePath   string `json:"invoice_path"`   // PDF Path
 
 	WeighedAt time.Time `json:"weighed_at"`
+
+	// Overload (ODOL) check of the gross weight against the vehicle's
+	// permitted gross weight (JBI) at the time of weighing
+	PermittedGross     float64 `json:"permitted_gross"`
+	OverloadPercent    float64 `gorm:"index" json:"overload_percent"`
+	OverloadApprovedBy string  `json:"overload_approved_by,omitempty"` // Supervisor who let an overloaded truck through
+
+	// Per-axle weights when weighed on an axle weighing station
+	Axles []AxleWeight `gorm:"foreignKey:WeighingRecordID" json:"axles,omitempty"`
+
+	// Windows of the station's weight curve around each capture, kept past
+	// the sample retention so disputed weighings can be checked afterward
+	Curves []WeightCurve `gorm:"foreignKey:WeighingRecordID" json:"curves,omitempty"`
+}
+
+// FormatWeight formats one of the record's weights in its display unit
+func (wr WeighingRecord) FormatWeight(kg float64) string {
+	return units.Format(kg, wr.Unit, wr.Division)
+}
+
+// AxleWeight is one axle of a vehicle weighed axle by axle. Pass is the
+// weighing it belongs to: 1 for the first (or only) weighing, 2 for the
+// second weighing of a two-pass ticket.
+type AxleWeight struct {
+	gorm.Model
+	WeighingRecordID uint    `gorm:"index" json:"weighing_record_id"`
+	Pass             int     `json:"pass"`
+	Axle             int     `json:"axle"` // 1-based, in driving order
+	Weight           float64 `json:"weight"`
+}
+
+// WeightCurve links a weighing to the samples of its station recorded
+// between StartAt and EndAt. Pass is numbered like AxleWeight.Pass.
+type WeightCurve struct {
+	gorm.Model
+	WeighingRecordID uint      `gorm:"index" json:"weighing_record_id"`
+	StationID        uint      `gorm:"index" json:"station_id"`
+	Pass             int       `json:"pass"`
+	CapturedAt       time.Time `json:"captured_at"`
+	StartAt          time.Time `json:"start_at"`
+	EndAt            time.Time `json:"end_at"`
 }
 
 func (wr *WeighingRecord) BeforeCreate(tx *gorm.DB) error {
@@ -39,6 +107,12 @@ func (wr *WeighingRecord) BeforeCreate(tx *gorm.DB) error {
 	if wr.DriverName == "" {
 		return errors.New("nama supir tidak boleh kosong")
 	}
+	if wr.Status == StatusPending {
+		if wr.FirstWeight == 0 {
+			return errors.New("berat timbang pertama tidak boleh kosong")
+		}
+		return nil
+	}
 	if wr.GrossWeight == 0 {
 		return errors.New("berat kotor tidak boleh kosong")
 	}
@@ -60,32 +134,145 @@ type WeighingStation struct {
 	Name      string          `json:"name"`       // e.g., "Main Gate"
 	ScalePort string          `json:"scale_port"` // e.g., "COM3" or "/dev/ttyUSB0"
 	BaudRate  int             `json:"baud_rate"`  // e.g., 9600
+	Protocol  string          `json:"protocol"`   // Indicator driver: "generic", "toledo", "and", "rinstrun"
 	Cameras   []StationCamera `json:"cameras"`    // Multiple CCTVs
 	Enabled   bool            `json:"enabled"`
 	Token     string          `json:"token"`      // Security token for remote data push
 
+	// Serial line settings, zero values mean 8N1 without flow control
+	DataBits    int    `json:"data_bits"`    // 5-8 (default 8)
+	Parity      string `json:"parity"`       // "N", "E", "O", "M" or "S" (default "N")
+	StopBits    string `json:"stop_bits"`    // "1", "1.5" or "2" (default "1")
+	FlowControl string `json:"flow_control"` // "none" or "rtscts"
+	Terminator  string `json:"terminator"`   // "CR", "LF", "CRLF", "STX_ETX"; empty uses the protocol framing
+	RecordRaw   bool   `json:"record_raw"`   // Save the raw byte stream to a capture file for debugging
+
+	// Split-deck weighbridges: a Summing station has no port of its own,
+	// its weight is the sum of the deck stations whose SumStationID points
+	// to it. It is stable only while every deck is connected and stable.
+	Summing      bool `json:"summing"`
+	SumStationID uint `gorm:"index" json:"sum_station_id"` // Deck of this summing station (0 = standalone)
+
+	// Simulator scenario (built-in name or YAML/JSON file); when set the
+	// station is simulated and ScalePort is not opened
+	SimScenario string `json:"sim_scenario"`
+
+	// Regex with a (?P<weight>...) group, used by the "generic" protocol
+	ProtocolPattern string `json:"protocol_pattern"`
+
+	// Holding register mapping, used by the "modbus_rtu" and "modbus_tcp" protocols
+	ModbusUnitID    int     `json:"modbus_unit_id"`    // Slave/unit address (default 1)
+	ModbusRegister  int     `json:"modbus_register"`   // Zero-based address of the weight register
+	ModbusDataType  string  `json:"modbus_data_type"`  // "int16", "uint16", "int32", "uint32", "float32" (default "int32")
+	ModbusWordOrder string  `json:"modbus_word_order"` // 32-bit types: "big" (high word first, default) or "little"
+	ModbusScale     float64 `json:"modbus_scale"`      // Raw value multiplier, e.g. 0.1 (default 1)
+	PollIntervalMs  int     `json:"poll_interval_ms"`  // Default 200
+
+	// Display unit and division, e.g. "t" with 0.01 for 10 kg steps. Weights
+	// are kept in kg, rounded to the division; frames that carry no unit
+	// are read in Unit.
+	Unit     string  `json:"unit"`     // "kg" (default), "t", "lb" or "g"
+	Division float64 `json:"division"` // 0 keeps the indicator's resolution
+
+	// Stability engine, used when the protocol has no motion flag
+	StableWindowMs  int     `json:"stable_window_ms"` // Reading must hold this long (default 1500)
+	StableTolerance float64 `json:"stable_tolerance"` // Max spread within the window (default 20)
+	RequireStable   bool    `json:"require_stable"`   // Refuse to save while the scale is moving
+
+	AllowManualEntry bool `json:"allow_manual_entry"` // Operators may type weights (admins always can)
+
+	// Axle by axle weighing on platforms shorter than the trucks: each
+	// settled peak is one axle, the pass ends once the platform has been
+	// below AxleMinWeight for AxleTimeoutMs
+	AxleMode      bool    `json:"axle_mode"`
+	AxleTimeoutMs int     `json:"axle_timeout_ms"` // Default 10000
+	AxleMinWeight float64 `json:"axle_min_weight"` // Default 200
+
+	// RFID card / UHF tag reader identifying vehicles, on a port of its
+	// own. Reads are looked up in VehicleTag.
+	ReaderProtocol string `json:"reader_protocol"`  // "" (no reader), "wiegand" or "ascii"
+	ReaderPort     string `json:"reader_port"`      // Serial port, tcp://host:port or tcp-listen://host:port
+	ReaderBaudRate int    `json:"reader_baud_rate"` // Serial readers (default 9600)
+
+	// Position sensors (photo-eyes / IR beams at the platform ends) read
+	// through an input module on a port of its own. Nothing is captured
+	// while a beam is broken or the module does not answer.
+	SensorProtocol       string `json:"sensor_protocol"`        // "" (no sensors), "ascii", "modbus_rtu" or "modbus_tcp"
+	SensorPort           string `json:"sensor_port"`            // Serial port, tcp://host:port or tcp-listen://host:port
+	SensorBaudRate       int    `json:"sensor_baud_rate"`       // Serial modules (default 9600)
+	SensorUnitID         int    `json:"sensor_unit_id"`         // Modbus slave address (default 1)
+	SensorInputs         string `json:"sensor_inputs"`          // 1-based inputs wired to beams, comma separated (default "1,2")
+	SensorNormallyClosed bool   `json:"sensor_normally_closed"` // Input is on while the beam is clear, so a cut wire reads as broken
+
+	// Unattended kiosk weighing: vehicles identified by tag or ANPR are
+	// weighed, ticketed and let out without an operator
+	KioskMode    string `json:"kiosk_mode"`    // "" (operator), "two_pass" or "single" (stored tare)
+	KioskPrinter string `json:"kiosk_printer"` // CUPS printer for the tickets, "" to not print
+
 	// Deprecated: Kept for migration, assume data moved to Cameras[0]
 	CameraURL string `json:"camera_url,omitempty"`
 }
 
-type ScaleConfig struct {
-	gorm.Model
-	Name     string `json:"name"`
-	Port     string `json:"port"`
-	BaudRate int    `json:"baud_rate"`
-	DataBits int    `json:"data_bits"`
-	StopBits int    `json:"stop_bits"`
-	Parity   int    `json:"parity"`
-	Enabled  bool   `json:"enabled"`
-}
-
 // Vehicle represents master data for known vehicles
 type Vehicle struct {
 	gorm.Model
 	PlateNumber  string  `gorm:"uniqueIndex" json:"plate_number"`
 	DriverName   string  `json:"driver_name"`
-	DefaultTare  float64 `json:"default_tare"` // Known empty weight
+	DefaultTare  float64 `json:"default_tare"` // Known empty weight, the latest TareRecord
 	OwnerCompany string  `json:"owner_company"`
+
+	TareMeasuredAt *time.Time   `json:"tare_measured_at"` // When DefaultTare was weighed, nil for legacy values
+	Tares          []TareRecord `json:"tares,omitempty"`
+
+	// Legal limits for overload (ODOL) enforcement
+	VehicleClass   string  `json:"vehicle_class"`   // Golongan, e.g. "III"
+	AxleConfig     string  `json:"axle_config"`     // Axle configuration, e.g. "1.2", "1.22", "1.2-222"
+	PermittedGross float64 `json:"permitted_gross"` // JBI in kg, 0 when unknown
+
+	Tags []VehicleTag `json:"tags,omitempty"` // RFID cards and UHF tags of the vehicle
+}
+
+// VehicleTag is an RFID card or UHF tag that identifies a vehicle at the
+// station readers
+type VehicleTag struct {
+	gorm.Model
+	VehicleID uint   `gorm:"index" json:"vehicle_id"`
+	TagID     string `gorm:"uniqueIndex" json:"tag_id"` // As normalized by hardware.NormalizeTag
+	Label     string `json:"label"`                     // e.g. "Kartu supir" or "Stiker kaca"
+}
+
+// Tare sources
+const (
+	TareSourceWeighing = "tare_weighing" // Empty truck weighed on purpose
+	TareSourceTwoPass  = "two_pass"      // Lighter weight of a completed two-pass ticket
+	TareSourceManual   = "manual"        // Typed in the vehicle master
+)
+
+// TareRecord is one measurement of a vehicle's empty weight. The latest
+// measurement becomes Vehicle.DefaultTare.
+type TareRecord struct {
+	gorm.Model
+	VehicleID        uint      `gorm:"index" json:"vehicle_id"`
+	Weight           float64   `json:"weight"`
+	MeasuredAt       time.Time `json:"measured_at"`
+	StationID        uint      `json:"station_id"` // 0 when typed in the vehicle master
+	Operator         string    `json:"operator"`
+	Source           string    `json:"source"`
+	CaptureID        string    `gorm:"index" json:"capture_id,omitempty"`
+	WeighingRecordID uint      `json:"weighing_record_id,omitempty"` // Two-pass ticket the tare came from
+
+	// Change against the previous tare, in percent. Flagged when above
+	// the configured threshold: repairs, a missing tank or a bad weighing.
+	Deviation float64 `json:"deviation"`
+	Flagged   bool    `gorm:"index" json:"flagged"`
+}
+
+// UsedCapture marks a capture token as spent. The row is inserted in the
+// transaction saving the weight, so its primary key lets only one record
+// or tare commit per token.
+type UsedCapture struct {
+	CaptureID string    `gorm:"primaryKey" json:"capture_id"`
+	UsedAt    time.Time `json:"used_at"`
 }
 
 // Invoice metadata
@@ -104,7 +291,7 @@ type User struct {
 	Username     string `gorm:"uniqueIndex;not null" json:"username"`
 	PasswordHash string `json:"-"` // Store bcrypt hash
 	FullName     string `json:"full_name"`
-	Role         string `json:"role"` // "admin", "operator"
+	Role         string `json:"role"` // "admin", "supervisor", "operator"
 }
 
 // UserStationAssignment links a User to specific WeighingStations.
@@ -117,3 +304,75 @@ type UserStationAssignment struct {
 	WeighingStationID uint            `json:"weighing_station_id"`
 	WeighingStation   WeighingStation `json:"weighing_station"`
 }
+
+// AuditLog records sensitive operator actions (manual weights, remote zeroing...)
+type AuditLog struct {
+	gorm.Model
+	Action    string `gorm:"index" json:"action"`
+	Username  string `json:"username"`
+	StationID uint   `gorm:"index" json:"station_id"`
+	RecordID  uint   `json:"record_id"`
+	Detail    string `json:"detail"`
+}
+
+// ScaleEvent is a persisted scale health event: connects, disconnects,
+// silent/stuck alerts and their recovery (see hardware.HealthEvent)
+type ScaleEvent struct {
+	gorm.Model
+	StationID uint      `gorm:"index" json:"station_id"`
+	Kind      string    `gorm:"index" json:"kind"`
+	Detail    string    `json:"detail"`
+	At        time.Time `gorm:"index" json:"at"`
+}
+
+// ScaleHealthSnapshot is the link quality of a station saved periodically,
+// so frame errors can be followed over days (see hardware.Health). Frames
+// and ParseErrors count since the service started; ErrorRate covers the
+// period since the previous snapshot.
+type ScaleHealthSnapshot struct {
+	ID          uint       `gorm:"primaryKey" json:"-"`
+	StationID   uint       `gorm:"index" json:"station_id"`
+	At          time.Time  `gorm:"index" json:"at"`
+	Connected   bool       `json:"connected"`
+	Frames      uint64     `json:"frames"`
+	ParseErrors uint64     `json:"parse_errors"`
+	ErrorRate   float64    `json:"error_rate"`
+	LastFrameAt *time.Time `json:"last_frame_at"`
+}
+
+// WeightSample is one point of a station's weight curve. Samples are
+// downsampled on change and pruned after the retention period, so the
+// table stays compact: no soft delete, no update timestamps.
+type WeightSample struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	StationID uint      `gorm:"index:idx_weight_samples_station_at,priority:1" json:"station_id"`
+	At        time.Time `gorm:"index:idx_weight_samples_station_at,priority:2" json:"at"`
+	Weight    float64   `json:"weight"`
+	Stable    bool      `json:"stable"`
+	Connected bool      `json:"connected"`
+}
+
+// OutputDevice is a relay board switching barrier gates and traffic
+// lights (see the outputs package for the drivers)
+type OutputDevice struct {
+	gorm.Model
+	Name     string `json:"name"`
+	Driver   string `json:"driver"`    // "serial", "modbus_rtu", "modbus_tcp", "http" or "sim"
+	Address  string `json:"address"`   // Serial port or tcp://host:port, host:port for Modbus TCP, URL template for HTTP
+	BaudRate int    `json:"baud_rate"` // Serial boards and Modbus RTU (default 9600)
+	UnitID   int    `json:"unit_id"`   // Modbus slave address (default 1)
+	Enabled  bool   `json:"enabled"`
+}
+
+// OutputRule switches a relay channel of a device when an event happens
+// on a station
+type OutputRule struct {
+	gorm.Model
+	StationID uint   `gorm:"index" json:"station_id"`
+	Event     string `json:"event"` // "vehicle_on", "vehicle_off", "stable", "moving" or "saved"
+	DeviceID  uint   `gorm:"index" json:"device_id"`
+	Channel   int    `json:"channel"`  // 1-based relay or coil number
+	Action    string `json:"action"`   // "on", "off" or "pulse"
+	PulseMs   int    `json:"pulse_ms"` // Pulse length (default 1000)
+	Enabled   bool   `json:"enabled"`
+}
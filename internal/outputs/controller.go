@@ -0,0 +1,348 @@
+package outputs
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/hub"
+)
+
+// Station events accepted in OutputRule.Event
+const (
+	EventOccupied = "vehicle_on"  // Weight rose to OccupiedWeight
+	EventVacant   = "vehicle_off" // Weight fell below half of it, or the scale disconnected
+	EventStable   = "stable"      // Settled with a vehicle on the scale
+	EventMoving   = "moving"      // Moving again with a vehicle on the scale
+	EventSaved    = "saved"       // A weighing was saved on the station
+)
+
+// DefaultOccupiedWeight is the weight (kg) from which a vehicle is on the scale
+const DefaultOccupiedWeight = 200
+
+// Controller switches the relay outputs bound to station events. Scale
+// readings come in through Observe (or Run), saved weighings through Fire.
+type Controller struct {
+	OccupiedWeight float64 // kg, DefaultOccupiedWeight when 0
+
+	mu       sync.Mutex
+	devices  map[uint]*device
+	rules    []models.OutputRule
+	stations map[uint]presence
+	pulses   map[channelKey]*pulse
+}
+
+// device is a configured relay device and what we last switched on it
+type device struct {
+	config   models.OutputDevice
+	driver   Driver // nil when the configuration is invalid
+	err      error  // Configuration error, or the last I/O error
+	errAt    time.Time
+	channels map[int]bool
+}
+
+type channelKey struct {
+	device  uint
+	channel int
+}
+
+// pulse is a channel switched on by a pulse rule, waiting to be switched off
+type pulse struct {
+	timer *time.Timer
+	dev   *device
+}
+
+// presence is what the controller last concluded about a station
+type presence struct {
+	occupied bool
+	stable   bool
+}
+
+// NewController creates a controller without devices or rules
+func NewController() *Controller {
+	return &Controller{
+		OccupiedWeight: DefaultOccupiedWeight,
+		devices:        make(map[uint]*device),
+		stations:       make(map[uint]presence),
+		pulses:         make(map[channelKey]*pulse),
+	}
+}
+
+// Load applies the enabled devices and rules of the database
+func (c *Controller) Load(db *gorm.DB) error {
+	var devices []models.OutputDevice
+	if err := db.Where("enabled = ?", true).Find(&devices).Error; err != nil {
+		return err
+	}
+	var rules []models.OutputRule
+	if err := db.Where("enabled = ?", true).Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+	c.Configure(devices, rules)
+	return nil
+}
+
+// Configure replaces the devices and rules. Devices whose connection
+// settings did not change keep their driver and channel states; pending
+// pulses of the others end now.
+func (c *Controller) Configure(devices []models.OutputDevice, rules []models.OutputRule) {
+	c.mu.Lock()
+	old := c.devices
+	c.devices = make(map[uint]*device, len(devices))
+	for _, cfg := range devices {
+		if dev, ok := old[cfg.ID]; ok && sameLink(dev.config, cfg) {
+			dev.config = cfg
+			c.devices[cfg.ID] = dev
+			delete(old, cfg.ID)
+			continue
+		}
+		dev := &device{config: cfg, channels: make(map[int]bool)}
+		dev.driver, dev.err = NewDriver(cfg)
+		if dev.err != nil {
+			dev.errAt = time.Now()
+			log.Printf("Output device %d (%s): %v", cfg.ID, cfg.Name, dev.err)
+		}
+		c.devices[cfg.ID] = dev
+	}
+	c.rules = append([]models.OutputRule(nil), rules...)
+	sort.Slice(c.rules, func(i, j int) bool { return c.rules[i].ID < c.rules[j].ID })
+	ended := c.takePulses(func(p *pulse) bool { return c.devices[p.dev.config.ID] != p.dev })
+	c.mu.Unlock()
+
+	c.endPulses(ended)
+	for _, dev := range old {
+		if dev.driver != nil {
+			dev.driver.Close()
+		}
+	}
+}
+
+// sameLink reports whether two configurations drive the same relays the same way
+func sameLink(a, b models.OutputDevice) bool {
+	return a.Driver == b.Driver && a.Address == b.Address && a.BaudRate == b.BaudRate && a.UnitID == b.UnitID
+}
+
+// Run feeds the readings of a scale manager to Observe until stop is
+// closed. Run it in its own goroutine.
+func (c *Controller) Run(events *hub.Hub[hardware.ScaleData], stop <-chan struct{}) {
+	sub := events.Subscribe(256)
+	defer sub.Close()
+	for {
+		select {
+		case <-stop:
+			return
+		case d := <-sub.C:
+			c.Observe(d)
+		}
+	}
+}
+
+// Observe derives the vehicle events of a station from its readings. A
+// vehicle arrives at OccupiedWeight and leaves below half of it, so a
+// reading wobbling around the threshold does not flicker the lights.
+func (c *Controller) Observe(d hardware.ScaleData) {
+	threshold := c.OccupiedWeight
+	if threshold <= 0 {
+		threshold = DefaultOccupiedWeight
+	}
+
+	c.mu.Lock()
+	prev := c.stations[d.ScaleID]
+	now := prev
+	switch {
+	case !d.Connected:
+		now.occupied = false // Fail safe: red light, gate stays closed
+	case d.Weight >= threshold:
+		now.occupied = true
+	case d.Weight < threshold/2:
+		now.occupied = false
+	}
+	now.stable = now.occupied && d.Stable
+	c.stations[d.ScaleID] = now
+	c.mu.Unlock()
+
+	if now.occupied != prev.occupied {
+		if now.occupied {
+			c.Fire(d.ScaleID, EventOccupied)
+		} else {
+			c.Fire(d.ScaleID, EventVacant)
+		}
+	}
+	if now.occupied && now.stable != prev.stable {
+		if now.stable {
+			c.Fire(d.ScaleID, EventStable)
+		} else {
+			c.Fire(d.ScaleID, EventMoving)
+		}
+	}
+}
+
+// Fire runs the rules bound to an event of a station, in rule order.
+// Failures are logged and kept in the device status.
+func (c *Controller) Fire(stationID uint, event string) {
+	c.mu.Lock()
+	var rules []models.OutputRule
+	for _, r := range c.rules {
+		if r.StationID == stationID && r.Event == event {
+			rules = append(rules, r)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, r := range rules {
+		if err := c.Switch(r.DeviceID, r.Channel, r.Action, time.Duration(r.PulseMs)*time.Millisecond); err != nil {
+			log.Printf("Output rule %d (%s on station %d): %v", r.ID, event, stationID, err)
+		}
+	}
+}
+
+// Switch applies an action to a channel. A pulse switches the channel on
+// and off again after length (DefaultPulse when 0); any later action on
+// the channel replaces a pulse still running.
+func (c *Controller) Switch(deviceID uint, channel int, action string, length time.Duration) error {
+	if action != ActionOn && action != ActionOff && action != ActionPulse {
+		return fmt.Errorf("unknown action %q", action)
+	}
+	c.mu.Lock()
+	dev, ok := c.devices[deviceID]
+	key := channelKey{deviceID, channel}
+	if p := c.pulses[key]; p != nil {
+		p.timer.Stop()
+		delete(c.pulses, key)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown output device %d", deviceID)
+	}
+
+	if err := c.set(dev, channel, action != ActionOff); err != nil {
+		return err
+	}
+	if action != ActionPulse {
+		return nil
+	}
+	if length <= 0 {
+		length = DefaultPulse
+	}
+	c.mu.Lock()
+	p := &pulse{dev: dev}
+	p.timer = time.AfterFunc(length, func() {
+		c.mu.Lock()
+		if c.pulses[key] != p {
+			c.mu.Unlock()
+			return // Replaced in the meantime
+		}
+		delete(c.pulses, key)
+		c.mu.Unlock()
+		if err := c.set(dev, channel, false); err != nil {
+			log.Printf("Output device %d channel %d: ending pulse: %v", deviceID, channel, err)
+		}
+	})
+	c.pulses[key] = p
+	c.mu.Unlock()
+	return nil
+}
+
+// set switches one channel and records the outcome. No lock is held during
+// the I/O, the driver serializes its own commands.
+func (c *Controller) set(dev *device, channel int, on bool) error {
+	if dev.driver == nil {
+		return dev.err
+	}
+	err := dev.driver.Set(channel, on)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		dev.err, dev.errAt = err, time.Now()
+		return err
+	}
+	dev.err = nil
+	dev.channels[channel] = on
+	return nil
+}
+
+// takePulses removes the pulses matching end and returns them.
+// Callers must hold c.mu.
+func (c *Controller) takePulses(end func(*pulse) bool) map[channelKey]*pulse {
+	ended := make(map[channelKey]*pulse)
+	for key, p := range c.pulses {
+		if end(p) {
+			p.timer.Stop()
+			delete(c.pulses, key)
+			ended[key] = p
+		}
+	}
+	return ended
+}
+
+// endPulses switches off the channels of pulses cut short, so a barrier
+// gate is never left open
+func (c *Controller) endPulses(ended map[channelKey]*pulse) {
+	for key, p := range ended {
+		if err := c.set(p.dev, key.channel, false); err != nil {
+			log.Printf("Output device %d channel %d: ending pulse: %v", key.device, key.channel, err)
+		}
+	}
+}
+
+// Close ends running pulses and releases every device
+func (c *Controller) Close() {
+	c.mu.Lock()
+	ended := c.takePulses(func(*pulse) bool { return true })
+	devices := c.devices
+	c.devices = make(map[uint]*device)
+	c.mu.Unlock()
+
+	c.endPulses(ended)
+	for _, dev := range devices {
+		if dev.driver != nil {
+			dev.driver.Close()
+		}
+	}
+}
+
+// Driver returns the driver of a device, nil when unknown or invalid
+func (c *Controller) Driver(deviceID uint) Driver {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if dev, ok := c.devices[deviceID]; ok {
+		return dev.driver
+	}
+	return nil
+}
+
+// DeviceStatus is a device on the outputs settings page
+type DeviceStatus struct {
+	ID       uint         `json:"id"`
+	Name     string       `json:"name"`
+	Driver   string       `json:"driver"`
+	Channels map[int]bool `json:"channels"` // Last state switched on each channel
+	Error    string       `json:"error,omitempty"`
+	ErrorAt  *time.Time   `json:"error_at,omitempty"`
+}
+
+// Status lists the configured devices, by ID
+func (c *Controller) Status() []DeviceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]DeviceStatus, 0, len(c.devices))
+	for id, dev := range c.devices {
+		st := DeviceStatus{ID: id, Name: dev.config.Name, Driver: dev.config.Driver, Channels: make(map[int]bool)}
+		for ch, on := range dev.channels {
+			st.Channels[ch] = on
+		}
+		if dev.err != nil {
+			at := dev.errAt
+			st.Error, st.ErrorAt = dev.err.Error(), &at
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,181 @@
+package outputs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/models"
+)
+
+const (
+	red   = 1
+	green = 2
+	gate  = 3
+)
+
+// newLane is a controller with one simulated relay board running the
+// lights and the gate of station 5
+func newLane(t *testing.T) (*Controller, *Simulated) {
+	t.Helper()
+	c := NewController()
+	t.Cleanup(c.Close)
+	rule := func(event string, channel int, action string) models.OutputRule {
+		return models.OutputRule{StationID: 5, Event: event, DeviceID: 1, Channel: channel, Action: action, PulseMs: 50}
+	}
+	c.Configure(
+		[]models.OutputDevice{{Model: gorm.Model{ID: 1}, Name: "Lane", Driver: DriverSim}},
+		[]models.OutputRule{
+			rule(EventOccupied, red, ActionOn),
+			rule(EventStable, red, ActionOff),
+			rule(EventStable, green, ActionOn),
+			rule(EventMoving, green, ActionOff),
+			rule(EventMoving, red, ActionOn),
+			rule(EventVacant, green, ActionOff),
+			rule(EventVacant, red, ActionOff),
+			rule(EventSaved, gate, ActionPulse),
+		},
+	)
+	sim, ok := c.Driver(1).(*Simulated)
+	if !ok {
+		t.Fatal("sim device has no simulated driver")
+	}
+	return c, sim
+}
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestControllerLights(t *testing.T) {
+	c, sim := newLane(t)
+	lights := func() [2]bool { return [2]bool{sim.State(red), sim.State(green)} }
+	observe := func(weight float64, stable bool) {
+		c.Observe(hardware.ScaleData{ScaleID: 5, Weight: weight, Stable: stable, Connected: true})
+	}
+
+	observe(0, true)
+	observe(150, true) // Below the threshold: a person, not a truck
+	if len(sim.Log()) != 0 {
+		t.Fatalf("switched without a vehicle: %+v", sim.Log())
+	}
+
+	observe(12000, false)
+	if got := lights(); got != [2]bool{true, false} {
+		t.Errorf("vehicle driving on: %v", got)
+	}
+	observe(12000, true)
+	if got := lights(); got != [2]bool{false, true} {
+		t.Errorf("vehicle settled: %v", got)
+	}
+
+	// Readings of another station do not matter
+	c.Observe(hardware.ScaleData{ScaleID: 6, Weight: 0, Connected: true})
+	if got := lights(); got != [2]bool{false, true} {
+		t.Errorf("other station changed the lights: %v", got)
+	}
+
+	// Above half the threshold the vehicle is still on, just moving
+	observe(150, false)
+	if got := lights(); got != [2]bool{true, false} {
+		t.Errorf("vehicle leaving: %v", got)
+	}
+	observe(50, true)
+	if got := lights(); got != [2]bool{false, false} {
+		t.Errorf("vehicle gone: %v", got)
+	}
+
+	// A disconnected scale counts as empty
+	observe(12000, true)
+	c.Observe(hardware.ScaleData{ScaleID: 5, Weight: 12000, Stable: true})
+	if got := lights(); got != [2]bool{false, false} {
+		t.Errorf("disconnected scale: %v", got)
+	}
+}
+
+func TestControllerGatePulse(t *testing.T) {
+	c, sim := newLane(t)
+
+	c.Fire(5, EventSaved)
+	if !sim.State(gate) {
+		t.Fatal("gate not opened on save")
+	}
+	waitFor(t, "gate pulse never ended", func() bool { return !sim.State(gate) })
+
+	// A later command on the channel replaces the running pulse
+	c.Fire(5, EventSaved)
+	if err := c.Switch(1, gate, ActionOn, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !sim.State(gate) {
+		t.Error("pulse switched off a channel that was switched on since")
+	}
+
+	// Pulses cut short by a reload or shutdown still close the gate
+	if err := c.Switch(1, gate, ActionPulse, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	c.Configure(nil, nil)
+	if sim.State(gate) {
+		t.Error("gate left open by a reload")
+	}
+}
+
+func TestControllerConfigure(t *testing.T) {
+	c, sim := newLane(t)
+	c.Fire(5, EventStable)
+
+	// Same link: driver and channel states survive the reload
+	c.Configure([]models.OutputDevice{{Model: gorm.Model{ID: 1}, Name: "Renamed", Driver: DriverSim}}, nil)
+	if c.Driver(1) != Driver(sim) {
+		t.Fatal("unchanged device got a new driver")
+	}
+	st := c.Status()
+	if len(st) != 1 || st[0].Name != "Renamed" || !st[0].Channels[green] {
+		t.Errorf("status after reload: %+v", st)
+	}
+
+	// Rules are gone with the reload
+	c.Fire(5, EventVacant)
+	if !sim.State(green) {
+		t.Error("removed rule still runs")
+	}
+}
+
+func TestControllerErrors(t *testing.T) {
+	c, sim := newLane(t)
+	sim.Fail(errors.New("board unplugged"))
+	c.Fire(5, EventSaved)
+	if st := c.Status(); st[0].Error != "board unplugged" || st[0].ErrorAt == nil {
+		t.Errorf("error not reported: %+v", st)
+	}
+	sim.Fail(nil)
+	if err := c.Switch(1, red, ActionOn, 0); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.Status(); st[0].Error != "" {
+		t.Errorf("error kept after recovery: %+v", st)
+	}
+
+	if err := c.Switch(9, red, ActionOn, 0); err == nil {
+		t.Error("unknown device accepted")
+	}
+	c.Configure([]models.OutputDevice{{Model: gorm.Model{ID: 2}, Driver: "plc"}}, nil)
+	if err := c.Switch(2, red, ActionOn, 0); err == nil {
+		t.Error("invalid device switched")
+	}
+	if st := c.Status(); len(st) != 1 || st[0].Error == "" {
+		t.Errorf("invalid device not reported: %+v", st)
+	}
+}
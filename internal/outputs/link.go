@@ -0,0 +1,103 @@
+package outputs
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// link is the byte stream of a serial or Modbus relay: a local serial port
+// (8N1) or tcp://host:port for a serial-to-Ethernet converter or Modbus
+// TCP. It is opened on first use and reopened after an error.
+type link struct {
+	addr string
+	baud int
+
+	mu   sync.Mutex
+	conn io.ReadWriteCloser
+}
+
+// do runs one exchange on the open stream, dropping the stream on error
+func (l *link) do(exchange func(rw io.ReadWriter) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		conn, err := l.open()
+		if err != nil {
+			return err
+		}
+		l.conn = conn
+	}
+	if err := exchange(l.conn); err != nil {
+		l.conn.Close()
+		l.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (l *link) open() (io.ReadWriteCloser, error) {
+	if hostPort, ok := strings.CutPrefix(l.addr, "tcp://"); ok {
+		return net.DialTimeout("tcp", hostPort, ioTimeout)
+	}
+	return serial.Open(l.addr, &serial.Mode{
+		BaudRate: l.baud,
+		DataBits: 8,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	})
+}
+
+func (l *link) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	err := l.conn.Close()
+	l.conn = nil
+	return err
+}
+
+func (l *link) String() string { return l.addr }
+
+// write sends b within ioTimeout
+func write(w io.Writer, b []byte) error {
+	if c, ok := w.(net.Conn); ok {
+		c.SetWriteDeadline(time.Now().Add(ioTimeout))
+		defer c.SetWriteDeadline(time.Time{})
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// readFull is io.ReadFull bounded by ioTimeout. Serial ports report a read
+// timeout as (0, nil), so they are polled with a short timeout instead.
+func readFull(r io.Reader, buf []byte) error {
+	deadline := time.Now().Add(ioTimeout)
+	switch s := r.(type) {
+	case net.Conn:
+		s.SetReadDeadline(deadline)
+		defer s.SetReadDeadline(time.Time{})
+		_, err := io.ReadFull(s, buf)
+		return err
+	case serial.Port:
+		s.SetReadTimeout(50 * time.Millisecond)
+		defer s.SetReadTimeout(serial.NoTimeout)
+	}
+	for n := 0; n < len(buf); {
+		if time.Now().After(deadline) {
+			return errNoResponse
+		}
+		m, err := r.Read(buf[n:])
+		if err != nil {
+			return err
+		}
+		n += m
+	}
+	return nil
+}
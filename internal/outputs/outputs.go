@@ -0,0 +1,108 @@
+// Package outputs drives relay boards at unattended lanes: barrier gates
+// and red/green traffic lights switched by station events (vehicle on the
+// scale, stable, transaction saved) according to OutputRule bindings.
+package outputs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"stoneweigh/internal/models"
+)
+
+// Drivers accepted in OutputDevice.Driver
+const (
+	DriverSerial    = "serial"     // USB/serial relay boards speaking the A0 protocol (LCUS)
+	DriverModbusRTU = "modbus_rtu" // Coils of a Modbus RTU relay module or PLC
+	DriverModbusTCP = "modbus_tcp" // Coils over Modbus TCP
+	DriverHTTP      = "http"       // Network relay modules switched by a GET request
+	DriverSim       = "sim"        // In-memory relays, for tests and demos
+)
+
+// Actions accepted in OutputRule.Action
+const (
+	ActionOn    = "on"
+	ActionOff   = "off"
+	ActionPulse = "pulse" // On, then off after PulseMs: barrier gate open impulse
+)
+
+// DefaultPulse is the pulse length of rules without PulseMs
+const DefaultPulse = time.Second
+
+// ioTimeout bounds a single switch command on any driver
+const ioTimeout = 2 * time.Second
+
+// Driver switches the channels of one relay device. Channels are 1-based.
+// Implementations are safe for concurrent use and reconnect on their own
+// after an I/O error.
+type Driver interface {
+	Set(channel int, on bool) error
+	Close() error
+	String() string
+}
+
+// NewDriver builds the driver of a device. Nothing is opened until the
+// first Set.
+func NewDriver(dev models.OutputDevice) (Driver, error) {
+	addr := strings.TrimSpace(dev.Address)
+	baud := dev.BaudRate
+	if baud == 0 {
+		baud = 9600
+	}
+	unit := dev.UnitID
+	if unit == 0 {
+		unit = 1
+	}
+	if unit < 0 || unit > 247 {
+		return nil, fmt.Errorf("invalid modbus unit id %d", dev.UnitID)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(dev.Driver)) {
+	case DriverSerial:
+		if addr == "" {
+			return nil, fmt.Errorf("serial relay needs a port")
+		}
+		return &serialRelay{link: link{addr: addr, baud: baud}}, nil
+	case DriverModbusRTU:
+		if addr == "" {
+			return nil, fmt.Errorf("modbus relay needs a port")
+		}
+		return &modbusRelay{link: link{addr: addr, baud: baud}, unit: byte(unit)}, nil
+	case DriverModbusTCP:
+		if addr == "" {
+			return nil, fmt.Errorf("modbus relay needs an address")
+		}
+		if !strings.Contains(addr, "://") {
+			addr = "tcp://" + addr
+		}
+		return &modbusRelay{link: link{addr: addr}, unit: byte(unit), tcp: true}, nil
+	case DriverHTTP:
+		return newHTTPRelay(addr)
+	case DriverSim:
+		return NewSimulated(), nil
+	default:
+		return nil, fmt.Errorf("unknown output driver %q", dev.Driver)
+	}
+}
+
+// ValidateRule checks a rule before saving
+func ValidateRule(rule models.OutputRule) error {
+	switch rule.Event {
+	case EventOccupied, EventVacant, EventStable, EventMoving, EventSaved:
+	default:
+		return fmt.Errorf("unknown event %q", rule.Event)
+	}
+	switch rule.Action {
+	case ActionOn, ActionOff, ActionPulse:
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	if rule.Channel < 1 {
+		return fmt.Errorf("invalid channel %d", rule.Channel)
+	}
+	if rule.PulseMs < 0 {
+		return fmt.Errorf("invalid pulse length %d ms", rule.PulseMs)
+	}
+	return nil
+}
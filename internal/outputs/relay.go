@@ -0,0 +1,166 @@
+package outputs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"stoneweigh/internal/hardware"
+)
+
+var errNoResponse = errors.New("relay: no response")
+
+// serialRelay drives the common USB/serial relay boards (LCUS-1/2/4/8 and
+// clones): every command is A0, channel, state, checksum, without answer
+type serialRelay struct {
+	link
+}
+
+func (r *serialRelay) Set(channel int, on bool) error {
+	if channel < 1 || channel > 255 {
+		return fmt.Errorf("invalid relay channel %d", channel)
+	}
+	var state byte
+	if on {
+		state = 1
+	}
+	cmd := []byte{0xA0, byte(channel), state, 0}
+	cmd[3] = cmd[0] + cmd[1] + cmd[2]
+	return r.do(func(rw io.ReadWriter) error { return write(rw, cmd) })
+}
+
+const modbusWriteCoil = 0x05
+
+// modbusRelay switches coils (channel 1 is coil 0) with Write Single Coil,
+// over Modbus RTU or Modbus TCP
+type modbusRelay struct {
+	link
+	unit byte
+	tcp  bool
+	txID uint16
+}
+
+func (r *modbusRelay) Set(channel int, on bool) error {
+	if channel < 1 || channel > 0x10000 {
+		return fmt.Errorf("invalid coil %d", channel)
+	}
+	pdu := []byte{modbusWriteCoil, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(pdu[1:], uint16(channel-1))
+	if on {
+		pdu[3] = 0xFF
+	}
+	return r.do(func(rw io.ReadWriter) error {
+		if r.tcp {
+			return r.exchangeTCP(rw, pdu)
+		}
+		return r.exchangeRTU(rw, pdu)
+	})
+}
+
+// exchangeRTU sends the request and checks the echo the device answers with
+func (r *modbusRelay) exchangeRTU(rw io.ReadWriter, pdu []byte) error {
+	req := append([]byte{r.unit}, pdu...)
+	req = binary.LittleEndian.AppendUint16(req, hardware.ModbusCRC(req))
+	if err := write(rw, req); err != nil {
+		return err
+	}
+	resp := make([]byte, 5) // Exception answers are 5 bytes, echoes 8
+	if err := readFull(rw, resp); err != nil {
+		return err
+	}
+	if resp[1] == modbusWriteCoil|0x80 {
+		return fmt.Errorf("modbus exception %d", resp[2])
+	}
+	rest := make([]byte, 3)
+	if err := readFull(rw, rest); err != nil {
+		return err
+	}
+	if !bytes.Equal(append(resp, rest...), req) {
+		return errors.New("modbus: unexpected answer")
+	}
+	return nil
+}
+
+func (r *modbusRelay) exchangeTCP(rw io.ReadWriter, pdu []byte) error {
+	r.txID++
+	req := make([]byte, 7, 7+len(pdu))
+	binary.BigEndian.PutUint16(req[0:], r.txID)
+	binary.BigEndian.PutUint16(req[4:], uint16(len(pdu)+1))
+	req[6] = r.unit
+	req = append(req, pdu...)
+	if err := write(rw, req); err != nil {
+		return err
+	}
+	mbap := make([]byte, 7)
+	if err := readFull(rw, mbap); err != nil {
+		return err
+	}
+	length := int(binary.BigEndian.Uint16(mbap[4:]))
+	if length < 3 || length > 254 {
+		return fmt.Errorf("modbus: invalid length %d", length)
+	}
+	body := make([]byte, length-1)
+	if err := readFull(rw, body); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint16(mbap) != r.txID {
+		return errors.New("modbus: answer to another request")
+	}
+	if body[0] == modbusWriteCoil|0x80 {
+		return fmt.Errorf("modbus exception %d", body[1])
+	}
+	if !bytes.Equal(body, pdu) {
+		return errors.New("modbus: unexpected answer")
+	}
+	return nil
+}
+
+// httpRelay switches network relay modules with a GET request built from a
+// URL template: {channel} is the 1-based channel, {index} the 0-based one,
+// {state} "on"/"off" and {value} "1"/"0", e.g.
+// http://10.0.0.20/relay/{index}?turn={state}
+type httpRelay struct {
+	template string
+	client   *http.Client
+}
+
+func newHTTPRelay(template string) (*httpRelay, error) {
+	u, err := url.Parse(template)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid relay URL %q", template)
+	}
+	return &httpRelay{template: template, client: &http.Client{Timeout: ioTimeout}}, nil
+}
+
+func (r *httpRelay) Set(channel int, on bool) error {
+	state, value := "off", "0"
+	if on {
+		state, value = "on", "1"
+	}
+	target := strings.NewReplacer(
+		"{channel}", strconv.Itoa(channel),
+		"{index}", strconv.Itoa(channel-1),
+		"{state}", state,
+		"{value}", value,
+	).Replace(r.template)
+
+	resp, err := r.client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("relay answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (r *httpRelay) Close() error   { return nil }
+func (r *httpRelay) String() string { return r.template }
@@ -0,0 +1,142 @@
+package outputs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"stoneweigh/internal/hardware"
+	"stoneweigh/internal/models"
+)
+
+// fakeDevice accepts one connection and answers every request of size n
+// with respond
+func fakeDevice(t *testing.T, n int, respond func(req []byte) []byte) (string, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	requests := make(chan []byte, 16)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			req := make([]byte, n)
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			requests <- req
+			if respond != nil {
+				conn.Write(respond(req))
+			}
+		}
+	}()
+	return ln.Addr().String(), requests
+}
+
+func TestSerialRelay(t *testing.T) {
+	addr, requests := fakeDevice(t, 4, nil)
+	d, err := NewDriver(models.OutputDevice{Driver: DriverSerial, Address: "tcp://" + addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if err := d.Set(2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set(2, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range [][]byte{{0xA0, 2, 1, 0xA3}, {0xA0, 2, 0, 0xA2}} {
+		if got := <-requests; !bytes.Equal(got, want) {
+			t.Errorf("command % X, want % X", got, want)
+		}
+	}
+}
+
+func TestModbusTCPRelay(t *testing.T) {
+	addr, requests := fakeDevice(t, 12, func(req []byte) []byte {
+		if req[9] == 9 { // Coil 10 does not exist
+			resp := append([]byte(nil), req[:9]...)
+			binary.BigEndian.PutUint16(resp[4:], 3)
+			resp[7] = modbusWriteCoil | 0x80
+			resp[8] = 2
+			return resp
+		}
+		return req // Write Single Coil answers with an echo
+	})
+	d, err := NewDriver(models.OutputDevice{Driver: DriverModbusTCP, Address: addr, UnitID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if err := d.Set(4, true); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if req[6] != 3 || !bytes.Equal(req[7:], []byte{0x05, 0x00, 0x03, 0xFF, 0x00}) {
+		t.Errorf("request % X", req)
+	}
+	if err := d.Set(10, true); err == nil {
+		t.Error("exception not reported")
+	}
+}
+
+func TestModbusRTURelay(t *testing.T) {
+	addr, requests := fakeDevice(t, 8, func(req []byte) []byte { return req })
+	d, err := NewDriver(models.OutputDevice{Driver: DriverModbusRTU, Address: "tcp://" + addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if err := d.Set(1, false); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if !bytes.Equal(req[:6], []byte{0x01, 0x05, 0x00, 0x00, 0x00, 0x00}) ||
+		binary.LittleEndian.Uint16(req[6:]) != hardware.ModbusCRC(req[:6]) {
+		t.Errorf("request % X", req)
+	}
+}
+
+func TestHTTPRelay(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		if r.URL.Path == "/relay/7" {
+			http.Error(w, "no such relay", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	d, err := NewDriver(models.OutputDevice{Driver: DriverHTTP, Address: srv.URL + "/relay/{index}?turn={state}&ch={channel}&v={value}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set(8, false); err == nil {
+		t.Error("HTTP error not reported")
+	}
+	want := []string{"/relay/0?turn=on&ch=1&v=1", "/relay/7?turn=off&ch=8&v=0"}
+	if len(paths) != 2 || paths[0] != want[0] || paths[1] != want[1] {
+		t.Errorf("requests %v, want %v", paths, want)
+	}
+
+	if _, err := NewDriver(models.OutputDevice{Driver: DriverHTTP, Address: "10.0.0.5/relay"}); err == nil {
+		t.Error("URL without scheme accepted")
+	}
+}
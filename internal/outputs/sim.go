@@ -0,0 +1,66 @@
+package outputs
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Switch is one command received by a simulated device
+type Switch struct {
+	Channel int
+	On      bool
+	At      time.Time
+}
+
+// Simulated is a relay device in memory: it records every command, for
+// tests and for demo installations without relay hardware
+type Simulated struct {
+	mu      sync.Mutex
+	state   map[int]bool
+	log     []Switch
+	failing error
+}
+
+// NewSimulated creates a simulated device with every channel off
+func NewSimulated() *Simulated {
+	return &Simulated{state: make(map[int]bool)}
+}
+
+func (s *Simulated) Set(channel int, on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing != nil {
+		return s.failing
+	}
+	if channel < 1 {
+		return errors.New("invalid channel")
+	}
+	s.state[channel] = on
+	s.log = append(s.log, Switch{Channel: channel, On: on, At: time.Now()})
+	return nil
+}
+
+// State reports whether a channel is on
+func (s *Simulated) State(channel int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state[channel]
+}
+
+// Log returns the commands received so far, oldest first
+func (s *Simulated) Log() []Switch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Switch(nil), s.log...)
+}
+
+// Fail makes every following Set return err, nil restores the device
+func (s *Simulated) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = err
+}
+
+func (s *Simulated) Close() error   { return nil }
+func (s *Simulated) String() string { return "sim" }
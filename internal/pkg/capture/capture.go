@@ -0,0 +1,85 @@
+package capture
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("capture token tidak valid")
+	ErrExpired      = errors.New("capture token sudah kedaluwarsa")
+)
+
+// Capture is a scale reading frozen by the server at capture time
+type Capture struct {
+	ID         string    `json:"id"` // Random nonce, stored on the record to prevent reuse
+	ScaleID    uint      `json:"scale_id"`
+	Weight     float64   `json:"weight"`
+	Unit       string    `json:"unit,omitempty"`
+	Stable     bool      `json:"stable"`
+	Axles      []float64 `json:"axles,omitempty"` // Axle weighing stations: the axles Weight sums up
+	CapturedBy string    `json:"captured_by"`
+	CapturedAt int64     `json:"captured_at"`
+	ExpiresAt  int64     `json:"expires_at"`
+}
+
+// Signer issues and verifies HMAC signed capture tokens
+type Signer struct {
+	secret []byte
+	TTL    time.Duration
+}
+
+func NewSigner(secret string, ttl time.Duration) *Signer {
+	return &Signer{secret: []byte(secret), TTL: ttl}
+}
+
+// Issue fills in ID and timestamps and returns the signed token
+func (s *Signer) Issue(c Capture, now time.Time) (string, Capture, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", Capture{}, err
+	}
+	c.ID = hex.EncodeToString(nonce)
+	c.CapturedAt = now.Unix()
+	c.ExpiresAt = now.Add(s.TTL).Unix()
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", Capture{}, err
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + s.sign(body), c, nil
+}
+
+// Verify checks the signature and expiry and returns the frozen reading
+func (s *Signer) Verify(token string, now time.Time) (Capture, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(body))) {
+		return Capture{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return Capture{}, ErrInvalidToken
+	}
+	var c Capture
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return Capture{}, ErrInvalidToken
+	}
+	if now.Unix() > c.ExpiresAt {
+		return Capture{}, ErrExpired
+	}
+	return c, nil
+}
+
+func (s *Signer) sign(body string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
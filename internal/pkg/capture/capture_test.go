@@ -0,0 +1,43 @@
+package capture
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	signer := NewSigner("test-secret", time.Minute)
+	now := time.Unix(1700000000, 0)
+
+	token, issued, err := signer.Issue(Capture{ScaleID: 2, Weight: 24510, Stable: true, Axles: []float64{6010, 9250, 9250}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued.ID == "" || issued.ExpiresAt != now.Add(time.Minute).Unix() {
+		t.Fatalf("unexpected capture %+v", issued)
+	}
+
+	got, err := signer.Verify(token, now.Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, issued) {
+		t.Errorf("got %+v, want %+v", got, issued)
+	}
+
+	if _, err := signer.Verify(token, now.Add(2*time.Minute)); err != ErrExpired {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+	if _, err := NewSigner("other-secret", time.Minute).Verify(token, now); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for foreign secret, got %v", err)
+	}
+
+	// Tampering with the payload must break the signature
+	body, sig, _ := strings.Cut(token, ".")
+	tampered := body[:len(body)-2] + "xx." + sig
+	if _, err := signer.Verify(tampered, now); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for tampered token, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Package hub is an in-process publish/subscribe fan-out.
+//
+// Every subscriber gets its own buffered channel. When a subscriber falls
+// behind, the oldest queued value is dropped to make room, so a slow
+// consumer (a stalled browser tab, a webhook retrying) never blocks the
+// publisher or the other subscribers.
+package hub
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuffer is the per-subscriber queue length used by Subscribe(0)
+const DefaultBuffer = 64
+
+// Hub fans out published values of type T to all current subscribers
+type Hub[T any] struct {
+	mu   sync.Mutex
+	subs map[*Subscription[T]]struct{}
+}
+
+// New creates an empty hub
+func New[T any]() *Hub[T] {
+	return &Hub[T]{subs: make(map[*Subscription[T]]struct{})}
+}
+
+// Subscription is one consumer's view of the hub
+type Subscription[T any] struct {
+	// C delivers published values; it is closed by Close
+	C <-chan T
+
+	ch      chan T
+	hub     *Hub[T]
+	dropped atomic.Uint64
+}
+
+// Subscribe registers a consumer with a queue of buffer values
+// (DefaultBuffer if buffer <= 0). Call Close when done.
+func (h *Hub[T]) Subscribe(buffer int) *Subscription[T] {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	ch := make(chan T, buffer)
+	sub := &Subscription[T]{C: ch, ch: ch, hub: h}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Publish delivers v to every subscriber without blocking
+func (h *Hub[T]) Publish(v T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		for {
+			select {
+			case sub.ch <- v:
+			default:
+				// Full: drop the oldest value and try again
+				select {
+				case <-sub.ch:
+					sub.dropped.Add(1)
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+// Len returns the number of active subscribers
+func (h *Hub[T]) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Close unsubscribes and closes C. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		close(s.ch)
+	}
+}
+
+// Dropped returns how many values were discarded because the queue was full
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
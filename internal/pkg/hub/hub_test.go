@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFanOut(t *testing.T) {
+	h := New[int]()
+	a := h.Subscribe(4)
+	b := h.Subscribe(4)
+	defer a.Close()
+	defer b.Close()
+
+	h.Publish(1)
+	h.Publish(2)
+
+	for _, sub := range []*Subscription[int]{a, b} {
+		if got := <-sub.C; got != 1 {
+			t.Errorf("got %d, want 1", got)
+		}
+		if got := <-sub.C; got != 2 {
+			t.Errorf("got %d, want 2", got)
+		}
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	h := New[int]()
+	slow := h.Subscribe(3)
+	defer slow.Close()
+
+	// Nobody reads: the publisher must never block
+	for i := 1; i <= 10; i++ {
+		h.Publish(i)
+	}
+
+	var got []int
+	for len(slow.C) > 0 {
+		got = append(got, <-slow.C)
+	}
+	if len(got) != 3 || got[0] != 8 || got[2] != 10 {
+		t.Errorf("got %v, want the 3 newest values", got)
+	}
+	if slow.Dropped() != 7 {
+		t.Errorf("dropped %d, want 7", slow.Dropped())
+	}
+}
+
+func TestCloseWhilePublishing(t *testing.T) {
+	h := New[int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := h.Subscribe(1)
+			h.Publish(i)
+			sub.Close()
+			sub.Close()
+			if _, open := <-sub.C; open {
+				// Drain what was queued before Close
+				for range sub.C {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if h.Len() != 0 {
+		t.Errorf("%d subscribers left", h.Len())
+	}
+}
@@ -0,0 +1,67 @@
+// Package odol checks vehicle loads against their permitted gross weight
+// (JBI, Jumlah Berat yang Diizinkan) for over-dimension/over-load enforcement.
+package odol
+
+import "math"
+
+// Defaults used when the thresholds are not configured
+const (
+	DefaultApprovalPercent = 5.0 // Common enforcement tolerance
+	DefaultBlockPercent    = 0.0 // Never block, approvals only
+)
+
+// Verdict is the outcome of an overload check
+type Verdict int
+
+const (
+	Allowed       Verdict = iota // Within the permitted gross weight or its tolerance
+	NeedsApproval                // A supervisor must approve the ticket
+	Blocked                      // The ticket must not be issued
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case NeedsApproval:
+		return "needs_approval"
+	case Blocked:
+		return "blocked"
+	}
+	return "allowed"
+}
+
+// Policy holds the overload thresholds, in percent above the permitted
+// gross weight. A zero BlockPercent disables blocking.
+type Policy struct {
+	ApprovalPercent float64
+	BlockPercent    float64
+}
+
+func NewPolicy(approvalPercent, blockPercent float64) Policy {
+	if approvalPercent < 0 {
+		approvalPercent = DefaultApprovalPercent
+	}
+	if blockPercent < 0 {
+		blockPercent = DefaultBlockPercent
+	}
+	return Policy{ApprovalPercent: approvalPercent, BlockPercent: blockPercent}
+}
+
+// Percent returns how far gross exceeds permitted, in percent rounded to
+// two decimals. It is 0 within the limit or when no limit is known.
+func Percent(gross, permitted float64) float64 {
+	if permitted <= 0 || gross <= permitted {
+		return 0
+	}
+	return math.Round((gross-permitted)/permitted*10000) / 100
+}
+
+// Check classifies an overload percentage
+func (p Policy) Check(percent float64) Verdict {
+	switch {
+	case p.BlockPercent > 0 && percent > p.BlockPercent:
+		return Blocked
+	case percent > p.ApprovalPercent:
+		return NeedsApproval
+	}
+	return Allowed
+}
@@ -0,0 +1,42 @@
+package odol
+
+import "testing"
+
+func TestPercent(t *testing.T) {
+	cases := []struct {
+		gross, permitted, want float64
+	}{
+		{24000, 24000, 0},
+		{20000, 24000, 0},
+		{30000, 24000, 25},
+		{24100, 24000, 0.42},
+		{30000, 0, 0}, // Unknown limit
+	}
+	for _, c := range cases {
+		if got := Percent(c.gross, c.permitted); got != c.want {
+			t.Errorf("Percent(%v, %v) = %v, want %v", c.gross, c.permitted, got, c.want)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := NewPolicy(5, 50)
+	for percent, want := range map[float64]Verdict{
+		0:    Allowed,
+		5:    Allowed,
+		5.01: NeedsApproval,
+		50:   NeedsApproval,
+		60:   Blocked,
+	} {
+		if got := p.Check(percent); got != want {
+			t.Errorf("Check(%v) = %v, want %v", percent, got, want)
+		}
+	}
+
+	if got := NewPolicy(5, 0).Check(500); got != NeedsApproval {
+		t.Errorf("blocking disabled: got %v", got)
+	}
+	if got := NewPolicy(-1, -1); got.ApprovalPercent != DefaultApprovalPercent || got.BlockPercent != DefaultBlockPercent {
+		t.Errorf("defaults: %+v", got)
+	}
+}
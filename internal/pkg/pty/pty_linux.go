@@ -0,0 +1,85 @@
+// Package pty allocates pseudo-terminal pairs, so tools and tests can
+// stand in for a serial device on machines without RS232 hardware.
+package pty
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Open allocates a pseudo-terminal in raw mode. The master side is where
+// the emulated device talks; the slave's Name() (/dev/pts/N) is opened by
+// serial programs like any /dev/ttyUSB0. The slave is returned open so
+// the master keeps working while clients come and go. Close both when done.
+func Open() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var n uint32
+	err = control(master, func(fd uintptr) error {
+		var unlock int32
+		if err := ioctl(fd, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+			return err
+		}
+		return ioctl(fd, syscall.TIOCGPTN, unsafe.Pointer(&n))
+	})
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("pty: %w", err)
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	// Raw from the start: no echo of what the device sends, no CR/LF mangling
+	if err := control(slave, makeRaw); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, fmt.Errorf("pty: %w", err)
+	}
+	return master, slave, nil
+}
+
+// control runs fn on the descriptor without switching the file to
+// blocking mode, as File.Fd would; deadlines keep working.
+func control(f *os.File, fn func(fd uintptr) error) error {
+	raw, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := raw.Control(func(fd uintptr) { ferr = fn(fd) }); err != nil {
+		return err
+	}
+	return ferr
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw applies the cfmakeraw(3) settings
+func makeRaw(fd uintptr) error {
+	var t syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&t)); err != nil {
+		return err
+	}
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	return ioctl(fd, syscall.TCSETS, unsafe.Pointer(&t))
+}
@@ -0,0 +1,45 @@
+package pty
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	master, slave, err := Open()
+	if err != nil {
+		t.Skipf("no pty available: %v", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	// A second client opens the device by name, like a serial port
+	client, err := os.OpenFile(slave.Name(), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	master.Write([]byte("ST,GS,+0001234kg\r\n"))
+	buf := make([]byte, 64)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Raw mode: CR must not be turned into LF
+	if got := string(buf[:n]); got != "ST,GS,+0001234kg\r\n" {
+		t.Errorf("client read %q", got)
+	}
+
+	client.Write([]byte("Z\r\n"))
+	master.SetReadDeadline(time.Now().Add(time.Second))
+	n, err = master.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "Z\r\n" {
+		t.Errorf("master read %q", got)
+	}
+}
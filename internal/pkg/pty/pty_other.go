@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pty
+
+import (
+	"errors"
+	"os"
+)
+
+// Open is only implemented on Linux
+func Open() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("pty: pseudo-terminals are only supported on Linux")
+}
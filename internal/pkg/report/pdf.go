@@ -25,7 +25,7 @@ func GenerateTicketPDF(txn models.WeighingRecord) (string, error) {
 	pdf.Ln(8)
 	pdf.Cell(0, 10, fmt.Sprintf("Driver: %s", txn.DriverName))
 	pdf.Ln(8)
-	pdf.Cell(0, 10, fmt.Sprintf("Net Weight: %.2f Kg", txn.NetWeight))
+	pdf.Cell(0, 10, "Net Weight: "+txn.FormatWeight(txn.NetWeight))
 
 	// Ensure directory exists
 	os.MkdirAll("web/static/reports", 0755)
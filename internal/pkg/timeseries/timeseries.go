@@ -0,0 +1,68 @@
+// Package timeseries thins a stream of scale readings down to the samples
+// worth storing: a reading is kept when it differs from the last kept one,
+// and a flat line is still confirmed now and then by a heartbeat.
+package timeseries
+
+import (
+	"math"
+	"time"
+)
+
+// Defaults used when a Downsampler field is zero
+const (
+	DefaultMinInterval = 500 * time.Millisecond
+	DefaultHeartbeat   = time.Minute
+)
+
+// Sample is one stored point of a station's weight curve
+type Sample struct {
+	StationID uint
+	At        time.Time
+	Weight    float64
+	Stable    bool
+	Connected bool
+}
+
+// Downsampler decides per station which readings to keep. It is not safe
+// for concurrent use.
+type Downsampler struct {
+	Step        float64       // Smallest weight change worth a sample; 0 keeps every change
+	MinInterval time.Duration // Fastest sample rate while the weight moves
+	Heartbeat   time.Duration // Longest gap between samples of a flat line
+
+	last map[uint]Sample
+}
+
+// Keep reports whether s should be stored and, if so, remembers it as the
+// station's last sample. Changes of the stable or connected state are always
+// kept so the curve shows exactly when a reading settled or the link dropped.
+func (d *Downsampler) Keep(s Sample) bool {
+	if d.last == nil {
+		d.last = make(map[uint]Sample)
+	}
+	minInterval, heartbeat := d.MinInterval, d.Heartbeat
+	if minInterval <= 0 {
+		minInterval = DefaultMinInterval
+	}
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+
+	last, seen := d.last[s.StationID]
+	elapsed := s.At.Sub(last.At)
+	keep := !seen ||
+		s.Stable != last.Stable || s.Connected != last.Connected ||
+		elapsed >= heartbeat ||
+		(elapsed >= minInterval && changed(s.Weight, last.Weight, d.Step))
+	if keep {
+		d.last[s.StationID] = s
+	}
+	return keep
+}
+
+func changed(a, b, step float64) bool {
+	if step <= 0 {
+		return a != b
+	}
+	return math.Abs(a-b) >= step
+}
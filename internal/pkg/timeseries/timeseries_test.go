@@ -0,0 +1,45 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDownsampler(t *testing.T) {
+	d := Downsampler{Step: 10, MinInterval: time.Second, Heartbeat: time.Minute}
+	t0 := time.Unix(1700000000, 0)
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+
+	cases := []struct {
+		name string
+		s    Sample
+		keep bool
+	}{
+		{"first reading", Sample{StationID: 1, At: at(0), Weight: 0, Connected: true}, true},
+		{"other station", Sample{StationID: 2, At: at(0), Weight: 500, Connected: true}, true},
+		{"below step", Sample{StationID: 1, At: at(2000), Weight: 5, Connected: true}, false},
+		{"too soon", Sample{StationID: 1, At: at(500), Weight: 800, Connected: true}, false},
+		{"moved", Sample{StationID: 1, At: at(1000), Weight: 800, Connected: true}, true},
+		{"settled", Sample{StationID: 1, At: at(1200), Weight: 805, Stable: true, Connected: true}, true},
+		{"flat", Sample{StationID: 1, At: at(30000), Weight: 805, Stable: true, Connected: true}, false},
+		{"heartbeat", Sample{StationID: 1, At: at(61200), Weight: 805, Stable: true, Connected: true}, true},
+		{"link lost", Sample{StationID: 1, At: at(61300), Weight: 805, Stable: true}, true},
+	}
+	for _, tc := range cases {
+		if got := d.Keep(tc.s); got != tc.keep {
+			t.Errorf("%s: Keep = %v, want %v", tc.name, got, tc.keep)
+		}
+	}
+}
+
+func TestDownsamplerEveryChange(t *testing.T) {
+	var d Downsampler
+	t0 := time.Unix(1700000000, 0)
+	d.Keep(Sample{StationID: 1, At: t0, Weight: 100})
+	if !d.Keep(Sample{StationID: 1, At: t0.Add(DefaultMinInterval), Weight: 101}) {
+		t.Error("with no step every change past the interval is kept")
+	}
+	if d.Keep(Sample{StationID: 1, At: t0.Add(2 * DefaultMinInterval), Weight: 101}) {
+		t.Error("an unchanged reading is not kept")
+	}
+}
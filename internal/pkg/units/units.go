@@ -0,0 +1,126 @@
+// Package units converts weights between the units indicators report and
+// kilograms, the unit every weight is stored and compared in, and formats
+// them in a station's display unit and division.
+package units
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Supported units. Kilogram is canonical.
+const (
+	Kilogram = "kg"
+	Tonne    = "t"
+	Pound    = "lb"
+	Gram     = "g"
+)
+
+// perKg is how many of each unit make one kilogram
+var perKg = map[string]float64{
+	Kilogram: 1,
+	Tonne:    0.001,
+	Pound:    1 / 0.45359237,
+	Gram:     1000,
+}
+
+// aliases maps the spellings indicators and users send to a unit
+var aliases = map[string]string{
+	"kg": Kilogram, "kgs": Kilogram, "kilogram": Kilogram,
+	"t": Tonne, "ton": Tonne, "tons": Tonne, "tonne": Tonne,
+	"lb": Pound, "lbs": Pound, "pound": Pound,
+	"g": Gram, "gr": Gram, "gram": Gram,
+}
+
+// Parse returns the unit named by s, case-insensitively. Empty means
+// Kilogram.
+func Parse(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return Kilogram, nil
+	}
+	if u, ok := aliases[s]; ok {
+		return u, nil
+	}
+	return "", fmt.Errorf("unknown unit %q", s)
+}
+
+// ToKg converts v from unit to kilograms. Unknown units are taken as
+// kilograms.
+func ToKg(v float64, unit string) float64 {
+	if f, ok := perKg[unit]; ok {
+		return v / f
+	}
+	return v
+}
+
+// FromKg converts kg to unit. Unknown units are taken as kilograms.
+func FromKg(kg float64, unit string) float64 {
+	if f, ok := perKg[unit]; ok {
+		return kg * f
+	}
+	return kg
+}
+
+// Decimals is the number of decimals a value rounded to division has,
+// e.g. 0 for 10 and 2 for 0.05. Without a division it is the usual
+// resolution of the unit.
+func Decimals(unit string, division float64) int {
+	if division <= 0 {
+		switch unit {
+		case Tonne:
+			return 3
+		default:
+			return 0
+		}
+	}
+	s := strconv.FormatFloat(division, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// Round rounds v to the nearest multiple of division, both in the same
+// unit. A zero division leaves v as is.
+func Round(v, division float64) float64 {
+	if division <= 0 {
+		return v
+	}
+	r := math.Round(v/division) * division
+	// Drop the float noise of the multiplication, 0.1*3 is 0.3
+	p := math.Pow(10, float64(Decimals("", division)))
+	return math.Round(r*p) / p
+}
+
+// Normalize converts a reading v in unit to kilograms, rounded to the
+// division of a station displaying display. A weight normalized twice does
+// not change.
+func Normalize(v float64, unit, display string, division float64) float64 {
+	kg := ToKg(v, unit)
+	if division <= 0 {
+		return kg
+	}
+	return ToKg(Round(FromKg(kg, display), division), display)
+}
+
+// Value formats kg in unit, rounded to division, without the unit
+func Value(kg float64, unit string, division float64) string {
+	decimals := Decimals(unit, division)
+	p := math.Pow(10, float64(decimals))
+	v := math.Round(Round(FromKg(kg, unit), division)*p) / p
+	if v == 0 {
+		v = 0 // No "-0" for a small negative reading
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+// Format is Value followed by the unit, e.g. "12.34 t"
+func Format(kg float64, unit string, division float64) string {
+	if _, ok := perKg[unit]; !ok {
+		unit = Kilogram
+	}
+	return Value(kg, unit, division) + " " + unit
+}
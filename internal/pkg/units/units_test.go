@@ -0,0 +1,68 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]string{"": Kilogram, " KG": Kilogram, "ton": Tonne, "t": Tonne, "LBS": Pound, "g": Gram} {
+		if got, err := Parse(in); err != nil || got != want {
+			t.Errorf("Parse(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := Parse("pcs"); err == nil {
+		t.Error("counting mode accepted as a weight unit")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		v              float64
+		unit, display  string
+		division, want float64
+	}{
+		{12345, Kilogram, Kilogram, 0, 12345},
+		{12345, Kilogram, Kilogram, 10, 12350},
+		{12344, Kilogram, Kilogram, 20, 12340},
+		{12.345, Tonne, Kilogram, 0, 12345},
+		{12345, Kilogram, Tonne, 0.01, 12350}, // 10 kg steps
+		{-14, Kilogram, Kilogram, 10, -10},
+		{1000, Pound, Pound, 0, 453.59237},
+		{1015, Pound, Pound, 20, 1020 * 0.45359237},
+	}
+	for _, c := range cases {
+		got := Normalize(c.v, c.unit, c.display, c.division)
+		if math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("Normalize(%v %s, %s/%v) = %v, want %v", c.v, c.unit, c.display, c.division, got, c.want)
+		}
+		// Rounding is stable: capture, records and display agree
+		if again := Normalize(got, Kilogram, c.display, c.division); math.Abs(again-got) > 1e-9 {
+			t.Errorf("Normalize not idempotent: %v then %v", got, again)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		kg       float64
+		unit     string
+		division float64
+		want     string
+	}{
+		{12345, Kilogram, 0, "12345 kg"},
+		{12345.4, Kilogram, 0, "12345 kg"},
+		{12345, Kilogram, 20, "12340 kg"},
+		{12345, Tonne, 0, "12.345 t"},
+		{12345, Tonne, 0.01, "12.35 t"},
+		{12345, Tonne, 0.05, "12.35 t"},
+		{1020 * 0.45359237, Pound, 20, "1020 lb"},
+		{-0.3, Kilogram, 0, "0 kg"},
+		{500, "", 0, "500 kg"},
+	}
+	for _, c := range cases {
+		if got := Format(c.kg, c.unit, c.division); got != c.want {
+			t.Errorf("Format(%v, %s, %v) = %q, want %q", c.kg, c.unit, c.division, got, c.want)
+		}
+	}
+}
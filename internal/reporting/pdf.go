@@ -8,6 +8,7 @@ import (
 
 	"github.com/jung-kurt/gofpdf"
 	"stoneweigh/internal/models"
+	"stoneweigh/internal/pkg/units"
 )
 
 // dateToIndonesian formats time to "02 Januari 2006"
@@ -146,9 +147,18 @@ func GenerateInvoice(record models.WeighingRecord) (string, error) {
 	pdf.Ln(15)
 
 	// --- Weight Table ---
+	// Weights are stored in kg, shown in the unit and division of the station
+	unit := record.Unit
+	if unit == "" {
+		unit = units.Kilogram
+	}
+	weight := func(kg float64) string {
+		return units.Value(kg, unit, record.Division)
+	}
+
 	pdf.SetFont("Arial", "B", 12)
 	pdf.SetTextColor(25, 109, 236)
-	pdf.Cell(0, 10, "DATA PENIMBANGAN (Kg)")
+	pdf.Cell(0, 10, fmt.Sprintf("DATA PENIMBANGAN (%s)", unit))
 	pdf.Ln(10)
 
 	// Table Header
@@ -167,18 +177,9 @@ func GenerateInvoice(record models.WeighingRecord) (string, error) {
 	pdf.SetTextColor(51, 51, 51)
 	pdf.SetFont("Courier", "B", 14)
 
-	grossStr := fmt.Sprintf("%.0f", record.GrossWeight)
-	if record.GrossWeight == 0 {
-		grossStr = "0"
-	}
-	tareStr := fmt.Sprintf("%.0f", record.TareWeight)
-	if record.TareWeight == 0 {
-		tareStr = "0"
-	}
-	netStr := fmt.Sprintf("%.0f", record.NetWeight)
-	if record.NetWeight == 0 {
-		netStr = "0"
-	}
+	grossStr := weight(record.GrossWeight)
+	tareStr := weight(record.TareWeight)
+	netStr := weight(record.NetWeight)
 
 	// Gross
 	pdf.CellFormat(63, 15, grossStr, "1", 0, "C", false, 0, "")
@@ -188,15 +189,38 @@ func GenerateInvoice(record models.WeighingRecord) (string, error) {
 	pdf.SetTextColor(0, 150, 0)
 	pdf.CellFormat(64, 15, netStr, "1", 1, "C", false, 0, "")
 
-	// --- Signatures ---
+	// --- Overload (ODOL) ---
+	sigHeight := 50.0
+	gap := 25.0
+	if record.OverloadPercent > 0 {
+		note := fmt.Sprintf("KELEBIHAN MUATAN %.2f%% di atas JBI %s", record.OverloadPercent, record.FormatWeight(record.PermittedGross))
+		if record.OverloadApprovedBy != "" {
+			note += " - disetujui oleh " + record.OverloadApprovedBy
+		}
+		pdf.Ln(2)
+		pdf.SetFont("Arial", "B", 10)
+		pdf.SetTextColor(200, 0, 0)
+		pdf.CellFormat(190, 7, note, "", 1, "L", false, 0, "")
+		sigHeight, gap = 42, 16
+	}
+
+	// --- Axle Breakdown (axle weighing stations) ---
 	pdf.SetTextColor(51, 51, 51)
-	pdf.Ln(25)
+	if len(record.Axles) > 0 {
+		printAxleTable(pdf, record.Axles, unit, weight)
+		// Keep the signatures above the footer
+		sigHeight = min(sigHeight, 32)
+		pdf.Ln(6)
+	} else {
+		pdf.Ln(gap)
+	}
 
+	// --- Signatures ---
 	ySig := pdf.GetY()
 
 	// Box for signatures
 	pdf.SetDrawColor(230, 230, 230)
-	pdf.Rect(10, ySig, 190, 50, "D")
+	pdf.Rect(10, ySig, 190, sigHeight, "D")
 
 	// Driver Sig
 	pdf.SetY(ySig + 5)
@@ -209,7 +233,7 @@ func GenerateInvoice(record models.WeighingRecord) (string, error) {
 	pdf.Cell(80, 5, "Diterima Oleh (Pengelola),")
 
 	// Names
-	pdf.SetY(ySig + 40)
+	pdf.SetY(ySig + sigHeight - 10)
 	pdf.SetFont("Arial", "B", 10)
 
 	driverSig := record.DriverName
@@ -218,11 +242,11 @@ func GenerateInvoice(record models.WeighingRecord) (string, error) {
 	}
 	pdf.SetX(20)
 	pdf.Cell(80, 5, "( "+driverSig+" )")
-	pdf.Line(20, ySig+45, 80, ySig+45)
+	pdf.Line(20, ySig+sigHeight-5, 80, ySig+sigHeight-5)
 
 	pdf.SetX(120)
 	pdf.Cell(80, 5, "( "+record.ManagerName+" )")
-	pdf.Line(120, ySig+45, 180, ySig+45)
+	pdf.Line(120, ySig+sigHeight-5, 180, ySig+sigHeight-5)
 
 	// --- Footer ---
 	pdf.SetY(265)
@@ -246,3 +270,54 @@ func GenerateInvoice(record models.WeighingRecord) (string, error) {
 
 	return filename, nil
 }
+
+// printAxleTable adds the per-axle weights below the weight table, one row
+// per weighing (first/second) with the axles and their total, formatted by
+// weight in unit
+func printAxleTable(pdf *gofpdf.Fpdf, axles []models.AxleWeight, unit string, weight func(float64) string) {
+	byPass := map[int][]models.AxleWeight{}
+	cols := 0
+	for _, a := range axles {
+		byPass[a.Pass] = append(byPass[a.Pass], a)
+		cols = max(cols, len(byPass[a.Pass]))
+	}
+
+	pdf.Ln(4)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.SetTextColor(25, 109, 236)
+	pdf.Cell(0, 8, fmt.Sprintf("RINCIAN BERAT PER GANDAR (%s)", unit))
+	pdf.Ln(8)
+
+	labelWidth := 30.0
+	colWidth := (190 - labelWidth) / float64(cols+1)
+
+	pdf.SetFillColor(25, 109, 236)
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("Arial", "B", 9)
+	pdf.CellFormat(labelWidth, 7, "Timbang", "1", 0, "C", true, 0, "")
+	for i := 1; i <= cols; i++ {
+		pdf.CellFormat(colWidth, 7, fmt.Sprintf("Gandar %d", i), "1", 0, "C", true, 0, "")
+	}
+	pdf.CellFormat(colWidth, 7, "Total", "1", 1, "C", true, 0, "")
+
+	pdf.SetTextColor(51, 51, 51)
+	for _, pass := range []int{1, 2} {
+		rows := byPass[pass]
+		if len(rows) == 0 {
+			continue
+		}
+		pdf.SetFont("Arial", "", 9)
+		pdf.CellFormat(labelWidth, 7, fmt.Sprintf("Timbang %d", pass), "1", 0, "C", false, 0, "")
+		pdf.SetFont("Courier", "B", 10)
+		total := 0.0
+		for i := 0; i < cols; i++ {
+			cell := "-"
+			if i < len(rows) {
+				cell = weight(rows[i].Weight)
+				total += rows[i].Weight
+			}
+			pdf.CellFormat(colWidth, 7, cell, "1", 0, "C", false, 0, "")
+		}
+		pdf.CellFormat(colWidth, 7, weight(total), "1", 1, "C", false, 0, "")
+	}
+}
@@ -130,17 +130,34 @@ func SetupRouter(server *handlers.Server) *gin.Engine {
 		protected.GET("/dashboard", server.ShowDashboard)
 		protected.GET("/weighing", server.ShowWeighing)
 		protected.GET("/reports", server.ShowReports)
+		protected.GET("/reports/overload", server.ShowOverloadReport)
 
 		// API - Transactions & Hardware
 		api := protected.Group("/api")
 		{
 			api.POST("/transaction", server.SaveTransaction)
+			api.POST("/scales/:id/capture", server.CaptureWeight) // Server-side weight capture token
+			api.POST("/scales/:id/command", server.ScaleCommand)  // Zero/tare/print on the indicator
+			api.POST("/weighing/first", server.FirstWeigh)         // Two-pass: entry weight, PENDING ticket
+			api.GET("/weighing/open", server.GetOpenTickets)       // Two-pass: open tickets by plate
+			api.POST("/weighing/:id/second", server.SecondWeigh)   // Two-pass: exit weight, completes ticket
 			api.POST("/anpr/trigger", server.TriggerANPR)
 			api.GET("/scales/stream", server.StreamScaleData)
 			api.GET("/camera/stream", server.ProxyVideo)           // New RTSP proxy
 			api.GET("/vehicles/details", server.GetVehicleDetails) // Allow operators to fetch details
 			api.GET("/vehicles/search", server.SearchVehicles)     // Autocomplete
+			api.POST("/vehicles/tare", server.WeighTare)           // Tare weighing of an empty vehicle
 			api.GET("/reports/charts", server.GetReportCharts)     // Chart Data
+			api.GET("/transactions/:id/curve", server.GetTransactionCurve)
+		}
+
+		// Kiosk console: supervisors answer the escalations of unattended stations
+		kiosk := protected.Group("/")
+		kiosk.Use(middleware.RoleRequired("supervisor", "admin"))
+		{
+			kiosk.GET("/kiosk", server.ShowKiosk)
+			kiosk.GET("/api/kiosk/status", server.GetKioskStatus)
+			kiosk.POST("/api/kiosk/:id/resolve", server.ResolveKiosk)
 		}
 
 		// Admin Only Routes - Pages
@@ -152,6 +169,8 @@ func SetupRouter(server *handlers.Server) *gin.Engine {
 			adminPages.GET("/hardware", server.ShowSettingsHardware)
 			adminPages.GET("/users", server.ShowUsers)
 			adminPages.GET("/logs", server.ShowLogs)
+			adminPages.GET("/health", server.ShowHealth)
+			adminPages.GET("/outputs", server.ShowOutputs)
 		}
 
 		// Admin Only Routes - APIs
@@ -163,12 +182,17 @@ func SetupRouter(server *handlers.Server) *gin.Engine {
 			adminApi.GET("/vehicles", server.ListVehicles)
 			adminApi.POST("/vehicles", server.CreateVehicle)
 			adminApi.DELETE("/vehicles/:id", server.DeleteVehicle)
+			adminApi.GET("/vehicles/:id/tares", server.GetVehicleTares)
+			adminApi.POST("/vehicles/:id/tags", server.AddVehicleTag)
+			adminApi.DELETE("/vehicles/:id/tags/:tag", server.DeleteVehicleTag)
 
 			// Station / Hardware API
 			adminApi.GET("/stations", server.GetStations)
 			adminApi.POST("/stations", server.CreateStation)
 			adminApi.PUT("/stations/:id", server.UpdateStation)
 			adminApi.DELETE("/stations/:id", server.DeleteStation)
+			adminApi.GET("/ports", server.ListSerialPorts)
+			adminApi.POST("/ports/diagnose", server.DiagnosePort)
 
 			// User Management API
 			adminApi.GET("/users", server.GetUsers)
@@ -179,6 +203,24 @@ func SetupRouter(server *handlers.Server) *gin.Engine {
 
 			// Logs
 			adminApi.GET("/logs", server.GetLogsAPI)
+			adminApi.GET("/audit", server.GetAuditLogsAPI)
+
+			// Scale health
+			adminApi.GET("/scales/health", server.GetScaleHealth)
+			adminApi.GET("/scales/events", server.GetScaleEvents)
+			adminApi.GET("/scales/:id/health", server.GetScaleHealthHistory)
+			adminApi.GET("/scales/:id/curve", server.GetStationCurve)
+
+			// Relay outputs: barrier gates and traffic lights
+			adminApi.GET("/outputs/devices", server.ListOutputDevices)
+			adminApi.POST("/outputs/devices", server.CreateOutputDevice)
+			adminApi.PUT("/outputs/devices/:id", server.UpdateOutputDevice)
+			adminApi.DELETE("/outputs/devices/:id", server.DeleteOutputDevice)
+			adminApi.POST("/outputs/devices/:id/switch", server.SwitchOutput)
+			adminApi.GET("/outputs/rules", server.ListOutputRules)
+			adminApi.POST("/outputs/rules", server.CreateOutputRule)
+			adminApi.DELETE("/outputs/rules/:id", server.DeleteOutputRule)
+			adminApi.GET("/outputs/status", server.GetOutputStatus)
 		}
 	}
 